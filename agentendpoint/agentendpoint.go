@@ -43,6 +43,7 @@ const apiRetrySec = 600
 var (
 	errServerCancel = errors.New("task canceled by server")
 	taskStateFile   = config.TaskStateFile()
+	taskLogDir      = config.TaskLogDir()
 )
 
 // Client is a an agentendpoint client.
@@ -54,13 +55,16 @@ type Client struct {
 	mx     sync.Mutex
 }
 
-// NewClient a new agentendpoint Client.
-func NewClient(ctx context.Context) (*Client, error) {
+// NewClient a new agentendpoint Client. Any provided ClientOptions are
+// applied after the defaults, so they can be used to override the endpoint
+// or supply an existing connection (for instance to a fake server in tests).
+func NewClient(ctx context.Context, clientOpts ...option.ClientOption) (*Client, error) {
 	opts := []option.ClientOption{
 		option.WithoutAuthentication(), // Do not use oauth.
 		option.WithGRPCDialOption(grpc.WithTransportCredentials(credentials.NewTLS(nil))), // Because we disabled Auth we need to specifically enable TLS.
 		option.WithEndpoint(config.SvcEndpoint()),
 	}
+	opts = append(opts, clientOpts...)
 	logger.Debugf("Creating new agentendpoint client.")
 	c, err := agentendpoint.NewClient(ctx, opts...)
 	if err != nil {
@@ -285,6 +289,14 @@ func (c *Client) loadTaskFromState(ctx context.Context) error {
 			st.PatchTask.run(ctx)
 		})
 	}
+	if st != nil && st.ExecTask != nil {
+		st.ExecTask.client = c
+		tasker.Enqueue("ExecRun", func() {
+			if err := st.ExecTask.reportInterrupted(ctx); err != nil {
+				logger.Errorf("Error reporting interrupted exec task: %v", err)
+			}
+		})
+	}
 
 	return nil
 }
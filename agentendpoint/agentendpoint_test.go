@@ -26,13 +26,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
-	agentendpoint "cloud.google.com/go/osconfig/agentendpoint/apiv1beta"
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/agentendpoint/fakeserver"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
 	"golang.org/x/oauth2/jws"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -95,7 +97,8 @@ func newTestClient(ctx context.Context, srv agentendpointpb.AgentEndpointService
 	agentendpointpb.RegisterAgentEndpointServiceServer(s, srv)
 
 	go func() {
-		if err := s.Serve(lis); err != nil {
+		// Tests that make no calls can stop the server before it starts.
+		if err := s.Serve(lis); err != nil && err != grpc.ErrServerStopped {
 			log.Fatalf("Server exited with error: %v", err)
 		}
 	}()
@@ -109,13 +112,13 @@ func newTestClient(ctx context.Context, srv agentendpointpb.AgentEndpointService
 		return nil, err
 	}
 
-	client, err := agentendpoint.NewClient(ctx, option.WithGRPCConn(conn))
+	client, err := NewClient(ctx, option.WithGRPCConn(conn))
 	if err != nil {
 		return nil, err
 	}
 
 	return &testClient{
-		client: &Client{raw: client, noti: make(chan struct{}, 1)},
+		client: client,
 		s:      s,
 	}, nil
 }
@@ -209,6 +212,7 @@ func TestWaitForTask(t *testing.T) {
 	}
 	defer os.RemoveAll(td)
 	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
 
 	// Stream recieve.
 	srv.streamSend <- struct{}{}
@@ -280,6 +284,7 @@ func TestLoadTaskFromState(t *testing.T) {
 	}
 	defer os.RemoveAll(td)
 	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
 
 	// No state.
 	if err := tc.client.loadTaskFromState(ctx); err != nil {
@@ -327,3 +332,70 @@ func TestLoadTaskFromState(t *testing.T) {
 		t.Errorf("first entry in runTaskIDs does not match taskID, %q, %q", srv.runTaskIDs, taskID)
 	}
 }
+
+func TestWaitForTaskFakeServer(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeserver.NewServer()
+	srv.Start()
+	defer srv.Stop()
+
+	conn, err := srv.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	defer func(stateFile, logDir, osName string) {
+		taskStateFile, taskLogDir, run, goos = stateFile, logDir, runWithContext, osName
+	}(taskStateFile, taskLogDir, goos)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	run = func(_ context.Context, cmd *exec.Cmd) error {
+		return nil
+	}
+	goos = "linux"
+
+	execTask := &agentendpointpb.Task{
+		TaskId:   "exec",
+		TaskType: agentendpointpb.TaskType_EXEC_STEP_TASK,
+		TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: &agentendpointpb.ExecStep{
+			LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}},
+		}}},
+	}
+	patchTask := &agentendpointpb.Task{
+		TaskId:      "patch",
+		TaskType:    agentendpointpb.TaskType_APPLY_PATCHES,
+		TaskDetails: &agentendpointpb.Task_ApplyPatchesTask{ApplyPatchesTask: &agentendpointpb.ApplyPatchesTask{}},
+	}
+	srv.QueueTask(execTask, patchTask)
+	srv.SetTaskDirective("patch", agentendpointpb.TaskDirective_STOP)
+	srv.CloseStreamWhenDrained(true)
+
+	srv.Notify()
+	if err := client.waitForTask(ctx); err != nil {
+		t.Errorf("did not expect error from a closed stream: %v", err)
+	}
+	// Wait for the queued task to finish so the tasker is idle.
+	tasker.Enqueue("sync", func() {})
+
+	got := srv.ReportTaskCompleteRequests()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 ReportTaskComplete requests, got %d", len(got))
+	}
+	if got[0].GetTaskId() != "exec" || got[0].GetExecStepTaskOutput().GetState() != agentendpointpb.ExecStepTaskOutput_COMPLETED {
+		t.Errorf("unexpected exec task completion: %v", got[0])
+	}
+	if got[1].GetTaskId() != "patch" || got[1].GetErrorMessage() != errServerCancel.Error() {
+		t.Errorf("unexpected patch task completion: %v", got[1])
+	}
+}
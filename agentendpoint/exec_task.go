@@ -15,26 +15,35 @@
 package agentendpoint
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/config"
+	"github.com/GoogleCloudPlatform/osconfig/execenv"
 	"github.com/GoogleCloudPlatform/osconfig/external"
+	"github.com/GoogleCloudPlatform/osconfig/interpreter"
+	"github.com/golang/protobuf/jsonpb"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
 var (
 	winRoot = os.Getenv("SystemRoot")
-	sh      = "/bin/sh"
 
 	winPowershell string
 	winCmd        string
@@ -55,8 +64,54 @@ func init() {
 	winCmd = filepath.Join(winRoot, `System32\cmd.exe`)
 }
 
-var run = func(cmd *exec.Cmd) ([]byte, error) {
-	return cmd.CombinedOutput()
+var run = runWithContext
+
+var (
+	// execStepTimeout returns the maximum time an exec step may run.
+	execStepTimeout = config.ExecStepTimeout
+	// execKillGracePeriod is how long a command has to exit after SIGTERM
+	// before it is killed.
+	execKillGracePeriod = 10 * time.Second
+
+	errExecTimeout = errors.New("exec step timed out")
+
+	execEnvOptions = execenv.FromConfig
+)
+
+// runWithContext runs cmd in its own process group, if ctx is done before cmd
+// exits the process group is terminated and then killed after
+// execKillGracePeriod.
+func runWithContext(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- cmd.Wait() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Debugf("Terminating process group of pid %d: %v", cmd.Process.Pid, ctx.Err())
+	if err := terminateProcessGroup(cmd); err != nil {
+		logger.Debugf("Error terminating process group: %v", err)
+	}
+	select {
+	case <-errc:
+		return ctx.Err()
+	case <-time.After(execKillGracePeriod):
+	}
+
+	logger.Debugf("Killing process group of pid %d", cmd.Process.Pid)
+	if err := killProcessGroup(cmd); err != nil {
+		logger.Debugf("Error killing process group: %v", err)
+	}
+	<-errc
+	return ctx.Err()
 }
 
 func getGCSObject(ctx context.Context, gcsObject *agentendpointpb.GcsObject, loggingLabels map[string]string) (string, error) {
@@ -84,15 +139,198 @@ func getGCSObject(ctx context.Context, gcsObject *agentendpointpb.GcsObject, log
 	return localPath, nil
 }
 
-func executeCommand(path string, args []string, loggingLabels map[string]string) (int32, error) {
+const (
+	// execOutputBufferSize is how much of each of stdout and stderr is kept
+	// in memory, the full output is written to the task log file.
+	execOutputBufferSize = 64 * 1024
+	// execOutputReportSize is how much of the tail of each of stdout and
+	// stderr is included in progress logs and completion reports.
+	execOutputReportSize = 2 * 1024
+)
+
+// execProgressInterval is how often progress is reported while a command runs.
+var execProgressInterval = 30 * time.Second
+
+// execOutput captures the stdout and stderr of an exec step.
+type execOutput struct {
+	stdout, stderr *ringBuffer
+}
+
+func newExecOutput() *execOutput {
+	return &execOutput{stdout: newRingBuffer(execOutputBufferSize), stderr: newRingBuffer(execOutputBufferSize)}
+}
+
+// tail formats the last n bytes of stdout and stderr for reporting.
+func (o *execOutput) tail(n int) string {
+	var ret string
+	for _, s := range []struct {
+		name string
+		buf  *ringBuffer
+	}{{"stdout", o.stdout}, {"stderr", o.stderr}} {
+		d, truncated := s.buf.Tail(n)
+		if len(d) == 0 {
+			continue
+		}
+		d = bytes.TrimSuffix(d, []byte("\n"))
+		if truncated {
+			ret += fmt.Sprintf("%s (truncated):\n...%s\n", s.name, d)
+		} else {
+			ret += fmt.Sprintf("%s:\n%s\n", s.name, d)
+		}
+	}
+	return ret
+}
+
+// lockedWriter serializes writes to w, stdout and stderr are copied to the log
+// file from separate goroutines.
+type lockedWriter struct {
+	mx sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.w.Write(p)
+}
+
+// maxExecLogs is the number of exec task log files kept, older ones are
+// removed when an exec step runs.
+const maxExecLogs = 50
+
+func (e *execTask) logFile() string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(e.TaskID)
+	return filepath.Join(taskLogDir, fmt.Sprintf("exec_%s.log", name))
+}
+
+// pruneExecLogs removes all but the newest maxExecLogs exec task log files.
+func pruneExecLogs() {
+	paths, err := filepath.Glob(filepath.Join(taskLogDir, "exec_*.log"))
+	if err != nil || len(paths) <= maxExecLogs {
+		return
+	}
+	var logs []os.FileInfo
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		logs = append(logs, fi)
+	}
+	if len(logs) <= maxExecLogs {
+		return
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ModTime().After(logs[j].ModTime()) })
+	for _, fi := range logs[maxExecLogs:] {
+		if err := os.Remove(filepath.Join(taskLogDir, fi.Name())); err != nil {
+			logger.Warningf("Error removing old exec task log: %v", err)
+		}
+	}
+}
+
+// setupCommand applies the configured user, environment, working directory
+// and umask to cmd. If no working directory is configured a per task directory
+// is created, it is removed by the returned cleanup function.
+func (e *execTask) setupCommand(cmd *exec.Cmd) (func(), error) {
+	opts := execEnvOptions()
+	opts.Env = append(opts.Env, "OSCONFIG_TASK_ID="+e.TaskID)
+
+	cleanup := func() {}
+	if opts.Dir == "" {
+		dir, err := ioutil.TempDir("", "osconfig_exec_")
+		if err != nil {
+			return nil, fmt.Errorf("error creating working directory: %v", err)
+		}
+		cleanup = func() {
+			if err := os.RemoveAll(dir); err != nil {
+				logger.Warningf("Failed to remove exec step working directory %q: %v", dir, err)
+			}
+		}
+		opts.Dir = dir
+		// Only the per task directory is handed to the exec user.
+		if err := opts.Chown(opts.Dir); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("error setting owner of working directory: %v", err)
+		}
+	} else {
+		// The configured directory may be shared, its owner is never
+		// changed so the exec user must already be able to use it.
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating working directory: %v", err)
+		}
+		if err := opts.CheckDir(opts.Dir); err != nil {
+			return nil, fmt.Errorf("working directory can not be used by the exec user: %v", err)
+		}
+	}
+
+	if err := opts.Apply(cmd); err != nil {
+		cleanup()
+		return nil, err
+	}
+	return cleanup, nil
+}
+
+// executeCommand runs the command streaming its output to e.output and the
+// task log file, while it runs progress is periodically reported.
+func (e *execTask) executeCommand(ctx context.Context, path string, args []string) (int32, error) {
 	logger.Debugf("Running command %s with args %s", path, args)
 
+	e.output = newExecOutput()
+	stdout := io.Writer(e.output.stdout)
+	stderr := io.Writer(e.output.stderr)
+	if err := os.MkdirAll(taskLogDir, 0755); err != nil {
+		logger.Errorf("Error creating task log directory: %v", err)
+	} else if f, err := os.OpenFile(e.logFile(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err != nil {
+		logger.Errorf("Error creating task log file: %v", err)
+	} else {
+		defer f.Close()
+		pruneExecLogs()
+		lf := &lockedWriter{w: f}
+		stdout = io.MultiWriter(stdout, lf)
+		stderr = io.MultiWriter(stderr, lf)
+	}
+
+	// Stopped is closed if the server tells us to stop the task.
+	stopped := make(chan struct{})
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timeout := execStepTimeout()
+	if timeout > 0 {
+		cmdCtx, cancel = context.WithTimeout(cmdCtx, timeout)
+		defer cancel()
+	}
+
 	cmd := exec.Command(path, args...)
-	out, err := run(cmd)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cleanup, err := e.setupCommand(cmd)
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
+
+	done := make(chan struct{})
+	defer close(done)
+	go e.reportOutputProgress(ctx, done, func() {
+		close(stopped)
+		cancel()
+	})
+
+	err = run(cmdCtx, cmd)
 	var exitCode int32
 	if cmd.ProcessState != nil {
 		exitCode = int32(cmd.ProcessState.ExitCode())
-		logger.Infof("Command exit code: %d, out:\n%s", exitCode, out)
+		logger.Log(logger.LogEntry{Message: fmt.Sprintf("Command exit code: %d, out:\n%s", exitCode, e.output.tail(execOutputReportSize)), Severity: logger.Info, Labels: e.LogLabels})
+	}
+
+	select {
+	case <-stopped:
+		return exitCode, errServerCancel
+	default:
+	}
+	if cmdCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		logger.Log(logger.LogEntry{Message: fmt.Sprintf("Command timed out after %s", timeout), Severity: logger.Error, Labels: e.LogLabels})
+		return exitCode, errExecTimeout
 	}
 	if err != nil {
 		if _, ok := err.(*exec.ExitError); !ok {
@@ -103,6 +341,46 @@ func executeCommand(path string, args []string, loggingLabels map[string]string)
 	return exitCode, nil
 }
 
+// executeScript runs the script at path with the resolved interpreter.
+func (e *execTask) executeScript(ctx context.Context, i interpreter.Interpreter, path string) (int32, error) {
+	cmd, args, err := interpreter.Command(i, path)
+	if err != nil {
+		return -1, err
+	}
+	return e.executeCommand(ctx, cmd, args)
+}
+
+// reportOutputProgress reports progress and logs the tail of the output every
+// execProgressInterval until done is closed, stop is called if the server
+// directs us to stop the task. ExecStepTaskProgress has no field for output so
+// the tail is sent to the task log with the task labels.
+func (e *execTask) reportOutputProgress(ctx context.Context, done <-chan struct{}, stop func()) {
+	ticker := time.NewTicker(execProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if out := e.output.tail(execOutputReportSize); out != "" {
+				logger.Log(logger.LogEntry{Message: fmt.Sprintf("Command output so far:\n%s", out), Severity: logger.Info, Labels: e.LogLabels})
+			}
+			res, err := e.reportProgress(ctx)
+			if err != nil {
+				logger.Errorf(err.Error())
+				continue
+			}
+			if res.GetTaskDirective() == agentendpointpb.TaskDirective_STOP {
+				logger.Log(logger.LogEntry{Message: "Server requested the task be stopped, canceling command", Severity: logger.Info, Labels: e.LogLabels})
+				stop()
+				return
+			}
+		}
+	}
+}
+
 type execTask struct {
 	client *Client
 
@@ -110,12 +388,39 @@ type execTask struct {
 	Task      *execStepTask
 	StartedAt time.Time         `json:",omitempty"`
 	LogLabels map[string]string `json:",omitempty"`
+
+	output *execOutput
+}
+
+func (e *execTask) saveState() error {
+	return saveState(&taskState{ExecTask: e}, taskStateFile)
+}
+
+func (e *execTask) complete() {
+	if err := saveState(nil, taskStateFile); err != nil {
+		logger.Errorf("Error saving state: %v", err)
+	}
 }
 
 type execStepTask struct {
 	*agentendpointpb.ExecStepTask
 }
 
+// MarshalJSON marshals an execStepTask using jsonpb.
+func (j *execStepTask) MarshalJSON() ([]byte, error) {
+	m := jsonpb.Marshaler{}
+	s, err := m.MarshalToString(j)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalJSON unmarshals an execStepTask using jsonpb.
+func (j *execStepTask) UnmarshalJSON(b []byte) error {
+	return jsonpb.UnmarshalString(string(b), j)
+}
+
 func (e *execTask) reportCompletedState(ctx context.Context, errMsg string, output *agentendpointpb.ReportTaskCompleteRequest_ExecStepTaskOutput) error {
 	req := &agentendpointpb.ReportTaskCompleteRequest{
 		TaskId:       e.TaskID,
@@ -129,8 +434,7 @@ func (e *execTask) reportCompletedState(ctx context.Context, errMsg string, outp
 	return nil
 }
 
-func (e *execTask) run(ctx context.Context) error {
-	e.StartedAt = time.Now()
+func (e *execTask) reportProgress(ctx context.Context) (*agentendpointpb.ReportTaskProgressResponse, error) {
 	req := &agentendpointpb.ReportTaskProgressRequest{
 		TaskId:   e.TaskID,
 		TaskType: agentendpointpb.TaskType_EXEC_STEP_TASK,
@@ -140,7 +444,37 @@ func (e *execTask) run(ctx context.Context) error {
 	}
 	res, err := e.client.reportTaskProgress(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error reporting state %s: %v", agentendpointpb.ExecStepTaskProgress_STARTED, err)
+		return nil, fmt.Errorf("error reporting state %s: %v", agentendpointpb.ExecStepTaskProgress_STARTED, err)
+	}
+	return res, nil
+}
+
+// reportInterrupted reports an exec task loaded from the state file as
+// completed, the agent was restarted while it was running so we have no way to
+// know the outcome of the step.
+func (e *execTask) reportInterrupted(ctx context.Context) error {
+	defer e.complete()
+
+	msg := fmt.Sprintf("exec step interrupted by an agent restart, step was started at %s", e.StartedAt.Format(time.RFC3339))
+	logger.Errorf("Task %q: %s", e.TaskID, msg)
+	return e.reportCompletedState(ctx, msg, &agentendpointpb.ReportTaskCompleteRequest_ExecStepTaskOutput{
+		ExecStepTaskOutput: &agentendpointpb.ExecStepTaskOutput{
+			State:    agentendpointpb.ExecStepTaskOutput_COMPLETED,
+			ExitCode: -1,
+		},
+	})
+}
+
+func (e *execTask) run(ctx context.Context) error {
+	defer e.complete()
+
+	e.StartedAt = time.Now()
+	if err := e.saveState(); err != nil {
+		return fmt.Errorf("error saving state: %v", err)
+	}
+	res, err := e.reportProgress(ctx)
+	if err != nil {
+		return err
 	}
 
 	if res.GetTaskDirective() == agentendpointpb.TaskDirective_STOP {
@@ -174,40 +508,76 @@ func (e *execTask) run(ctx context.Context) error {
 		if goos == "windows" {
 			err = errWinNoInt
 		} else {
-			exitCode, err = executeCommand(localPath, nil, e.LogLabels)
+			exitCode, err = e.executeScript(ctx, interpreter.Default, localPath)
 		}
 	case agentendpointpb.ExecStepConfig_SHELL:
 		if goos == "windows" {
-			exitCode, err = executeCommand(winCmd, []string{"/c", localPath}, e.LogLabels)
+			exitCode, err = e.executeCommand(ctx, winCmd, []string{"/c", localPath})
 		} else {
-			exitCode, err = executeCommand(sh, []string{localPath}, e.LogLabels)
+			exitCode, err = e.executeScript(ctx, interpreter.Shell, localPath)
 		}
 	case agentendpointpb.ExecStepConfig_POWERSHELL:
 		if goos == "windows" {
-			exitCode, err = executeCommand(winPowershell, append(winPowershellArgs, "-File", localPath), e.LogLabels)
+			exitCode, err = e.executeCommand(ctx, winPowershell, append(winPowershellArgs, "-File", localPath))
 		} else {
 			err = errLinuxPowerShell
 		}
 	default:
 		err = fmt.Errorf("invalid interpreter %q", stepConfig.GetInterpreter())
 	}
-	if err != nil {
-		return e.reportCompletedState(ctx, err.Error(), &agentendpointpb.ReportTaskCompleteRequest_ExecStepTaskOutput{
-			ExecStepTaskOutput: &agentendpointpb.ExecStepTaskOutput{
-				State:    agentendpointpb.ExecStepTaskOutput_COMPLETED,
-				ExitCode: exitCode,
-			},
-		})
-	}
 
-	return e.reportCompletedState(ctx, "", &agentendpointpb.ReportTaskCompleteRequest_ExecStepTaskOutput{
+	state := agentendpointpb.ExecStepTaskOutput_COMPLETED
+	switch err {
+	case errServerCancel:
+		state = agentendpointpb.ExecStepTaskOutput_CANCELLED
+	case errExecTimeout:
+		state = agentendpointpb.ExecStepTaskOutput_TIMED_OUT
+	}
+	return e.reportCompletedState(ctx, e.completionMessage(err, exitCode, stepConfig.GetAllowedSuccessCodes()), &agentendpointpb.ReportTaskCompleteRequest_ExecStepTaskOutput{
 		ExecStepTaskOutput: &agentendpointpb.ExecStepTaskOutput{
-			State:    agentendpointpb.ExecStepTaskOutput_COMPLETED,
+			State:    state,
 			ExitCode: exitCode,
 		},
 	})
 }
 
+// completionMessage returns the error message for the completion report. The
+// ExecStepTaskOutput has no field for output so if the step failed to run, or
+// exited with a code not in allowed, the tail of its output is included here,
+// the full output is in the task log file.
+func (e *execTask) completionMessage(err error, exitCode int32, allowed []int32) string {
+	var msg string
+	switch {
+	case err != nil:
+		msg = err.Error()
+	case !successCode(exitCode, allowed):
+		msg = fmt.Sprintf("exit code %d is not an allowed success code", exitCode)
+	default:
+		return ""
+	}
+	if e.output == nil {
+		return msg
+	}
+	if out := e.output.tail(execOutputReportSize); out != "" {
+		msg = fmt.Sprintf("%s, output:\n%s", msg, out)
+	}
+	return msg
+}
+
+// successCode reports whether code is in allowed, if allowed is empty only 0
+// is a success.
+func successCode(code int32, allowed []int32) bool {
+	if len(allowed) == 0 {
+		return code == 0
+	}
+	for _, c := range allowed {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
 // RunExecStep runs an exec step task.
 func (c *Client) RunExecStep(ctx context.Context, task *agentendpointpb.Task) error {
 	e := &execTask{
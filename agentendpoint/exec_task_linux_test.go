@@ -0,0 +1,63 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunWithContext(t *testing.T) {
+	execKillGracePeriod = 100 * time.Millisecond
+	defer func() { execKillGracePeriod = 10 * time.Second }()
+
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"Terminate", "sleep 30"},
+		// Ignore SIGTERM and leave a child holding stdout open, the process
+		// group has to be killed for the command to return.
+		{"Kill", "trap '' TERM; sleep 30 & wait"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			cmd := exec.Command("/bin/sh", "-c", tt.script)
+			cmd.Stdout = &bytes.Buffer{}
+			start := time.Now()
+			if err := runWithContext(ctx, cmd); err != context.DeadlineExceeded {
+				t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("command took %s to be stopped", d)
+			}
+		})
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	err := runWithContext(context.Background(), cmd)
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("expected *exec.ExitError, got: %v", err)
+	}
+	if cmd.ProcessState.ExitCode() != 3 {
+		t.Errorf("unexpected exit code: %d", cmd.ProcessState.ExitCode())
+	}
+}
@@ -16,10 +16,24 @@ package agentendpoint
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/GoogleCloudPlatform/osconfig/agentendpoint/fakeserver"
+	"github.com/GoogleCloudPlatform/osconfig/config"
+	"github.com/GoogleCloudPlatform/osconfig/execenv"
+	"github.com/GoogleCloudPlatform/osconfig/tasker"
+	"google.golang.org/api/option"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -72,6 +86,14 @@ func TestRunExecStep(t *testing.T) {
 	}
 	defer tc.close()
 
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
 	tests := []struct {
 		name       string
 		goos       string
@@ -81,7 +103,7 @@ func TestRunExecStep(t *testing.T) {
 		step       *agentendpointpb.ExecStep
 	}{
 		{"LinuxExec", "linux", outputGen("", "", agentendpointpb.ExecStepTaskOutput_COMPLETED, 0), "foo", []string{"foo"}, &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}},
-		{"LinuxShell", "linux", outputGen("", "", agentendpointpb.ExecStepTaskOutput_COMPLETED, 0), sh, []string{sh, "foo"}, &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}, Interpreter: agentendpointpb.ExecStepConfig_SHELL}}},
+		{"LinuxShell", "linux", outputGen("", "", agentendpointpb.ExecStepTaskOutput_COMPLETED, 0), "/bin/sh", []string{"/bin/sh", "foo"}, &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}, Interpreter: agentendpointpb.ExecStepConfig_SHELL}}},
 		{"LinuxPowerShell", "linux", outputGen("", errLinuxPowerShell.Error(), agentendpointpb.ExecStepTaskOutput_COMPLETED, -1), "", nil, &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}, Interpreter: agentendpointpb.ExecStepConfig_POWERSHELL}}},
 		{"WinExec", "windows", outputGen("", errWinNoInt.Error(), agentendpointpb.ExecStepTaskOutput_COMPLETED, -1), "", nil, &agentendpointpb.ExecStep{WindowsExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}},
 		{"WinShell", "windows", outputGen("", "", agentendpointpb.ExecStepTaskOutput_COMPLETED, 0), winCmd, []string{winCmd, "/c", "foo"}, &agentendpointpb.ExecStep{WindowsExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}, Interpreter: agentendpointpb.ExecStepConfig_SHELL}}},
@@ -92,10 +114,10 @@ func TestRunExecStep(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var gotPath string
 			var gotArgs []string
-			run = func(cmd *exec.Cmd) ([]byte, error) {
+			run = func(_ context.Context, cmd *exec.Cmd) error {
 				gotPath = cmd.Path
 				gotArgs = cmd.Args
-				return nil, nil
+				return nil
 			}
 			goos = tt.goos
 
@@ -117,3 +139,511 @@ func TestRunExecStep(t *testing.T) {
 		})
 	}
 }
+
+func TestRunExecStepSavesState(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	var st *taskState
+	run = func(_ context.Context, cmd *exec.Cmd) error {
+		st, err = loadState(taskStateFile)
+		return err
+	}
+	goos = "linux"
+
+	step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}
+	if err := tc.client.RunExecStep(ctx, &agentendpointpb.Task{TaskId: "foo", TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st == nil || st.ExecTask == nil {
+		t.Fatalf("expected exec task to be saved while running, got: %+v", st)
+	}
+	if st.ExecTask.TaskID != "foo" {
+		t.Errorf("unexpected TaskID in state, want: %q, got: %q", "foo", st.ExecTask.TaskID)
+	}
+	if st.ExecTask.Task.GetExecStep().GetLinuxExecStepConfig().GetLocalPath() != "foo" {
+		t.Errorf("exec step not saved correctly: %v", st.ExecTask.Task)
+	}
+
+	st, err = loadState(taskStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ExecTask != nil {
+		t.Errorf("expected state to be cleared after the task completed, got: %+v", st.ExecTask)
+	}
+}
+
+func TestLoadExecTaskFromState(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := ioutil.WriteFile(taskStateFile, []byte(fmt.Sprintf(`{"ExecTask":{"TaskID":"foo","StartedAt":%q}}`, started.Format(time.RFC3339))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.client.loadTaskFromState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the queued task to finish.
+	tasker.Enqueue("sync", func() {})
+
+	got := srv.lastReportTaskCompleteRequest
+	if got.GetTaskId() != "foo" {
+		t.Fatalf("expected ReportTaskComplete for task foo, got: %v", got)
+	}
+	if got.GetExecStepTaskOutput().GetExitCode() != -1 || got.GetExecStepTaskOutput().GetState() != agentendpointpb.ExecStepTaskOutput_COMPLETED {
+		t.Errorf("unexpected output: %v", got.GetExecStepTaskOutput())
+	}
+	if !strings.Contains(got.GetErrorMessage(), "interrupted") || !strings.Contains(got.GetErrorMessage(), started.Format(time.RFC3339)) {
+		t.Errorf("unexpected error message: %q", got.GetErrorMessage())
+	}
+
+	st, err := loadState(taskStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ExecTask != nil {
+		t.Errorf("expected state to be cleared, got: %+v", st.ExecTask)
+	}
+}
+
+func TestRunExecStepOutput(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeserver.NewServer()
+	srv.Start()
+	defer srv.Stop()
+
+	conn, err := srv.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	execProgressInterval = 10 * time.Millisecond
+	defer func() { execProgressInterval = 30 * time.Second }()
+
+	run = func(_ context.Context, cmd *exec.Cmd) error {
+		fmt.Fprint(cmd.Stdout, "out1\n")
+		fmt.Fprint(cmd.Stderr, "err1\n")
+		// Give the progress reporter time to run.
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(cmd.Stdout, "out2\n")
+		return errors.New("command failed")
+	}
+	goos = "linux"
+
+	step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}
+	if err := client.RunExecStep(ctx, &agentendpointpb.Task{TaskId: "foo", TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(srv.ReportTaskProgressRequests()); got < 2 {
+		t.Errorf("expected periodic ReportTaskProgress requests while running, got %d", got)
+	}
+
+	complete := srv.ReportTaskCompleteRequests()
+	if len(complete) != 1 {
+		t.Fatalf("expected 1 ReportTaskComplete request, got %d", len(complete))
+	}
+	want := "command failed, output:\nstdout:\nout1\nout2\nstderr:\nerr1\n"
+	if got := complete[0].GetErrorMessage(); got != want {
+		t.Errorf("unexpected ErrorMessage, want: %q, got: %q", want, got)
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(td, "exec_foo.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(log); got != "out1\nerr1\nout2\n" {
+		t.Errorf("unexpected task log contents: %q", got)
+	}
+}
+
+func TestRunExecStepExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test runs a shell script")
+	}
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	goos = "linux"
+
+	tests := []struct {
+		name     string
+		exitCode int32
+		allowed  []int32
+		wantMsg  string
+	}{
+		{"Success", 0, nil, ""},
+		{"NotAllowed", 3, nil, "exit code 3 is not an allowed success code, output:\nstdout:\nout\n"},
+		{"Allowed", 3, []int32{0, 3}, ""},
+		{"ZeroNotAllowed", 0, []int32{3}, "exit code 0 is not an allowed success code, output:\nstdout:\nout\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run = func(_ context.Context, cmd *exec.Cmd) error {
+				sh := exec.Command("/bin/sh", "-c", fmt.Sprintf("echo out; exit %d", tt.exitCode))
+				sh.Dir, sh.Env, sh.Stdout, sh.Stderr = cmd.Dir, cmd.Env, cmd.Stdout, cmd.Stderr
+				err := sh.Run()
+				cmd.ProcessState = sh.ProcessState
+				return err
+			}
+
+			step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}, AllowedSuccessCodes: tt.allowed}}
+			if err := tc.client.RunExecStep(ctx, &agentendpointpb.Task{TaskId: "foo", TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := srv.lastReportTaskCompleteRequest
+			if got.GetExecStepTaskOutput().GetExitCode() != tt.exitCode {
+				t.Errorf("unexpected exit code, want: %d, got: %d", tt.exitCode, got.GetExecStepTaskOutput().GetExitCode())
+			}
+			if !strings.HasPrefix(got.GetErrorMessage(), tt.wantMsg) || (tt.wantMsg == "" && got.GetErrorMessage() != "") {
+				t.Errorf("unexpected ErrorMessage, want: %q, got: %q", tt.wantMsg, got.GetErrorMessage())
+			}
+		})
+	}
+}
+
+func TestPruneExecLogs(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskLogDir = td
+
+	now := time.Now()
+	for i := 0; i < maxExecLogs+5; i++ {
+		path := filepath.Join(td, fmt.Sprintf("exec_%d.log", i))
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// exec_0.log is the newest.
+		mod := now.Add(-time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := filepath.Join(td, "other.log")
+	if err := ioutil.WriteFile(other, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pruneExecLogs()
+
+	logs, err := filepath.Glob(filepath.Join(td, "exec_*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != maxExecLogs {
+		t.Errorf("want %d exec logs after pruning, got %d", maxExecLogs, len(logs))
+	}
+	if _, err := os.Stat(filepath.Join(td, "exec_0.log")); err != nil {
+		t.Errorf("newest exec log should be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(td, fmt.Sprintf("exec_%d.log", maxExecLogs))); !os.IsNotExist(err) {
+		t.Errorf("oldest exec logs should be removed, got: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("other task logs should be kept: %v", err)
+	}
+}
+
+func TestRunExecStepTimeoutAndCancel(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeserver.NewServer()
+	srv.Start()
+	defer srv.Stop()
+
+	conn, err := srv.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	execProgressInterval = 10 * time.Millisecond
+	defer func() {
+		execProgressInterval = 30 * time.Second
+		execStepTimeout = config.ExecStepTimeout
+	}()
+	goos = "linux"
+
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		stop      bool
+		wantState agentendpointpb.ExecStepTaskOutput_State
+		wantMsg   string
+	}{
+		{"Timeout", 50 * time.Millisecond, false, agentendpointpb.ExecStepTaskOutput_TIMED_OUT, errExecTimeout.Error()},
+		{"Stop", 0, true, agentendpointpb.ExecStepTaskOutput_CANCELLED, errServerCancel.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execStepTimeout = func() time.Duration { return tt.timeout }
+			run = func(ctx context.Context, cmd *exec.Cmd) error {
+				if tt.stop {
+					srv.SetTaskDirective(tt.name, agentendpointpb.TaskDirective_STOP)
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(5 * time.Second):
+					return errors.New("command was not canceled")
+				}
+			}
+
+			step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}
+			if err := client.RunExecStep(ctx, &agentendpointpb.Task{TaskId: tt.name, TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := srv.WaitForComplete(time.Second)
+			if got.GetTaskId() != tt.name {
+				t.Fatalf("expected ReportTaskComplete for %q, got: %v", tt.name, got)
+			}
+			if got.GetExecStepTaskOutput().GetState() != tt.wantState {
+				t.Errorf("unexpected state, want: %s, got: %s", tt.wantState, got.GetExecStepTaskOutput().GetState())
+			}
+			if got.GetErrorMessage() != tt.wantMsg {
+				t.Errorf("unexpected ErrorMessage, want: %q, got: %q", tt.wantMsg, got.GetErrorMessage())
+			}
+		})
+	}
+}
+
+func TestRunExecStepEnvironment(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	goos = "linux"
+	defer func() { execEnvOptions = execenv.FromConfig }()
+
+	workDir := filepath.Join(td, "work")
+	tests := []struct {
+		name    string
+		opts    execenv.Options
+		wantDir string
+	}{
+		{"WorkingDir", execenv.Options{EnvAllowlist: []string{}, Env: []string{"FOO=bar"}, Dir: workDir, Umask: -1}, workDir},
+		{"TaskDir", execenv.Options{EnvAllowlist: []string{}, Env: []string{"FOO=bar"}, Umask: -1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execEnvOptions = func() execenv.Options { return tt.opts }
+			var gotEnv []string
+			var gotDir string
+			run = func(_ context.Context, cmd *exec.Cmd) error {
+				gotEnv = cmd.Env
+				gotDir = cmd.Dir
+				if _, err := os.Stat(cmd.Dir); err != nil {
+					t.Errorf("working directory does not exist: %v", err)
+				}
+				return nil
+			}
+
+			step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}
+			if err := tc.client.RunExecStep(ctx, &agentendpointpb.Task{TaskId: "foo", TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{"FOO=bar", "OSCONFIG_TASK_ID=foo"}; !reflect.DeepEqual(gotEnv, want) {
+				t.Errorf("unexpected env, want: %q, got: %q", want, gotEnv)
+			}
+			if tt.wantDir != "" {
+				if gotDir != tt.wantDir {
+					t.Errorf("unexpected working directory, want: %q, got: %q", tt.wantDir, gotDir)
+				}
+				return
+			}
+			if gotDir == "" {
+				t.Fatal("expected a per task working directory")
+			}
+			if _, err := os.Stat(gotDir); !os.IsNotExist(err) {
+				t.Errorf("expected per task working directory to be removed, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunExecStepWorkingDirNotUsable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("running as a different user is not supported on Windows")
+	}
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skipf("no nobody user: %v", err)
+	}
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	goos = "linux"
+	defer func() { execEnvOptions = execenv.FromConfig }()
+
+	// The agent owned directory is not writable by nobody and must not be
+	// handed to it.
+	workDir := filepath.Join(td, "work")
+	if err := os.Mkdir(workDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execEnvOptions = func() execenv.Options {
+		return execenv.Options{User: "nobody", EnvAllowlist: []string{}, Dir: workDir, Umask: -1}
+	}
+	run = func(context.Context, *exec.Cmd) error {
+		t.Error("command should not be run")
+		return nil
+	}
+
+	step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: "foo"}}}
+	if err := tc.client.RunExecStep(ctx, &agentendpointpb.Task{TaskId: "foo", TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+		t.Fatal(err)
+	}
+	got := srv.lastReportTaskCompleteRequest
+	if got.GetExecStepTaskOutput().GetState() != agentendpointpb.ExecStepTaskOutput_COMPLETED || !strings.Contains(got.GetErrorMessage(), "working directory can not be used") {
+		t.Errorf("unexpected ReportTaskCompleteRequest: %+v", got)
+	}
+	after, err := os.Stat(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after.Sys(), before.Sys()) {
+		t.Error("the owner of the configured working directory should not change")
+	}
+}
+
+func TestRunExecStepMissingInterpreter(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	goos = "linux"
+
+	script := filepath.Join(td, "script")
+	if err := ioutil.WriteFile(script, []byte("#!/usr/bin/env doesnotexist\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var ran bool
+	run = func(_ context.Context, cmd *exec.Cmd) error {
+		ran = true
+		return nil
+	}
+
+	step := &agentendpointpb.ExecStep{LinuxExecStepConfig: &agentendpointpb.ExecStepConfig{Executable: &agentendpointpb.ExecStepConfig_LocalPath{LocalPath: script}}}
+	if err := tc.client.RunExecStep(ctx, &agentendpointpb.Task{TaskDetails: &agentendpointpb.Task_ExecStepTask{ExecStepTask: &agentendpointpb.ExecStepTask{ExecStep: step}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ran {
+		t.Error("did not expect the script to be run")
+	}
+	got := srv.lastReportTaskCompleteRequest
+	if !strings.Contains(got.GetErrorMessage(), `interpreter "doesnotexist" not found`) {
+		t.Errorf("unexpected ErrorMessage: %q", got.GetErrorMessage())
+	}
+	if got.GetExecStepTaskOutput().GetExitCode() != -1 {
+		t.Errorf("unexpected exit code: %d", got.GetExecStepTaskOutput().GetExitCode())
+	}
+}
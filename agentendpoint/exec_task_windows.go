@@ -0,0 +1,50 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// +build windows
+
+package agentendpoint
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+func taskkill(cmd *exec.Cmd, force bool) error {
+	args := []string{"/T", "/PID", strconv.Itoa(cmd.Process.Pid)}
+	if force {
+		args = append([]string{"/F"}, args...)
+	}
+	return exec.Command(filepath.Join(winRoot, `System32\taskkill.exe`), args...).Run()
+}
+
+// terminateProcessGroup asks the process tree of cmd to exit.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return taskkill(cmd, false)
+}
+
+// killProcessGroup forcefully ends the process tree of cmd.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return taskkill(cmd, true)
+}
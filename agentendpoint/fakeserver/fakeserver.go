@@ -0,0 +1,346 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package fakeserver provides an in-process fake of the osconfig
+// AgentEndpointService for use in hermetic tests.
+package fakeserver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+// Method names used for error injection and request recording.
+const (
+	ReceiveTaskNotification    = "ReceiveTaskNotification"
+	StartNextTask              = "StartNextTask"
+	ReportTaskProgress         = "ReportTaskProgress"
+	ReportTaskComplete         = "ReportTaskComplete"
+	LookupEffectiveGuestPolicy = "LookupEffectiveGuestPolicy"
+)
+
+const bufSize = 1024 * 1024
+
+// Request is a request recorded by the Server.
+type Request struct {
+	Method  string
+	Message proto.Message
+}
+
+// Server is a fake AgentEndpointServiceServer. Tasks queued with QueueTask are
+// handed out in order by StartNextTask, every request is recorded, and errors
+// can be injected per method.
+type Server struct {
+	mx         sync.Mutex
+	tasks      []*agentendpointpb.Task
+	directives map[string]agentendpointpb.TaskDirective
+	errs       map[string][]codes.Code
+	requests   []Request
+	policy     *agentendpointpb.EffectiveGuestPolicy
+
+	// If set, the notification stream is closed once StartNextTask finds
+	// the task queue empty.
+	closeStreamWhenDrained bool
+
+	// notifications and streamErrs are queued for the notification stream,
+	// wake is closed and replaced when either is added to.
+	notifications int
+	streamErrs    []error
+	wake          chan struct{}
+
+	streamClose chan struct{}
+	complete    chan *agentendpointpb.ReportTaskCompleteRequest
+
+	srv *grpc.Server
+	lis *bufconn.Listener
+}
+
+// NewServer creates a new Server, Start must be called before dialing it.
+func NewServer() *Server {
+	return &Server{
+		directives:  make(map[string]agentendpointpb.TaskDirective),
+		errs:        make(map[string][]codes.Code),
+		wake:        make(chan struct{}),
+		streamClose: make(chan struct{}, 1),
+		complete:    make(chan *agentendpointpb.ReportTaskCompleteRequest, 100),
+	}
+}
+
+// Start starts serving on an in-memory listener.
+func (s *Server) Start() {
+	s.lis = bufconn.Listen(bufSize)
+	s.Serve(s.lis)
+}
+
+// Serve starts serving on the provided listener in a separate goroutine, this
+// can be used to run the fake on a real network address.
+func (s *Server) Serve(lis net.Listener) {
+	s.srv = grpc.NewServer()
+	agentendpointpb.RegisterAgentEndpointServiceServer(s.srv, s)
+	go s.srv.Serve(lis)
+}
+
+// Stop stops the server.
+func (s *Server) Stop() {
+	if s.srv != nil {
+		s.srv.Stop()
+	}
+}
+
+// Dial creates a ClientConn to the in-memory listener created by Start. The
+// returned connection can be handed to agentendpoint.NewClient using
+// option.WithGRPCConn.
+func (s *Server) Dial(ctx context.Context) (*grpc.ClientConn, error) {
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return s.lis.Dial()
+	}
+	return grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+}
+
+// QueueTask adds tasks to the end of the task queue.
+func (s *Server) QueueTask(tasks ...*agentendpointpb.Task) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.tasks = append(s.tasks, tasks...)
+}
+
+// SetTaskDirective sets the directive returned from ReportTaskProgress for
+// the given task.
+func (s *Server) SetTaskDirective(taskID string, directive agentendpointpb.TaskDirective) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.directives[taskID] = directive
+}
+
+// SetEffectiveGuestPolicy sets the response for LookupEffectiveGuestPolicy.
+func (s *Server) SetEffectiveGuestPolicy(egp *agentendpointpb.EffectiveGuestPolicy) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.policy = egp
+}
+
+// CloseStreamWhenDrained causes the notification stream to be closed once
+// StartNextTask is called with an empty task queue.
+func (s *Server) CloseStreamWhenDrained(b bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.closeStreamWhenDrained = b
+}
+
+// InjectError causes the next call to method to fail with code. Multiple
+// calls queue up errors that are returned in order. For
+// ReceiveTaskNotification the error ends the current, or next, notification
+// stream.
+func (s *Server) InjectError(method string, code codes.Code) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if method == ReceiveTaskNotification {
+		s.streamErrs = append(s.streamErrs, status.Errorf(code, "injected error"))
+		s.wakeStream()
+		return
+	}
+	s.errs[method] = append(s.errs[method], code)
+}
+
+// Notify sends a task notification on the notification stream, it never
+// blocks.
+func (s *Server) Notify() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.notifications++
+	s.wakeStream()
+}
+
+// wakeStream wakes the notification stream, s.mx must be held.
+func (s *Server) wakeStream() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// nextStreamEvent returns the next queued stream error or notification, or if
+// there is none a channel that is closed when one is queued.
+func (s *Server) nextStreamEvent() (notify bool, wake <-chan struct{}, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	switch {
+	case len(s.streamErrs) > 0:
+		err = s.streamErrs[0]
+		s.streamErrs = s.streamErrs[1:]
+		return false, nil, err
+	case s.notifications > 0:
+		s.notifications--
+		return true, nil, nil
+	default:
+		return false, s.wake, nil
+	}
+}
+
+// CloseStream closes the current notification stream.
+func (s *Server) CloseStream() {
+	select {
+	case s.streamClose <- struct{}{}:
+	default:
+	}
+}
+
+// Requests returns all requests received by the server in order.
+func (s *Server) Requests() []Request {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ReportTaskProgressRequests returns all recorded ReportTaskProgress requests.
+func (s *Server) ReportTaskProgressRequests() []*agentendpointpb.ReportTaskProgressRequest {
+	var ret []*agentendpointpb.ReportTaskProgressRequest
+	for _, r := range s.Requests() {
+		if req, ok := r.Message.(*agentendpointpb.ReportTaskProgressRequest); ok {
+			ret = append(ret, req)
+		}
+	}
+	return ret
+}
+
+// ReportTaskCompleteRequests returns all recorded ReportTaskComplete requests.
+func (s *Server) ReportTaskCompleteRequests() []*agentendpointpb.ReportTaskCompleteRequest {
+	var ret []*agentendpointpb.ReportTaskCompleteRequest
+	for _, r := range s.Requests() {
+		if req, ok := r.Message.(*agentendpointpb.ReportTaskCompleteRequest); ok {
+			ret = append(ret, req)
+		}
+	}
+	return ret
+}
+
+// WaitForComplete waits for the next ReportTaskComplete request, returning
+// nil if none is received before timeout.
+func (s *Server) WaitForComplete(timeout time.Duration) *agentendpointpb.ReportTaskCompleteRequest {
+	select {
+	case req := <-s.complete:
+		return req
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// record records the request and returns any injected error for method.
+func (s *Server) record(method string, req proto.Message) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.requests = append(s.requests, Request{Method: method, Message: proto.Clone(req)})
+	if len(s.errs[method]) == 0 {
+		return nil
+	}
+	code := s.errs[method][0]
+	s.errs[method] = s.errs[method][1:]
+	return status.Errorf(code, "injected error")
+}
+
+// ReceiveTaskNotification implements AgentEndpointServiceServer.
+func (s *Server) ReceiveTaskNotification(req *agentendpointpb.ReceiveTaskNotificationRequest, srv agentendpointpb.AgentEndpointService_ReceiveTaskNotificationServer) error {
+	if err := s.record(ReceiveTaskNotification, req); err != nil {
+		return err
+	}
+	for {
+		notify, wake, err := s.nextStreamEvent()
+		switch {
+		case err != nil:
+			return err
+		case notify:
+			if err := srv.Send(&agentendpointpb.ReceiveTaskNotificationResponse{}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-srv.Context().Done():
+			return srv.Context().Err()
+		case <-s.streamClose:
+			return nil
+		case <-wake:
+		}
+	}
+}
+
+// StartNextTask implements AgentEndpointServiceServer.
+func (s *Server) StartNextTask(ctx context.Context, req *agentendpointpb.StartNextTaskRequest) (*agentendpointpb.StartNextTaskResponse, error) {
+	if err := s.record(StartNextTask, req); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if len(s.tasks) == 0 {
+		if s.closeStreamWhenDrained {
+			s.CloseStream()
+		}
+		return &agentendpointpb.StartNextTaskResponse{}, nil
+	}
+	task := s.tasks[0]
+	s.tasks = s.tasks[1:]
+	return &agentendpointpb.StartNextTaskResponse{Task: task}, nil
+}
+
+// ReportTaskProgress implements AgentEndpointServiceServer.
+func (s *Server) ReportTaskProgress(ctx context.Context, req *agentendpointpb.ReportTaskProgressRequest) (*agentendpointpb.ReportTaskProgressResponse, error) {
+	if err := s.record(ReportTaskProgress, req); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	directive, ok := s.directives[req.GetTaskId()]
+	if !ok {
+		directive = agentendpointpb.TaskDirective_CONTINUE
+	}
+	return &agentendpointpb.ReportTaskProgressResponse{TaskDirective: directive}, nil
+}
+
+// ReportTaskComplete implements AgentEndpointServiceServer.
+func (s *Server) ReportTaskComplete(ctx context.Context, req *agentendpointpb.ReportTaskCompleteRequest) (*agentendpointpb.ReportTaskCompleteResponse, error) {
+	if err := s.record(ReportTaskComplete, req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.complete <- req:
+	default:
+	}
+	return &agentendpointpb.ReportTaskCompleteResponse{}, nil
+}
+
+// LookupEffectiveGuestPolicy implements AgentEndpointServiceServer.
+func (s *Server) LookupEffectiveGuestPolicy(ctx context.Context, req *agentendpointpb.LookupEffectiveGuestPolicyRequest) (*agentendpointpb.EffectiveGuestPolicy, error) {
+	if err := s.record(LookupEffectiveGuestPolicy, req); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.policy == nil {
+		return &agentendpointpb.EffectiveGuestPolicy{}, nil
+	}
+	return s.policy, nil
+}
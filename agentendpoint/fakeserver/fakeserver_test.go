@@ -0,0 +1,199 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fakeserver
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func newTestClient(ctx context.Context, t *testing.T) (*Server, agentendpointpb.AgentEndpointServiceClient) {
+	srv := NewServer()
+	srv.Start()
+	conn, err := srv.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, agentendpointpb.NewAgentEndpointServiceClient(conn)
+}
+
+func TestStartNextTask(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(ctx, t)
+	defer srv.Stop()
+
+	srv.QueueTask(&agentendpointpb.Task{TaskId: "1"}, &agentendpointpb.Task{TaskId: "2"})
+
+	for _, want := range []string{"1", "2", ""} {
+		res, err := client.StartNextTask(ctx, &agentendpointpb.StartNextTaskRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.GetTask().GetTaskId(); got != want {
+			t.Errorf("unexpected task id, want: %q, got: %q", want, got)
+		}
+	}
+
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("expected 3 recorded requests, got %d", got)
+	}
+}
+
+func TestReportTaskProgress(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(ctx, t)
+	defer srv.Stop()
+
+	srv.SetTaskDirective("stop", agentendpointpb.TaskDirective_STOP)
+
+	tests := []struct {
+		id   string
+		want agentendpointpb.TaskDirective
+	}{
+		{"continue", agentendpointpb.TaskDirective_CONTINUE},
+		{"stop", agentendpointpb.TaskDirective_STOP},
+	}
+	for _, tt := range tests {
+		res, err := client.ReportTaskProgress(ctx, &agentendpointpb.ReportTaskProgressRequest{TaskId: tt.id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetTaskDirective() != tt.want {
+			t.Errorf("%s: unexpected directive, want: %s, got: %s", tt.id, tt.want, res.GetTaskDirective())
+		}
+	}
+
+	if got := len(srv.ReportTaskProgressRequests()); got != 2 {
+		t.Errorf("expected 2 ReportTaskProgress requests, got %d", got)
+	}
+}
+
+func TestInjectError(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(ctx, t)
+	defer srv.Stop()
+
+	srv.InjectError(ReportTaskComplete, codes.Unavailable)
+	srv.InjectError(ReportTaskComplete, codes.ResourceExhausted)
+
+	for _, want := range []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.OK} {
+		_, err := client.ReportTaskComplete(ctx, &agentendpointpb.ReportTaskCompleteRequest{TaskId: "foo"})
+		if got := status.Code(err); got != want {
+			t.Errorf("unexpected code, want: %s, got: %s", want, got)
+		}
+	}
+
+	if got := len(srv.ReportTaskCompleteRequests()); got != 3 {
+		t.Errorf("expected 3 ReportTaskComplete requests, got %d", got)
+	}
+	if req := srv.WaitForComplete(time.Second); req.GetTaskId() != "foo" {
+		t.Errorf("expected completed task foo, got: %v", req)
+	}
+}
+
+func TestStreamQueueDoesNotBlock(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(ctx, t)
+	defer srv.Stop()
+
+	// Nothing reads the stream yet, queueing must not block however many
+	// notifications and errors are queued.
+	const n = 100
+	for i := 0; i < n; i++ {
+		srv.Notify()
+	}
+	srv.InjectError(ReceiveTaskNotification, codes.Unavailable)
+	srv.InjectError(ReceiveTaskNotification, codes.PermissionDenied)
+
+	stream, err := client.ReceiveTaskNotification(ctx, &agentendpointpb.ReceiveTaskNotificationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Queued errors end the stream before notifications are sent.
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got: %v", err)
+	}
+	stream, err = client.ReceiveTaskNotification(ctx, &agentendpointpb.ReceiveTaskNotificationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got: %v", err)
+	}
+
+	stream, err = client.ReceiveTaskNotification(ctx, &agentendpointpb.ReceiveTaskNotificationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("unexpected error from Recv %d: %v", i, err)
+		}
+	}
+}
+
+func TestReceiveTaskNotification(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(ctx, t)
+	defer srv.Stop()
+
+	stream, err := client.ReceiveTaskNotification(ctx, &agentendpointpb.ReceiveTaskNotificationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Notify()
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("unexpected error from Recv: %v", err)
+	}
+	srv.CloseStream()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("expected io.EOF, got: %v", err)
+	}
+
+	stream, err = client.ReceiveTaskNotification(ctx, &agentendpointpb.ReceiveTaskNotificationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.InjectError(ReceiveTaskNotification, codes.PermissionDenied)
+	if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got: %v", err)
+	}
+}
+
+func TestLookupEffectiveGuestPolicy(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(ctx, t)
+	defer srv.Stop()
+
+	want := &agentendpointpb.EffectiveGuestPolicy{
+		Packages: []*agentendpointpb.EffectiveGuestPolicy_SourcedPackage{{Source: "foo"}},
+	}
+	srv.SetEffectiveGuestPolicy(want)
+
+	got, err := client.LookupEffectiveGuestPolicy(ctx, &agentendpointpb.LookupEffectiveGuestPolicyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetPackages()[0].GetSource() != "foo" {
+		t.Errorf("unexpected EffectiveGuestPolicy: %v", got)
+	}
+}
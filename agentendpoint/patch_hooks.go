@@ -0,0 +1,251 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/config"
+	"github.com/GoogleCloudPlatform/osconfig/interpreter"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+// hookPhase is a phase of patch hooks, the hooks of a phase are read from the
+// <phase>.d directory in config.PatchHooksDir.
+type hookPhase string
+
+const (
+	preHooks  hookPhase = "prepatch"
+	postHooks hookPhase = "postpatch"
+)
+
+var (
+	patchHooksDir  = config.PatchHooksDir
+	patchPreHooks  = config.PatchPreHooks
+	patchPostHooks = config.PatchPostHooks
+)
+
+// hookPhaseDone reports whether the hooks of phase already ran for this task.
+func (r *patchTask) hookPhaseDone(phase hookPhase) bool {
+	switch phase {
+	case preHooks:
+		return r.HookPhase == preHooks || r.HookPhase == postHooks
+	default:
+		return r.HookPhase == phase
+	}
+}
+
+// runHooks runs the local and GCS hooks of phase in order, stopping at the
+// first hook that fails. Once all hooks ran the phase is saved in the task
+// state so they are not run again when the task resumes after a reboot.
+func (r *patchTask) runHooks(ctx context.Context, phase hookPhase) error {
+	if r.hookPhaseDone(phase) {
+		return nil
+	}
+
+	if r.Task.GetDryRun() {
+		r.infof("Dry run - not running %s hooks", phase)
+	} else {
+		paths, err := localHooks(filepath.Join(patchHooksDir(), string(phase)+".d"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if err := r.runHook(ctx, phase, path); err != nil {
+				return err
+			}
+		}
+
+		urls := patchPreHooks()
+		if phase == postHooks {
+			urls = patchPostHooks()
+		}
+		for _, u := range urls {
+			if err := r.runGCSHook(ctx, phase, u); err != nil {
+				return err
+			}
+		}
+	}
+
+	r.HookPhase = phase
+	if err := r.saveState(); err != nil {
+		return fmt.Errorf("error saving state: %v", err)
+	}
+	return nil
+}
+
+// localHooks returns the hooks in dir sorted by name. Hidden files,
+// directories and, on Linux, files that are not executable are skipped.
+func localHooks(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading hooks directory: %v", err)
+	}
+
+	var paths []string
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		if goos != "windows" && fi.Mode()&0111 == 0 {
+			logger.Debugf("Skipping hook %q, it is not executable", fi.Name())
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, fi.Name()))
+	}
+	return paths, nil
+}
+
+// parseGCSURL parses a gs://bucket/object[#generation] url.
+func parseGCSURL(u string) (*agentendpointpb.GcsObject, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	object := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Scheme != "gs" || parsed.Host == "" || object == "" {
+		return nil, fmt.Errorf("%q is not a gs://bucket/object url", u)
+	}
+
+	obj := &agentendpointpb.GcsObject{Bucket: parsed.Host, Object: object}
+	if parsed.Fragment != "" {
+		if obj.GenerationNumber, err = strconv.ParseInt(parsed.Fragment, 10, 64); err != nil {
+			return nil, fmt.Errorf("%q has an invalid generation number: %v", u, err)
+		}
+	}
+	return obj, nil
+}
+
+func (r *patchTask) runGCSHook(ctx context.Context, phase hookPhase, u string) error {
+	obj, err := parseGCSURL(u)
+	if err != nil {
+		return fmt.Errorf("invalid %s hook: %v", phase, err)
+	}
+	path, err := getGCSObject(ctx, obj, r.LogLabels)
+	if err != nil {
+		return fmt.Errorf("error downloading %s hook %q: %v", phase, u, err)
+	}
+	defer func() {
+		if err := os.Remove(path); err != nil {
+			r.errorf("Error removing downloaded hook %s: %v", path, err)
+		}
+	}()
+	return r.runHook(ctx, phase, path)
+}
+
+// setupHookCommand applies the exec step environment, working directory and
+// umask to the hook command. Hooks are admin scripts, they run as the agent
+// user and not as the exec step user. Without a configured working directory
+// the hook runs in the directory it is in.
+func (r *patchTask) setupHookCommand(cmd *exec.Cmd, phase hookPhase, path string) error {
+	opts := execEnvOptions()
+	opts.User, opts.Group = "", ""
+	opts.Env = append(opts.Env, "OSCONFIG_TASK_ID="+r.TaskID, "OSCONFIG_PATCH_PHASE="+string(phase))
+	if opts.Dir == "" {
+		opts.Dir = filepath.Dir(path)
+	} else if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating working directory: %v", err)
+	}
+	return opts.Apply(cmd)
+}
+
+// hookCommand returns the command used to run the hook at path. On Windows
+// the command is chosen by file extension, elsewhere the hook is run with its
+// shebang interpreter.
+func hookCommand(path string) (string, []string, error) {
+	if goos != "windows" {
+		return interpreter.Command(interpreter.Default, path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ps1":
+		return winPowershell, append(append([]string(nil), winPowershellArgs...), "-File", path), nil
+	case ".cmd", ".bat":
+		return winCmd, []string{"/c", path}, nil
+	case ".exe":
+		return path, nil, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported hook file type %q", filepath.Ext(path))
+	}
+}
+
+func (r *patchTask) hookLogFile() string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(r.TaskID)
+	return filepath.Join(taskLogDir, fmt.Sprintf("patch_%s_hooks.log", name))
+}
+
+// runHook runs a single hook, it fails if the hook exits non zero or runs
+// longer than the exec step timeout. The hook output is appended to the hook
+// log file of the task.
+func (r *patchTask) runHook(ctx context.Context, phase hookPhase, path string) error {
+	name := filepath.Base(path)
+	c, args, err := hookCommand(path)
+	if err != nil {
+		return fmt.Errorf("%s hook %q: %v", phase, name, err)
+	}
+
+	out := newRingBuffer(execOutputBufferSize)
+	w := io.Writer(out)
+	if err := os.MkdirAll(taskLogDir, 0755); err != nil {
+		r.errorf("Error creating task log directory: %v", err)
+	} else if f, err := os.OpenFile(r.hookLogFile(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		r.errorf("Error creating hook log file: %v", err)
+	} else {
+		defer f.Close()
+		fmt.Fprintf(f, "==> %s hook %s\n", phase, path)
+		w = io.MultiWriter(out, &lockedWriter{w: f})
+	}
+
+	if timeout := execStepTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.Command(c, args...)
+	if err := r.setupHookCommand(cmd, phase, path); err != nil {
+		return fmt.Errorf("%s hook %q: %v", phase, name, err)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	r.infof("Running %s hook %q.", phase, path)
+	err = run(ctx, cmd)
+	tail, _ := out.Tail(execOutputReportSize)
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("%s hook %q timed out, output:\n%s", phase, name, tail)
+	case err == nil:
+		r.debugf("%s hook %q output:\n%s", phase, name, tail)
+		return nil
+	case cmd.ProcessState != nil:
+		return fmt.Errorf("%s hook %q exited with code %d, output:\n%s", phase, name, cmd.ProcessState.ExitCode(), tail)
+	default:
+		return fmt.Errorf("error running %s hook %q: %v", phase, name, err)
+	}
+}
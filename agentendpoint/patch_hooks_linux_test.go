@@ -0,0 +1,173 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/execenv"
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestRunHooks(t *testing.T) {
+	ctx := context.Background()
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+	patchPreHooks = func() []string { return nil }
+	patchPostHooks = func() []string { return nil }
+	run = runWithContext
+	goos = "linux"
+
+	hookDir := filepath.Join(td, "prepatch.d")
+	if err := os.MkdirAll(hookDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(td, "out")
+	hooks := map[string]string{
+		"10-first":  "#!/bin/sh\necho first $OSCONFIG_PATCH_PHASE $OSCONFIG_TASK_ID >> " + out + "\n",
+		"20-second": "#!/bin/sh\necho second >> " + out + "\n",
+	}
+	for name, script := range hooks {
+		if err := ioutil.WriteFile(filepath.Join(hookDir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not executable, should be skipped.
+	if err := ioutil.WriteFile(filepath.Join(hookDir, "30-skipped"), []byte("#!/bin/sh\nexit 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &patchTask{TaskID: "foo", Task: &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{}}}
+	if err := r.runHooks(ctx, preHooks); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first prepatch foo\nsecond\n"; string(got) != want {
+		t.Errorf("unexpected hook output, want %q, got %q", want, got)
+	}
+	if r.HookPhase != preHooks {
+		t.Errorf("want HookPhase %q, got %q", preHooks, r.HookPhase)
+	}
+	st, err := loadState(taskStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.PatchTask.HookPhase != preHooks {
+		t.Errorf("want saved HookPhase %q, got %q", preHooks, st.PatchTask.HookPhase)
+	}
+
+	// The phase is done so hooks are not run again.
+	if err := r.runHooks(ctx, preHooks); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := ioutil.ReadFile(out); string(got) != "first prepatch foo\nsecond\n" {
+		t.Errorf("hooks were run again: %q", got)
+	}
+
+	// A failing hook fails the phase.
+	hookDir = filepath.Join(td, "postpatch.d")
+	if err := os.MkdirAll(hookDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(hookDir, "fail"), []byte("#!/bin/sh\necho unhealthy\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = r.runHooks(ctx, postHooks)
+	if err == nil {
+		t.Fatal("expected error from failing hook")
+	}
+	if !strings.Contains(err.Error(), "exited with code 3") || !strings.Contains(err.Error(), "unhealthy") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if r.HookPhase != preHooks {
+		t.Errorf("want HookPhase %q, got %q", preHooks, r.HookPhase)
+	}
+}
+
+func TestRunHookEnvironment(t *testing.T) {
+	ctx := context.Background()
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskLogDir = td
+	goos = "linux"
+	defer func() { execEnvOptions = execenv.FromConfig }()
+
+	hook := filepath.Join(td, "hooks", "10-hook")
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(hook, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := filepath.Join(td, "work")
+	tests := []struct {
+		name    string
+		opts    execenv.Options
+		wantDir string
+	}{
+		{"WorkingDir", execenv.Options{EnvAllowlist: []string{}, Env: []string{"FOO=bar"}, Dir: workDir, Umask: -1}, workDir},
+		{"HookDir", execenv.Options{EnvAllowlist: []string{}, Env: []string{"FOO=bar"}, Umask: -1}, filepath.Dir(hook)},
+		{"ExecUser", execenv.Options{User: "nobody", Group: "nogroup", EnvAllowlist: []string{}, Env: []string{"FOO=bar"}, Umask: -1}, filepath.Dir(hook)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execEnvOptions = func() execenv.Options { return tt.opts }
+			var gotEnv []string
+			var gotDir string
+			run = func(_ context.Context, cmd *exec.Cmd) error {
+				gotEnv = cmd.Env
+				gotDir = cmd.Dir
+				if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+					t.Errorf("hooks should run as the agent user, got credential %+v", cmd.SysProcAttr.Credential)
+				}
+				if _, err := os.Stat(cmd.Dir); err != nil {
+					t.Errorf("working directory does not exist: %v", err)
+				}
+				return nil
+			}
+
+			r := &patchTask{TaskID: "foo", Task: &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{}}}
+			if err := r.runHook(ctx, preHooks, hook); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := []string{"FOO=bar", "OSCONFIG_TASK_ID=foo", "OSCONFIG_PATCH_PHASE=prepatch"}; !reflect.DeepEqual(gotEnv, want) {
+				t.Errorf("unexpected env, want: %q, got: %q", want, gotEnv)
+			}
+			if gotDir != tt.wantDir {
+				t.Errorf("unexpected working directory, want: %q, got: %q", tt.wantDir, gotDir)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestParseGCSURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    *agentendpointpb.GcsObject
+		wantErr bool
+	}{
+		{"gs://bucket/object.sh", &agentendpointpb.GcsObject{Bucket: "bucket", Object: "object.sh"}, false},
+		{"gs://bucket/dir/object.sh#123", &agentendpointpb.GcsObject{Bucket: "bucket", Object: "dir/object.sh", GenerationNumber: 123}, false},
+		{"gs://bucket/object.sh#foo", nil, true},
+		{"gs://bucket", nil, true},
+		{"https://bucket/object.sh", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseGCSURL(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error: %v", tt.url, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("%s: GcsObject does not match expectation: (-got +want)\n%s", tt.url, diff)
+		}
+	}
+}
+
+func TestHookPhaseDone(t *testing.T) {
+	tests := []struct {
+		last     hookPhase
+		phase    hookPhase
+		wantDone bool
+	}{
+		{"", preHooks, false},
+		{"", postHooks, false},
+		{preHooks, preHooks, true},
+		{preHooks, postHooks, false},
+		{postHooks, preHooks, true},
+		{postHooks, postHooks, true},
+	}
+	for _, tt := range tests {
+		r := &patchTask{HookPhase: tt.last}
+		if got := r.hookPhaseDone(tt.phase); got != tt.wantDone {
+			t.Errorf("HookPhase %q: hookPhaseDone(%q) = %t, want %t", tt.last, tt.phase, got, tt.wantDone)
+		}
+	}
+}
@@ -31,45 +31,129 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 	const retryPeriod = 3 * time.Minute
 	// Check for both apt-get and dpkg-query to give us a clean signal.
 	if packages.AptExists && packages.DpkgQueryExists {
+		apt := r.Task.GetPatchConfig().GetApt()
+		aptFilter := len(apt.GetExcludes()) > 0 || len(apt.GetExclusivePackages()) > 0
 		opts := []ospatch.AptGetUpgradeOption{
 			ospatch.AptGetDryRun(r.Task.GetDryRun()),
+			ospatch.AptGetExcludes(apt.GetExcludes()),
+			ospatch.AptGetExclusivePackages(apt.GetExclusivePackages()),
+			ospatch.AptGetNeverPatch(neverPatch()),
+			ospatch.AptGetSecurityOnly(r.aptSecurityOnly(aptFilter)),
+			ospatch.AptGetAdvisories(r.agentAdvisories("APT", aptFilter)),
 		}
-		switch r.Task.GetPatchConfig().GetApt().GetType() {
+		switch apt.GetType() {
 		case agentendpointpb.AptSettings_DIST:
 			opts = append(opts, ospatch.AptGetUpgradeType(packages.AptGetDistUpgrade))
 		}
 		r.debugf("Installing APT package updates.")
-		if err := retryFunc(retryPeriod, "installing APT package updates", func() error { return ospatch.RunAptGetUpgrade(opts...) }); err != nil {
+		var res *ospatch.Result
+		if err := retryFunc(retryPeriod, "installing APT package updates", func() (err error) {
+			res, err = ospatch.RunAptGetUpgrade(opts...)
+			return err
+		}); err != nil {
 			errs = append(errs, err.Error())
 		}
+		r.addResult(res)
 	}
-	if packages.YumExists && packages.RPMQueryExists {
+	// On EL8 and later yum is an alias of dnf, use dnf directly when it is
+	// installed. dnf uses the yum patch settings.
+	yum := r.Task.GetPatchConfig().GetYum()
+	yumFilter := yum.GetSecurity() || yum.GetMinimal() || len(yum.GetExcludes()) > 0 || len(yum.GetExclusivePackages()) > 0
+	if packages.DnfExists && packages.RPMQueryExists {
+		opts := []ospatch.DnfUpdateOption{
+			ospatch.DnfUpdateSecurity(yum.GetSecurity()),
+			ospatch.DnfUpdateMinimal(yum.GetMinimal()),
+			ospatch.DnfUpdateExcludes(yum.GetExcludes()),
+			ospatch.DnfExclusivePackages(yum.GetExclusivePackages()),
+			ospatch.DnfUpdateNeverPatch(neverPatch()),
+			ospatch.DnfUpdateAdvisories(r.agentAdvisories("DNF", yumFilter)),
+			ospatch.DnfDryRun(r.Task.GetDryRun()),
+		}
+		r.debugf("Installing DNF package updates.")
+		var res *ospatch.Result
+		if err := retryFunc(retryPeriod, "installing DNF package updates", func() (err error) {
+			res, err = ospatch.RunDnfUpdate(opts...)
+			return err
+		}); err != nil {
+			errs = append(errs, err.Error())
+		}
+		r.addResult(res)
+	} else if packages.YumExists && packages.RPMQueryExists {
 		opts := []ospatch.YumUpdateOption{
-			ospatch.YumUpdateSecurity(r.Task.GetPatchConfig().GetYum().GetSecurity()),
-			ospatch.YumUpdateMinimal(r.Task.GetPatchConfig().GetYum().GetMinimal()),
-			ospatch.YumUpdateExcludes(r.Task.GetPatchConfig().GetYum().GetExcludes()),
+			ospatch.YumUpdateSecurity(yum.GetSecurity()),
+			ospatch.YumUpdateMinimal(yum.GetMinimal()),
+			ospatch.YumUpdateExcludes(yum.GetExcludes()),
+			ospatch.YumExclusivePackages(yum.GetExclusivePackages()),
+			ospatch.YumUpdateNeverPatch(neverPatch()),
+			ospatch.YumUpdateAdvisories(r.agentAdvisories("YUM", yumFilter)),
 			ospatch.YumDryRun(r.Task.GetDryRun()),
 		}
 		r.debugf("Installing YUM package updates.")
-		if err := retryFunc(retryPeriod, "installing YUM package updates", func() error { return ospatch.RunYumUpdate(opts...) }); err != nil {
+		var res *ospatch.Result
+		if err := retryFunc(retryPeriod, "installing YUM package updates", func() (err error) {
+			res, err = ospatch.RunYumUpdate(opts...)
+			return err
+		}); err != nil {
 			errs = append(errs, err.Error())
 		}
+		r.addResult(res)
 	}
 	if packages.ZypperExists && packages.RPMQueryExists {
+		zypper := r.Task.GetPatchConfig().GetZypper()
+		zypperFilter := len(zypper.GetCategories()) > 0 || len(zypper.GetSeverities()) > 0 || len(zypper.GetExcludes()) > 0 || len(zypper.GetExclusivePatches()) > 0
 		opts := []ospatch.ZypperPatchOption{
-			ospatch.ZypperPatchCategories(r.Task.GetPatchConfig().GetZypper().GetCategories()),
-			ospatch.ZypperPatchSeverities(r.Task.GetPatchConfig().GetZypper().GetSeverities()),
-			ospatch.ZypperUpdateWithUpdate(r.Task.GetPatchConfig().GetZypper().GetWithUpdate()),
-			ospatch.ZypperUpdateWithOptional(r.Task.GetPatchConfig().GetZypper().GetWithOptional()),
+			ospatch.ZypperPatchCategories(zypper.GetCategories()),
+			ospatch.ZypperPatchSeverities(zypper.GetSeverities()),
+			ospatch.ZypperUpdateWithUpdate(zypper.GetWithUpdate()),
+			ospatch.ZypperUpdateWithOptional(zypper.GetWithOptional()),
+			ospatch.ZypperUpdateWithExcludes(zypper.GetExcludes()),
+			ospatch.ZypperUpdateWithExclusivePatches(zypper.GetExclusivePatches()),
+			ospatch.ZypperUpdateNeverPatch(neverPatch()),
+			ospatch.ZypperPatchAdvisories(r.agentAdvisories("Zypper", zypperFilter)),
 			ospatch.ZypperUpdateDryrun(r.Task.GetDryRun()),
 		}
 		r.debugf("Installing Zypper updates.")
-		if err := retryFunc(retryPeriod, "installing Zypper updates", func() error { return ospatch.RunZypperPatch(opts...) }); err != nil {
+		var res *ospatch.Result
+		if err := retryFunc(retryPeriod, "installing Zypper updates", func() (err error) {
+			res, err = ospatch.RunZypperPatch(opts...)
+			return err
+		}); err != nil {
 			errs = append(errs, err.Error())
 		}
+		r.addResult(res)
 	}
 	if errs == nil {
 		return nil
 	}
 	return errors.New(strings.Join(errs, ",\n"))
 }
+
+// aptSecurityOnly returns the agent wide osconfig-patch-apt-security setting.
+// It is ignored when the patch job filters the APT packages itself.
+func (r *patchTask) aptSecurityOnly(jobFilter bool) bool {
+	if !patchAptSecurity() {
+		return false
+	}
+	if jobFilter {
+		r.infof("Ignoring osconfig-patch-apt-security, the patch job sets its own APT package filter.")
+		return false
+	}
+	r.infof("Only installing APT updates from security pockets, osconfig-patch-apt-security is set.")
+	return true
+}
+
+// agentAdvisories returns the agent wide osconfig-patch-advisories setting for
+// package manager pm. It is ignored when the patch job filters the updates of
+// pm itself.
+func (r *patchTask) agentAdvisories(pm string, jobFilter bool) []string {
+	ids := patchAdvisories()
+	if len(ids) == 0 {
+		return nil
+	}
+	if jobFilter {
+		r.infof("Ignoring osconfig-patch-advisories for %s, the patch job sets its own filter.", pm)
+		return nil
+	}
+	r.infof("Only installing %s updates for advisories %s from osconfig-patch-advisories.", pm, strings.Join(ids, ", "))
+	return ids
+}
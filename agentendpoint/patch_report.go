@@ -0,0 +1,98 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+)
+
+// patchReport is the local record of what a patch task did, ApplyPatchesTaskOutput
+// only carries the final state so this is written to the task log directory.
+type patchReport struct {
+	TaskID       string
+	StartedAt    time.Time
+	UpdatedAt    time.Time
+	State        string `json:",omitempty"`
+	ErrorMessage string `json:",omitempty"`
+	DryRun       bool   `json:",omitempty"`
+	RebootCount  int
+	Results      []*ospatch.Result `json:",omitempty"`
+	// RestartedServices are the units restarted instead of rebooting.
+	RestartedServices []string `json:",omitempty"`
+}
+
+func (r *patchTask) reportFile() string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(r.TaskID)
+	return filepath.Join(taskLogDir, fmt.Sprintf("patch_%s_report.json", name))
+}
+
+// addResult records the result of a patch run, logs it and updates the
+// report file.
+func (r *patchTask) addResult(res *ospatch.Result) {
+	if res == nil {
+		return
+	}
+	r.infof("Patch results %s.", res)
+	for _, p := range res.Packages {
+		r.debugf("%s package %s %s: %s -> %s %s", res.PackageManager, p.Name, p.Status, p.OldVersion, p.NewVersion, p.Reason)
+	}
+	for _, p := range res.Patches {
+		r.debugf("%s patch %s %s %s", res.PackageManager, p.Name, p.Status, p.Reason)
+	}
+
+	r.Results = append(r.Results, res)
+	if err := r.saveState(); err != nil {
+		r.errorf("Error saving state: %v", err)
+	}
+	r.writeReport("", "")
+}
+
+// writeReport writes the patch report file of the task, state and errMsg are
+// set once the task completes.
+func (r *patchTask) writeReport(state, errMsg string) {
+	report := patchReport{
+		TaskID:            r.TaskID,
+		StartedAt:         r.StartedAt,
+		UpdatedAt:         time.Now(),
+		State:             state,
+		ErrorMessage:      errMsg,
+		RebootCount:       r.RebootCount,
+		Results:           r.Results,
+		RestartedServices: r.RestartedServices,
+	}
+	if r.Task != nil {
+		report.DryRun = r.Task.GetDryRun()
+	}
+	d, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		r.errorf("Error marshalling patch report: %v", err)
+		return
+	}
+	if err := os.MkdirAll(taskLogDir, 0755); err != nil {
+		r.errorf("Error creating task log directory: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(r.reportFile(), d, 0644); err != nil {
+		r.errorf("Error writing patch report: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"strings"
+)
+
+// restartServices restarts the services using files replaced by patching
+// instead of rebooting. It returns false if the system should be rebooted
+// anyway, because the kernel or init changed, no service explains why a
+// reboot is required or a restart failed.
+func (r *patchTask) restartServices() bool {
+	s, err := servicesToRestart()
+	if err != nil {
+		r.errorf("Error finding services to restart, rebooting instead: %v", err)
+		return false
+	}
+	if s.RebootReason != "" {
+		r.infof("Rebooting instead of restarting services: %s.", s.RebootReason)
+		return false
+	}
+	if len(s.Skipped) > 0 {
+		r.infof("Not restarting services %s, they use replaced files until the next reboot.", strings.Join(s.Skipped, ", "))
+	}
+	if len(s.Units) == 0 {
+		r.infof("No services use replaced files, rebooting as the system requires it.")
+		return false
+	}
+
+	if r.Task.GetDryRun() {
+		r.infof("Dry run - not restarting services %s.", strings.Join(s.Units, ", "))
+		return true
+	}
+
+	var failed []string
+	for _, unit := range s.Units {
+		r.infof("Restarting service %s.", unit)
+		if err := restartService(unit); err != nil {
+			r.errorf("%v", err)
+			failed = append(failed, unit)
+			continue
+		}
+		r.RestartedServices = append(r.RestartedServices, unit)
+	}
+	if err := r.saveState(); err != nil {
+		r.errorf("Error saving state: %v", err)
+	}
+	r.writeReport("", "")
+
+	if len(failed) > 0 {
+		r.infof("Rebooting because services %s failed to restart.", strings.Join(failed, ", "))
+		return false
+	}
+	return true
+}
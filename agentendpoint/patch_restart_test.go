@@ -0,0 +1,115 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestPatchTaskRestartServices(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+
+	oldPolicy, oldServices, oldRestart, oldMax := patchRestartServices, servicesToRestart, restartService, maxRebootCount
+	defer func() {
+		patchRestartServices, servicesToRestart, restartService, maxRebootCount = oldPolicy, oldServices, oldRestart, oldMax
+	}()
+	systemRebootRequired = func() (bool, string, error) { return true, "libraries updated", nil }
+	// Any reboot fails with the reboot count error instead of rebooting.
+	maxRebootCount = func() int { return 0 }
+
+	tests := []struct {
+		name          string
+		policy        bool
+		rebootConfig  agentendpointpb.PatchConfig_RebootConfig
+		restarts      *ospatch.ServiceRestarts
+		restartErr    error
+		wantReboot    bool
+		wantRestarted []string
+	}{
+		{"PolicyDisabled", false, agentendpointpb.PatchConfig_DEFAULT, &ospatch.ServiceRestarts{Units: []string{"sshd.service"}}, nil, true, nil},
+		{"Restart", true, agentendpointpb.PatchConfig_DEFAULT, &ospatch.ServiceRestarts{Units: []string{"cron.service", "sshd.service"}, Skipped: []string{"dbus.service"}}, nil, false, []string{"cron.service", "sshd.service"}},
+		{"NothingToRestart", true, agentendpointpb.PatchConfig_DEFAULT, &ospatch.ServiceRestarts{}, nil, true, nil},
+		{"KernelChanged", true, agentendpointpb.PatchConfig_DEFAULT, &ospatch.ServiceRestarts{Units: []string{"sshd.service"}, RebootReason: "kernel packages updated"}, nil, true, nil},
+		{"RestartFailed", true, agentendpointpb.PatchConfig_DEFAULT, &ospatch.ServiceRestarts{Units: []string{"sshd.service"}}, errors.New("failed"), true, nil},
+		{"Always", true, agentendpointpb.PatchConfig_ALWAYS, &ospatch.ServiceRestarts{Units: []string{"sshd.service"}}, nil, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patchRestartServices = func() bool { return tt.policy }
+			servicesToRestart = func() (*ospatch.ServiceRestarts, error) { return tt.restarts, nil }
+			restartService = func(string) error { return tt.restartErr }
+
+			r := &patchTask{
+				client:    tc.client,
+				TaskID:    tt.name,
+				Task:      &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{RebootConfig: tt.rebootConfig}}},
+				PatchStep: patching,
+			}
+			err := r.postPatchReboot(ctx)
+			if gotReboot := err != nil; gotReboot != tt.wantReboot {
+				t.Errorf("want reboot %t, got error %v", tt.wantReboot, err)
+			}
+			if !reflect.DeepEqual(r.RestartedServices, tt.wantRestarted) {
+				t.Errorf("want restarted services %q, got %q", tt.wantRestarted, r.RestartedServices)
+			}
+		})
+	}
+
+	t.Run("PrePatch", func(t *testing.T) {
+		patchRestartServices = func() bool { return true }
+		servicesToRestart = func() (*ospatch.ServiceRestarts, error) {
+			return &ospatch.ServiceRestarts{Units: []string{"sshd.service"}}, nil
+		}
+		restartService = func(string) error { return nil }
+
+		r := &patchTask{
+			client:    tc.client,
+			TaskID:    "PrePatch",
+			Task:      &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{}}},
+			PatchStep: patching,
+		}
+		if err := r.prePatchReboot(ctx); err == nil {
+			t.Error("want reboot before patching")
+		}
+		if r.RestartedServices != nil {
+			t.Errorf("services should not be restarted before patching, got %q", r.RestartedServices)
+		}
+	})
+}
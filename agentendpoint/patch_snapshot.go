@@ -0,0 +1,198 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+)
+
+// maxSnapshots is the number of patch snapshots kept, older ones are removed
+// when a new one is taken.
+const maxSnapshots = 10
+
+var (
+	takeSnapshot = ospatch.TakeSnapshot
+	rollback     = ospatch.Rollback
+)
+
+// snapshotDir is where pre-patch snapshots are stored, next to the task
+// state file.
+func snapshotDir() string {
+	return filepath.Join(filepath.Dir(taskStateFile), "patch_snapshots")
+}
+
+func snapshotFile(taskID string) string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(taskID)
+	return filepath.Join(snapshotDir(), name+".json")
+}
+
+// snapshot records the installed packages before patching, it is only taken
+// once per task so resuming after a reboot keeps the original state. Errors
+// are logged, a missing snapshot does not stop patching.
+func (r *patchTask) snapshot() {
+	if r.Task.GetDryRun() {
+		return
+	}
+	path := snapshotFile(r.TaskID)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	r.infof("Recording installed packages before patching.")
+	s, err := takeSnapshot()
+	if err != nil {
+		r.errorf("Error recording installed packages, the patch run can not be rolled back: %v", err)
+		return
+	}
+	d, err := json.Marshal(s)
+	if err != nil {
+		r.errorf("Error marshalling package snapshot: %v", err)
+		return
+	}
+	if err := os.MkdirAll(snapshotDir(), 0755); err != nil {
+		r.errorf("Error creating snapshot directory: %v", err)
+		return
+	}
+	if err := writeFile(path, d); err != nil {
+		r.errorf("Error writing package snapshot: %v", err)
+		return
+	}
+	r.debugf("Package snapshot written to %s.", path)
+	pruneSnapshots()
+}
+
+// snapshotsByAge returns the snapshot files, newest first.
+func snapshotsByAge() ([]os.FileInfo, error) {
+	fis, err := ioutil.ReadDir(snapshotDir())
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []os.FileInfo
+	for _, fi := range fis {
+		if !fi.IsDir() && filepath.Ext(fi.Name()) == ".json" {
+			snapshots = append(snapshots, fi)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ModTime().After(snapshots[j].ModTime()) })
+	return snapshots, nil
+}
+
+func pruneSnapshots() {
+	snapshots, err := snapshotsByAge()
+	if err != nil || len(snapshots) <= maxSnapshots {
+		return
+	}
+	for _, fi := range snapshots[maxSnapshots:] {
+		if err := os.Remove(filepath.Join(snapshotDir(), fi.Name())); err != nil {
+			logger.Warningf("Error removing old package snapshot: %v", err)
+		}
+	}
+}
+
+func readSnapshot(path string) (*ospatch.Snapshot, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading package snapshot: %v", err)
+	}
+	var s ospatch.Snapshot
+	if err := json.Unmarshal(d, &s); err != nil {
+		return nil, fmt.Errorf("error parsing package snapshot %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// latestSnapshot returns the task ID and snapshot with the newest Time. File
+// modification times change when the files are copied or restored from a
+// backup so they are not used.
+func latestSnapshot() (string, *ospatch.Snapshot, error) {
+	snapshots, err := snapshotsByAge()
+	if err != nil || len(snapshots) == 0 {
+		return "", nil, fmt.Errorf("no package snapshot found in %s", snapshotDir())
+	}
+	var taskID string
+	var latest *ospatch.Snapshot
+	for _, fi := range snapshots {
+		s, err := readSnapshot(filepath.Join(snapshotDir(), fi.Name()))
+		if err != nil {
+			logger.Warningf("Skipping package snapshot: %v", err)
+			continue
+		}
+		if latest == nil || s.Time.After(latest.Time) {
+			taskID, latest = strings.TrimSuffix(fi.Name(), ".json"), s
+		}
+	}
+	if latest == nil {
+		return "", nil, fmt.Errorf("no readable package snapshot found in %s", snapshotDir())
+	}
+	return taskID, latest, nil
+}
+
+// RollbackPatchTask restores the packages recorded before the patch task
+// taskID ran, the most recently snapshotted patch task if taskID is empty.
+// The result is written to the task log directory, it returns an error if any
+// package could not be restored.
+func RollbackPatchTask(taskID string) error {
+	var s *ospatch.Snapshot
+	var err error
+	if taskID == "" {
+		taskID, s, err = latestSnapshot()
+	} else {
+		s, err = readSnapshot(snapshotFile(taskID))
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Rolling back patch task %q to the packages installed at %s.", taskID, s.Time)
+	res, err := rollback(s)
+	if err != nil {
+		return err
+	}
+
+	d, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(taskLogDir, 0755); err != nil {
+		return fmt.Errorf("error creating task log directory: %v", err)
+	}
+	reportFile := filepath.Join(taskLogDir, fmt.Sprintf("patch_%s_rollback.json", taskID))
+	if err := ioutil.WriteFile(reportFile, d, 0644); err != nil {
+		return fmt.Errorf("error writing rollback report: %v", err)
+	}
+
+	var failed []string
+	for _, p := range res.Packages {
+		if p.Status == ospatch.PackageFailed {
+			logger.Errorf("Could not restore package %s: %s", p.Name, p.Reason)
+			failed = append(failed, p.Name)
+		}
+	}
+	logger.Infof("Rollback results %s, report written to %s.", res, reportFile)
+	if len(failed) > 0 {
+		return errors.New("could not restore packages: " + strings.Join(failed, ", "))
+	}
+	return nil
+}
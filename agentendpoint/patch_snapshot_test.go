@@ -0,0 +1,138 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestPatchTaskSnapshotAndRollback(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	oldTake, oldRollback := takeSnapshot, rollback
+	defer func() { takeSnapshot, rollback = oldTake, oldRollback }()
+	var taken int
+	takeSnapshot = func() (*ospatch.Snapshot, error) {
+		taken++
+		return &ospatch.Snapshot{Time: time.Now(), Packages: packages.Packages{Deb: []packages.PkgInfo{{Name: "curl", Arch: "x86_64", Version: "7.64-1"}}}}, nil
+	}
+
+	newTask := func(id string, dryRun bool) *patchTask {
+		return &patchTask{TaskID: id, Task: &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{DryRun: dryRun}}}
+	}
+	newTask("first", false).snapshot()
+	// A resumed task keeps its original snapshot.
+	newTask("first", false).snapshot()
+	newTask("dryrun", true).snapshot()
+	if taken != 1 {
+		t.Errorf("want 1 snapshot, got %d", taken)
+	}
+	if _, err := os.Stat(snapshotFile("dryrun")); !os.IsNotExist(err) {
+		t.Errorf("dry run should not write a snapshot: %v", err)
+	}
+
+	var got *ospatch.Snapshot
+	rollback = func(s *ospatch.Snapshot) (*ospatch.Result, error) {
+		got = s
+		return &ospatch.Result{PackageManager: "apt", Packages: []ospatch.PackageResult{
+			{Name: "curl", NewVersion: "7.64-1", Status: ospatch.PackageUpdated},
+			{Name: "openssl", NewVersion: "1.1.1c-1", Status: ospatch.PackageFailed, Reason: "version 1.1.1c-1 was not restored"},
+		}}, nil
+	}
+	// An empty task ID rolls back the most recent task.
+	err = RollbackPatchTask("")
+	if err == nil || !strings.Contains(err.Error(), "openssl") {
+		t.Errorf("want an error listing openssl, got %v", err)
+	}
+	if got == nil || len(got.Packages.Deb) != 1 || got.Packages.Deb[0].Name != "curl" {
+		t.Errorf("rollback called with unexpected snapshot: %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(td, "patch_first_rollback.json")); err != nil {
+		t.Errorf("rollback report not written: %v", err)
+	}
+
+	if err := RollbackPatchTask("unknown"); err == nil {
+		t.Error("want an error for a task without a snapshot")
+	}
+}
+
+func TestRollbackPatchTaskLatest(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	defer func(stateFile, logDir string) { taskStateFile, taskLogDir = stateFile, logDir }(taskStateFile, taskLogDir)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+
+	oldRollback := rollback
+	defer func() { rollback = oldRollback }()
+	var got *ospatch.Snapshot
+	rollback = func(s *ospatch.Snapshot) (*ospatch.Result, error) {
+		got = s
+		return &ospatch.Result{PackageManager: "apt"}, nil
+	}
+
+	if err := os.MkdirAll(snapshotDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// The file of the older snapshot is the most recently modified, as after
+	// restoring the snapshot directory from a backup.
+	for i, id := range []string{"newer", "older", "broken"} {
+		d, err := json.Marshal(&ospatch.Snapshot{Time: now.Add(-time.Duration(i) * time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == "broken" {
+			d = []byte("{")
+		}
+		if err := ioutil.WriteFile(snapshotFile(id), d, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mod := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(snapshotFile(id), mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RollbackPatchTask(""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got == nil || !got.Time.Equal(now) {
+		t.Errorf("want the snapshot taken at %s rolled back, got %+v", now, got)
+	}
+	if _, err := os.Stat(filepath.Join(td, "patch_newer_rollback.json")); err != nil {
+		t.Errorf("rollback report not written for the newest snapshot: %v", err)
+	}
+}
@@ -28,9 +28,18 @@ import (
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
-func systemRebootRequired() (bool, error) {
-	return ospatch.SystemRebootRequired()
-}
+var (
+	systemRebootRequired = ospatch.SystemRebootRequired
+	maxRebootCount       = config.MaxRebootCount
+	maxPatchAttempts     = config.MaxPatchAttempts
+	patchResumeBackoff   = func(attempt int) time.Duration { return retrySleep(attempt, 5) }
+	neverPatch           = config.NeverPatch
+	patchAptSecurity     = config.PatchAptSecurity
+	patchAdvisories      = config.PatchAdvisories
+	patchRestartServices = config.PatchRestartServices
+	servicesToRestart    = ospatch.ServicesToRestart
+	restartService       = ospatch.RestartService
+)
 
 type patchStep string
 
@@ -50,8 +59,38 @@ type patchTask struct {
 	StartedAt   time.Time `json:",omitempty"`
 	PatchStep   patchStep `json:",omitempty"`
 	RebootCount int
-	LogLabels   map[string]string `json:",omitempty"`
-	// TODO add Attempts and track number of retries with backoff, jitter, etc.
+	// Reboots records every reboot done by this task.
+	Reboots []rebootRecord `json:",omitempty"`
+	// Rebooting is set right before rebooting and cleared when the task is
+	// resumed after the reboot.
+	Rebooting bool `json:",omitempty"`
+	// Attempts is the number of times this task was started, resuming after
+	// an agent restart counts as a new attempt, resuming after a reboot
+	// done by the task does not.
+	Attempts    int
+	LastAttempt time.Time `json:",omitempty"`
+	// Results are the package results of every patch run of this task.
+	Results []*ospatch.Result `json:",omitempty"`
+	// RestartedServices are the units restarted instead of rebooting.
+	RestartedServices []string `json:",omitempty"`
+	// WindowOpened is set once the task is in the maintenance window.
+	WindowOpened bool `json:",omitempty"`
+	// UpdatesStarted is set before updates are first installed, from then
+	// on a closed maintenance window only skips reboots.
+	UpdatesStarted bool `json:",omitempty"`
+	// HookPhase is the last hook phase that completed.
+	HookPhase hookPhase         `json:",omitempty"`
+	LogLabels map[string]string `json:",omitempty"`
+}
+
+type rebootRecord struct {
+	Time time.Time
+	Step patchStep
+	// Required is set if the system reported a reboot was required, as
+	// opposed to a reboot forced by RebootConfig ALWAYS.
+	Required bool `json:",omitempty"`
+	// Reason is why the system reported a reboot was required.
+	Reason string `json:",omitempty"`
 }
 
 func (r *patchTask) saveState() error {
@@ -126,6 +165,7 @@ func (r *patchTask) reportCanceled(ctx context.Context) error {
 }
 
 func (r *patchTask) reportCompletedState(ctx context.Context, errMsg string, output *agentendpointpb.ReportTaskCompleteRequest_ApplyPatchesTaskOutput) error {
+	r.writeReport(output.ApplyPatchesTaskOutput.GetState().String(), errMsg)
 	req := &agentendpointpb.ReportTaskCompleteRequest{
 		TaskId:       r.TaskID,
 		TaskType:     agentendpointpb.TaskType_APPLY_PATCHES,
@@ -167,8 +207,6 @@ func (r *patchTask) reportContinuingState(ctx context.Context, patchState agente
 	return r.saveState()
 }
 
-// TODO: Add MaxRebootCount so we don't loop endlessly.
-
 func (r *patchTask) prePatchReboot(ctx context.Context) error {
 	return r.rebootIfNeeded(ctx, true)
 }
@@ -177,19 +215,81 @@ func (r *patchTask) postPatchReboot(ctx context.Context) error {
 	return r.rebootIfNeeded(ctx, false)
 }
 
+func (r *patchTask) lastReboot() rebootRecord {
+	if len(r.Reboots) == 0 {
+		return rebootRecord{}
+	}
+	return r.Reboots[len(r.Reboots)-1]
+}
+
+// checkRebootResult is called when the task resumes after a reboot. If the
+// system required a reboot before rebooting and still requires one the reboot
+// did not fix anything and rebooting again would likely loop.
+func (r *patchTask) checkRebootResult() error {
+	r.Rebooting = false
+	if err := r.saveState(); err != nil {
+		return fmt.Errorf("error saving state: %v", err)
+	}
+
+	last := r.lastReboot()
+	if !last.Required {
+		return nil
+	}
+	required, reason, err := systemRebootRequired()
+	if err != nil {
+		return fmt.Errorf("error checking if a system reboot is required: %v", err)
+	}
+	if required {
+		return fmt.Errorf("system still requires a reboot after rebooting at %s (%s), not rebooting again to avoid a reboot loop", last.Time.Format(time.RFC3339), reason)
+	}
+	return nil
+}
+
+// startAttempt records a new attempt. Any attempt after the first means the
+// agent restarted in the middle of this task, possibly because the task
+// crashed it, so back off before resuming and give up after maxPatchAttempts.
+func (r *patchTask) startAttempt(ctx context.Context) error {
+	last := r.LastAttempt
+	r.Attempts++
+	if r.Attempts > maxPatchAttempts() {
+		return fmt.Errorf("patch task did not complete after %d attempts, last attempt was started at %s", r.Attempts-1, last.Format(time.RFC3339))
+	}
+	r.LastAttempt = time.Now()
+	if err := r.saveState(); err != nil {
+		return fmt.Errorf("error saving state: %v", err)
+	}
+	if r.Attempts == 1 {
+		return nil
+	}
+
+	wait := patchResumeBackoff(r.Attempts-1) - time.Since(last)
+	if wait <= 0 {
+		return nil
+	}
+	r.infof("Resuming patch task, attempt %d of %d, waiting %s before resuming.", r.Attempts, maxPatchAttempts(), wait)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
 func (r *patchTask) rebootIfNeeded(ctx context.Context, prePatch bool) error {
-	var reboot bool
+	var reboot, required bool
+	var reason string
 	var err error
 	if r.Task.GetPatchConfig().GetRebootConfig() == agentendpointpb.PatchConfig_ALWAYS && !prePatch && r.RebootCount == 0 {
 		reboot = true
 		r.infof("PatchConfig RebootConfig set to %s.", agentendpointpb.PatchConfig_ALWAYS)
 	} else {
-		reboot, err = systemRebootRequired()
+		reboot, reason, err = systemRebootRequired()
+		required = reboot
 		if err != nil {
 			return fmt.Errorf("error checking if a system reboot is required: %v", err)
 		}
 		if reboot {
-			r.infof("System indicates a reboot is required.")
+			r.infof("System indicates a reboot is required: %s.", reason)
 		} else {
 			r.infof("System indicates a reboot is not required.")
 		}
@@ -204,6 +304,24 @@ func (r *patchTask) rebootIfNeeded(ctx context.Context, prePatch bool) error {
 		return nil
 	}
 
+	if !r.inWindow() {
+		r.infof("Skipping reboot because the maintenance window is closed.")
+		return nil
+	}
+
+	// Services are only restarted for files replaced by this task, a reboot
+	// required before patching is done as usual.
+	if required && !prePatch && r.Task.GetPatchConfig().GetRebootConfig() == agentendpointpb.PatchConfig_DEFAULT && patchRestartServices() {
+		if r.restartServices() {
+			return nil
+		}
+	}
+
+	// Check the limit before telling the server the instance is rebooting.
+	if r.RebootCount >= maxRebootCount() {
+		return fmt.Errorf("system requires a reboot but this task has already rebooted the system %d times, the maximum allowed, last reboot was at %s", r.RebootCount, r.lastReboot().Time.Format(time.RFC3339))
+	}
+
 	if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_REBOOTING); err != nil {
 		return err
 	}
@@ -214,6 +332,8 @@ func (r *patchTask) rebootIfNeeded(ctx context.Context, prePatch bool) error {
 	}
 
 	r.RebootCount++
+	r.Reboots = append(r.Reboots, rebootRecord{Time: time.Now(), Step: r.PatchStep, Required: required, Reason: reason})
+	r.Rebooting = true
 	if err := r.saveState(); err != nil {
 		return fmt.Errorf("error saving state: %v", err)
 	}
@@ -244,6 +364,15 @@ func (r *patchTask) run(ctx context.Context) (err error) {
 		}
 	}()
 
+	if r.Rebooting {
+		r.infof("Resuming after reboot at %s.", r.lastReboot().Time.Format(time.RFC3339))
+		if err := r.checkRebootResult(); err != nil {
+			return r.reportFailed(ctx, err.Error())
+		}
+	} else if err := r.startAttempt(ctx); err != nil {
+		return r.reportFailed(ctx, err.Error())
+	}
+
 	for {
 		r.debugf("Running PatchStep %q.", r.PatchStep)
 		switch r.PatchStep {
@@ -258,13 +387,38 @@ func (r *patchTask) run(ctx context.Context) (err error) {
 			if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_STARTED); err != nil {
 				return r.handleErrorState(ctx, err.Error(), err)
 			}
+			if err := r.enterWindow(ctx); err != nil {
+				return r.handleErrorState(ctx, fmt.Sprintf("Error waiting for the maintenance window: %v", err), err)
+			}
+			if err := r.runHooks(ctx, preHooks); err != nil {
+				return r.handleErrorState(ctx, fmt.Sprintf("Error running pre-patch hooks: %v", err), err)
+			}
 			if err := r.prePatchReboot(ctx); err != nil {
 				return r.handleErrorState(ctx, fmt.Sprintf("Error running prePatchReboot: %v", err), err)
 			}
 		case patching:
+			// Waits if the agent restarted before the window opened. Once
+			// updates were installed the task resumes after a reboot even
+			// if the window has since closed.
+			if !r.UpdatesStarted {
+				if err := r.enterWindow(ctx); err != nil {
+					return r.handleErrorState(ctx, fmt.Sprintf("Error waiting for the maintenance window: %v", err), err)
+				}
+			}
 			if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_APPLYING_PATCHES); err != nil {
 				return r.handleErrorState(ctx, err.Error(), err)
 			}
+			// Only runs the hooks if the agent restarted while they ran.
+			if err := r.runHooks(ctx, preHooks); err != nil {
+				return r.handleErrorState(ctx, fmt.Sprintf("Error running pre-patch hooks: %v", err), err)
+			}
+			r.snapshot()
+			if !r.UpdatesStarted {
+				r.UpdatesStarted = true
+				if err := r.saveState(); err != nil {
+					return r.reportFailed(ctx, fmt.Sprintf("Error saving state: %v", err))
+				}
+			}
 			if err := r.runUpdates(ctx); err != nil {
 				return r.handleErrorState(ctx, fmt.Sprintf("Failed to apply patches: %v", err), err)
 			}
@@ -276,13 +430,18 @@ func (r *patchTask) run(ctx context.Context) (err error) {
 				return r.reportFailed(ctx, fmt.Sprintf("Error saving agent step: %v", err))
 			}
 		case postPatch:
-			isRebootRequired, err := systemRebootRequired()
+			if err := r.runHooks(ctx, postHooks); err != nil {
+				return r.handleErrorState(ctx, fmt.Sprintf("Error running post-patch hooks: %v", err), err)
+			}
+
+			isRebootRequired, reason, err := systemRebootRequired()
 			if err != nil {
 				return r.reportFailed(ctx, fmt.Sprintf("Error checking if system reboot is required: %v", err))
 			}
 
 			finalState := agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED
 			if isRebootRequired {
+				r.infof("System still requires a reboot: %s.", reason)
 				finalState = agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED_REBOOT_REQUIRED
 			}
 
@@ -0,0 +1,279 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/agentendpoint/fakeserver"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+	"github.com/kylelemons/godebug/pretty"
+	"google.golang.org/api/option"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestPatchTaskMaxRebootCount(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeserver.NewServer()
+	srv.Start()
+	defer srv.Stop()
+
+	conn, err := srv.Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+
+	systemRebootRequired = func() (bool, string, error) { return true, "", nil }
+	maxRebootCount = func() int { return 2 }
+
+	r := &patchTask{
+		client:      client,
+		TaskID:      "foo",
+		Task:        &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{}}},
+		PatchStep:   patching,
+		RebootCount: 2,
+		Reboots:     []rebootRecord{{Time: time.Now(), Step: patching, Required: true}, {Time: time.Now(), Step: patching, Required: false}},
+	}
+	err = r.postPatchReboot(ctx)
+	if err == nil {
+		t.Fatal("expected error from postPatchReboot")
+	}
+	if !strings.Contains(err.Error(), "2 times") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if r.RebootCount != 2 || r.Rebooting {
+		t.Errorf("task state should not change: RebootCount=%d, Rebooting=%t", r.RebootCount, r.Rebooting)
+	}
+	for _, req := range srv.ReportTaskProgressRequests() {
+		if st := req.GetApplyPatchesTaskProgress().GetState(); st == agentendpointpb.ApplyPatchesTaskProgress_REBOOTING {
+			t.Error("REBOOTING progress should not be reported when the reboot limit is reached")
+		}
+	}
+}
+
+func TestPatchTaskRebootLoop(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+
+	tests := []struct {
+		name          string
+		required      bool
+		stillRequired bool
+		wantState     agentendpointpb.ApplyPatchesTaskOutput_State
+		wantMsg       string
+	}{
+		{"RebootFixed", true, false, agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED, ""},
+		{"RebootLoop", true, true, agentendpointpb.ApplyPatchesTaskOutput_FAILED, "(kernel updated), not rebooting again to avoid a reboot loop"},
+		{"RebootAlways", false, true, agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED_REBOOT_REQUIRED, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			systemRebootRequired = func() (bool, string, error) { return tt.stillRequired, "kernel updated", nil }
+
+			r := &patchTask{
+				client:      tc.client,
+				TaskID:      tt.name,
+				Task:        &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{}}},
+				PatchStep:   postPatch,
+				RebootCount: 1,
+				Reboots:     []rebootRecord{{Time: time.Now(), Step: patching, Required: tt.required}},
+				Rebooting:   true,
+			}
+			if err := r.run(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			got := srv.lastReportTaskCompleteRequest
+			if got.GetTaskId() != tt.name {
+				t.Fatalf("unexpected ReportTaskCompleteRequest: %+v", got)
+			}
+			if state := got.GetApplyPatchesTaskOutput().GetState(); state != tt.wantState {
+				t.Errorf("want state %s, got %s", tt.wantState, state)
+			}
+			if !strings.Contains(got.GetErrorMessage(), tt.wantMsg) || (tt.wantMsg == "" && got.GetErrorMessage() != "") {
+				t.Errorf("unexpected error message: %q", got.GetErrorMessage())
+			}
+			if r.Rebooting {
+				t.Error("Rebooting should be cleared on resume")
+			}
+		})
+	}
+}
+
+func TestPatchTaskAttempts(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+
+	systemRebootRequired = func() (bool, string, error) { return false, "", nil }
+	maxPatchAttempts = func() int { return 3 }
+	var gotBackoff []int
+	patchResumeBackoff = func(attempt int) time.Duration {
+		gotBackoff = append(gotBackoff, attempt)
+		return time.Millisecond
+	}
+
+	tests := []struct {
+		name         string
+		attempts     int
+		rebooting    bool
+		wantState    agentendpointpb.ApplyPatchesTaskOutput_State
+		wantAttempts int
+		wantBackoff  []int
+	}{
+		{"FirstAttempt", 0, false, agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED, 1, nil},
+		{"Resume", 1, false, agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED, 2, []int{1}},
+		{"ResumeAfterReboot", 1, true, agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED, 1, nil},
+		{"TooManyAttempts", 3, false, agentendpointpb.ApplyPatchesTaskOutput_FAILED, 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBackoff = nil
+			r := &patchTask{
+				client:      tc.client,
+				TaskID:      tt.name,
+				Task:        &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{}}},
+				PatchStep:   postPatch,
+				Attempts:    tt.attempts,
+				LastAttempt: time.Now(),
+				Rebooting:   tt.rebooting,
+			}
+			if err := r.run(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			got := srv.lastReportTaskCompleteRequest
+			if got.GetTaskId() != tt.name {
+				t.Fatalf("unexpected ReportTaskCompleteRequest: %+v", got)
+			}
+			if state := got.GetApplyPatchesTaskOutput().GetState(); state != tt.wantState {
+				t.Errorf("want state %s, got %s: %q", tt.wantState, state, got.GetErrorMessage())
+			}
+			if r.Attempts != tt.wantAttempts {
+				t.Errorf("want %d attempts, got %d", tt.wantAttempts, r.Attempts)
+			}
+			if !reflect.DeepEqual(gotBackoff, tt.wantBackoff) {
+				t.Errorf("want backoff calls %v, got %v", tt.wantBackoff, gotBackoff)
+			}
+		})
+	}
+}
+
+func TestPatchTaskReport(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+	systemRebootRequired = func() (bool, string, error) { return false, "", nil }
+
+	r := &patchTask{
+		client:    tc.client,
+		TaskID:    "foo",
+		Task:      &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{}}},
+		PatchStep: postPatch,
+	}
+	res := &ospatch.Result{PackageManager: "apt", Packages: []ospatch.PackageResult{{Name: "pkg", OldVersion: "1.0", NewVersion: "2.0", Status: ospatch.PackageUpdated}}}
+	r.addResult(res)
+	r.addResult(nil)
+
+	st, err := loadState(taskStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := pretty.Compare(st.PatchTask.Results, []*ospatch.Result{res}); diff != "" {
+		t.Errorf("saved results do not match expectation: (-got +want)\n%s", diff)
+	}
+
+	if err := r.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := ioutil.ReadFile(r.reportFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got patchReport
+	if err := json.Unmarshal(d, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TaskID != "foo" || got.State != agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED.String() {
+		t.Errorf("unexpected report: %s", d)
+	}
+	if diff := pretty.Compare(got.Results, []*ospatch.Result{res}); diff != "" {
+		t.Errorf("report results do not match expectation: (-got +want)\n%s", diff)
+	}
+}
@@ -0,0 +1,102 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/config"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+var (
+	patchWindow = func() (*ospatch.Windows, error) {
+		return ospatch.ParseWindows(config.PatchWindow(), config.PatchWindowTimezone())
+	}
+	// windowPollInterval is how often progress is reported while waiting
+	// for the maintenance window, it also bounds how late a changed window
+	// is noticed.
+	windowPollInterval = 5 * time.Minute
+	now                = time.Now
+
+	errWindowClosed = errors.New("the maintenance window closed before patching started")
+)
+
+// enterWindow waits until the maintenance window is open, reporting progress
+// so the server can cancel the task while it waits. Once the task has been in
+// the window it fails instead of waiting if the window has since closed.
+func (r *patchTask) enterWindow(ctx context.Context) error {
+	// A dry run does not change the system so it does not wait.
+	if r.Task != nil && r.Task.GetDryRun() {
+		return nil
+	}
+	for {
+		w, err := patchWindow()
+		if err != nil {
+			return err
+		}
+		if w == nil {
+			return nil
+		}
+		t := now()
+		if w.Contains(t) {
+			if r.WindowOpened {
+				return nil
+			}
+			r.infof("Maintenance window is open until %s.", w.End(t).Format(time.RFC3339))
+			r.WindowOpened = true
+			if err := r.saveState(); err != nil {
+				return fmt.Errorf("error saving state: %v", err)
+			}
+			return nil
+		}
+		if r.WindowOpened {
+			return errWindowClosed
+		}
+
+		next, ok := w.Next(t)
+		if !ok {
+			return errors.New("the maintenance window does not open within a year")
+		}
+		r.infof("Outside of the maintenance window, waiting until %s.", next.Format(time.RFC3339))
+		if err := r.reportContinuingState(ctx, agentendpointpb.ApplyPatchesTaskProgress_STARTED); err != nil {
+			return err
+		}
+
+		wait := next.Sub(t)
+		if wait > windowPollInterval {
+			wait = windowPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// inWindow reports whether the maintenance window, if any, is open.
+func (r *patchTask) inWindow() bool {
+	w, err := patchWindow()
+	if err != nil || w == nil {
+		return true
+	}
+	return w.Contains(now())
+}
@@ -0,0 +1,147 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+	"github.com/GoogleCloudPlatform/osconfig/ospatch"
+
+	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
+)
+
+func TestPatchTaskWindow(t *testing.T) {
+	ctx := context.Background()
+	srv := &agentEndpointServiceExecTestServer{}
+	tc, err := newTestClient(ctx, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.close()
+
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	taskStateFile = filepath.Join(td, "testState")
+	taskLogDir = td
+	patchHooksDir = func() string { return td }
+	oldWindow, oldNow := patchWindow, now
+	defer func() { patchWindow, now = oldWindow, oldNow }()
+
+	// 2020-03-07 is a Saturday, the window opens at 22:00.
+	clock := time.Date(2020, 3, 7, 21, 50, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	patchWindow = func() (*ospatch.Windows, error) { return ospatch.ParseWindows("Sat 22:00-Sun 04:00", "") }
+	windowPollInterval = time.Millisecond
+
+	newTask := func(id string) *patchTask {
+		return &patchTask{
+			client: tc.client,
+			TaskID: id,
+			Task:   &applyPatchesTask{&agentendpointpb.ApplyPatchesTask{PatchConfig: &agentendpointpb.PatchConfig{}}},
+		}
+	}
+
+	t.Run("Wait", func(t *testing.T) {
+		var polls int
+		now = func() time.Time {
+			polls++
+			// Advance the clock by a minute every time it is read.
+			clock = clock.Add(time.Minute)
+			return clock
+		}
+		r := newTask("Wait")
+		if err := r.enterWindow(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if !r.WindowOpened {
+			t.Error("WindowOpened should be set")
+		}
+		if polls != 10 {
+			t.Errorf("want the window to open after 10 polls, got %d", polls)
+		}
+	})
+
+	t.Run("ClosedBeforePatching", func(t *testing.T) {
+		clock = time.Date(2020, 3, 8, 4, 30, 0, 0, time.UTC)
+		now = func() time.Time { return clock }
+		systemRebootRequired = func() (bool, string, error) { return false, "", nil }
+		r := newTask("ClosedBeforePatching")
+		r.PatchStep = patching
+		r.WindowOpened = true
+		if err := r.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		got := srv.lastReportTaskCompleteRequest
+		if got.GetTaskId() != "ClosedBeforePatching" || got.GetApplyPatchesTaskOutput().GetState() != agentendpointpb.ApplyPatchesTaskOutput_FAILED {
+			t.Fatalf("unexpected ReportTaskCompleteRequest: %+v", got)
+		}
+		if want := "Error waiting for the maintenance window: " + errWindowClosed.Error(); got.GetErrorMessage() != want {
+			t.Errorf("want error message %q, got %q", want, got.GetErrorMessage())
+		}
+	})
+
+	t.Run("ClosedAfterPatching", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("runs the Windows Update agent")
+		}
+		defer func(apt, dnf, yum, zypper bool) {
+			packages.AptExists, packages.DnfExists, packages.YumExists, packages.ZypperExists = apt, dnf, yum, zypper
+		}(packages.AptExists, packages.DnfExists, packages.YumExists, packages.ZypperExists)
+		packages.AptExists, packages.DnfExists, packages.YumExists, packages.ZypperExists = false, false, false, false
+
+		clock = time.Date(2020, 3, 8, 4, 30, 0, 0, time.UTC)
+		now = func() time.Time { return clock }
+		systemRebootRequired = func() (bool, string, error) { return true, "", nil }
+		r := newTask("ClosedAfterPatching")
+		r.PatchStep = patching
+		r.WindowOpened = true
+		r.UpdatesStarted = true
+		r.RebootCount = 1
+		if err := r.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		got := srv.lastReportTaskCompleteRequest
+		if got.GetTaskId() != "ClosedAfterPatching" || got.GetApplyPatchesTaskOutput().GetState() != agentendpointpb.ApplyPatchesTaskOutput_SUCCEEDED_REBOOT_REQUIRED {
+			t.Fatalf("unexpected ReportTaskCompleteRequest: %+v", got)
+		}
+		if r.RebootCount != 1 {
+			t.Errorf("should not reboot outside of the window, RebootCount=%d", r.RebootCount)
+		}
+	})
+
+	t.Run("NoRebootOutsideWindow", func(t *testing.T) {
+		clock = time.Date(2020, 3, 8, 4, 30, 0, 0, time.UTC)
+		now = func() time.Time { return clock }
+		systemRebootRequired = func() (bool, string, error) { return true, "", nil }
+		r := newTask("NoRebootOutsideWindow")
+		r.PatchStep = patching
+		if err := r.postPatchReboot(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if r.Rebooting || r.RebootCount != 0 {
+			t.Errorf("should not reboot outside of the window: Rebooting=%t, RebootCount=%d", r.Rebooting, r.RebootCount)
+		}
+	})
+}
@@ -134,8 +134,15 @@ func (r *patchTask) runUpdates(ctx context.Context) error {
 		r.debugf("Installing GooGet package updates.")
 		opts := []ospatch.GooGetUpdateOption{
 			ospatch.GooGetDryRun(r.Task.GetDryRun()),
+			ospatch.GooGetNeverPatch(neverPatch()),
 		}
-		if err := retryFunc(3*time.Minute, "installing GooGet package updates", func() error { return ospatch.RunGooGetUpdate(opts...) }); err != nil {
+		var res *ospatch.Result
+		err := retryFunc(3*time.Minute, "installing GooGet package updates", func() (err error) {
+			res, err = ospatch.RunGooGetUpdate(opts...)
+			return err
+		})
+		r.addResult(res)
+		if err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,90 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import "sync"
+
+// ringBuffer is an io.Writer that keeps only the last size bytes written to
+// it. It is safe for concurrent use.
+type ringBuffer struct {
+	mx    sync.Mutex
+	data  []byte
+	pos   int
+	full  bool
+	total int64
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, size)}
+}
+
+// Write implements io.Writer, it never returns an error.
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+	size := len(b.data)
+	if size == 0 {
+		return n, nil
+	}
+	if len(p) >= size {
+		copy(b.data, p[len(p)-size:])
+		b.pos = 0
+		b.full = true
+		return n, nil
+	}
+
+	c := copy(b.data[b.pos:], p)
+	if c < len(p) {
+		copy(b.data, p[c:])
+		b.full = true
+	}
+	b.pos = (b.pos + len(p)) % size
+	if b.pos == 0 {
+		b.full = true
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the buffered data, oldest byte first.
+func (b *ringBuffer) Bytes() []byte {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.bytes()
+}
+
+func (b *ringBuffer) bytes() []byte {
+	if !b.full {
+		return append([]byte(nil), b.data[:b.pos]...)
+	}
+	ret := make([]byte, 0, len(b.data))
+	ret = append(ret, b.data[b.pos:]...)
+	return append(ret, b.data[:b.pos]...)
+}
+
+// Tail returns up to the last n bytes written and whether any earlier output
+// was dropped.
+func (b *ringBuffer) Tail(n int) ([]byte, bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	d := b.bytes()
+	if len(d) > n {
+		d = d[len(d)-n:]
+	}
+	return d, b.total > int64(len(d))
+}
@@ -0,0 +1,59 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package agentendpoint
+
+import "testing"
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		writes        []string
+		want          string
+		wantTail      string
+		wantTruncated bool
+	}{
+		{"Empty", 5, nil, "", "", false},
+		{"Partial", 5, []string{"ab"}, "ab", "ab", false},
+		{"Exact", 5, []string{"abc", "de"}, "abcde", "bcde", true},
+		{"Wrap", 5, []string{"abc", "def"}, "bcdef", "cdef", true},
+		{"WrapMany", 5, []string{"abc", "def", "gh", "i"}, "efghi", "fghi", true},
+		{"Large", 5, []string{"a", "0123456789"}, "56789", "6789", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newRingBuffer(tt.size)
+			for _, w := range tt.writes {
+				n, err := b.Write([]byte(w))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != len(w) {
+					t.Errorf("Write returned %d, want %d", n, len(w))
+				}
+			}
+			if got := string(b.Bytes()); got != tt.want {
+				t.Errorf("Bytes: want %q, got %q", tt.want, got)
+			}
+			tail, truncated := b.Tail(4)
+			if string(tail) != tt.wantTail {
+				t.Errorf("Tail: want %q, got %q", tt.wantTail, tail)
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("Tail: want truncated %t, got %t", tt.wantTruncated, truncated)
+			}
+		})
+	}
+}
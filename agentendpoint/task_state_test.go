@@ -113,7 +113,7 @@ func TestStateSave(t *testing.T) {
 		{
 			"PatchTask",
 			&taskState{PatchTask: &patchTask{TaskID: "foo"}, ExecTask: nil},
-			"{\"PatchTask\":{\"TaskID\":\"foo\",\"Task\":null,\"StartedAt\":\"0001-01-01T00:00:00Z\",\"RebootCount\":0}}",
+			"{\"PatchTask\":{\"TaskID\":\"foo\",\"Task\":null,\"StartedAt\":\"0001-01-01T00:00:00Z\",\"RebootCount\":0,\"Attempts\":0,\"LastAttempt\":\"0001-01-01T00:00:00Z\"}}",
 		},
 		{
 			"ExecTask",
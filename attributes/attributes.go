@@ -20,33 +20,14 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
+
+	"github.com/GoogleCloudPlatform/osconfig/config"
 )
 
 // PostAttribute posts data to Guest Attributes
 func PostAttribute(url string, value io.Reader) error {
-	req, err := http.NewRequest("PUT", url, value)
-	if err != nil {
-		return err
-	}
-	req.Header.Add("Metadata-Flavor", "Google")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		b, err := ioutil.ReadAll(resp.Body)
-		responseErr := fmt.Sprintf(`received status code %q for request "%s %s"`, resp.Status, req.Method, req.URL.String())
-		if err == nil {
-			responseErr = fmt.Sprintf("%s\n Error response: %s", responseErr, string(b))
-		}
-		return fmt.Errorf("%s", responseErr)
-	}
-	return nil
+	return config.Metadata().PutAttribute(url, value)
 }
 
 // PostAttributeCompressed compresses and posts data to Guest Attributes
@@ -28,7 +28,6 @@ import (
 	"sync"
 	"time"
 
-	"cloud.google.com/go/compute/metadata"
 	"golang.org/x/oauth2/jws"
 )
 
@@ -58,8 +57,22 @@ const (
 	taskStateFileLinux   = configDirLinux + "/osconfig_task.state"
 	restartFileWindows   = configDirWindows + `\osconfig_agent_restart_required`
 	restartFileLinux     = configDirLinux + "/osconfig_agent_restart_required"
+	taskLogDirWindows    = configDirWindows + `\task_logs`
+	taskLogDirLinux      = "/var/log/osconfig"
+	patchHooksDirWindows = configDirWindows + `\hooks`
+	patchHooksDirLinux   = configDirLinux + "/hooks"
+
+	inventoryStateFileWindows = configDirWindows + `\osconfig_inventory.state`
+	inventoryStateFileLinux   = configDirLinux + "/osconfig_inventory.state"
+
+	disabledAutoUpdateTimersFileWindows = configDirWindows + `\disabled_auto_update_timers`
+	disabledAutoUpdateTimersFileLinux   = configDirLinux + "/disabled_auto_update_timers"
 
 	osConfigPollIntervalDefault = 10
+	execStepTimeoutDefault      = 0
+	maxRebootCountDefault       = 5
+	maxPatchAttemptsDefault     = 3
+	inventoryRefreshDefault     = 60
 )
 
 var (
@@ -74,9 +87,14 @@ var (
 
 type config struct {
 	osInventoryEnabled, guestPoliciesEnabled, taskNotificationEnabled, debugEnabled       bool
+	patchAptSecurity, patchRestartServices                                                bool
 	svcEndpoint, googetRepoFilePath, zypperRepoFilePath, yumRepoFilePath, aptRepoFilePath string
-	numericProjectID, osConfigPollInterval                                                int
+	numericProjectID, osConfigPollInterval, execStepTimeout, maxRebootCount               int
+	maxPatchAttempts, inventoryRefresh                                                    int
 	projectID, instanceZone, instanceName, instanceID                                     string
+	execUser, execGroup, execWorkingDir, execUmask                                        string
+	patchWindow, patchWindowTimezone                                                      string
+	execEnvAllowlist, patchPreHooks, patchPostHooks, neverPatch, patchAdvisories          []string
 }
 
 func (c *config) parseFeatures(features string, enabled bool) {
@@ -108,6 +126,18 @@ func parseBool(s string) bool {
 	return enabled
 }
 
+// parseList parses a comma separated list, an empty string results in an
+// empty but non nil list.
+func parseList(s string) []string {
+	ret := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
 type metadataJSON struct {
 	Instance instanceJSON
 	Project  projectJSON
@@ -139,6 +169,23 @@ type attributesJSON struct {
 	OSConfigEndpoint      string       `json:"osconfig-endpoint"`
 	PollIntervalOld       *json.Number `json:"os-config-poll-interval"`
 	PollInterval          *json.Number `json:"osconfig-poll-interval"`
+	ExecStepTimeout       *json.Number `json:"osconfig-exec-step-timeout"`
+	ExecUser              string       `json:"osconfig-exec-user"`
+	ExecGroup             string       `json:"osconfig-exec-group"`
+	ExecEnvAllowlist      *string      `json:"osconfig-exec-env-allowlist"`
+	ExecWorkingDir        string       `json:"osconfig-exec-working-dir"`
+	ExecUmask             string       `json:"osconfig-exec-umask"`
+	MaxRebootCount        *json.Number `json:"osconfig-patch-max-reboot-count"`
+	MaxPatchAttempts      *json.Number `json:"osconfig-patch-max-attempts"`
+	InventoryRefresh      *json.Number `json:"osconfig-inventory-refresh-interval"`
+	PatchPreHooks         *string      `json:"osconfig-patch-pre-hooks"`
+	PatchPostHooks        *string      `json:"osconfig-patch-post-hooks"`
+	NeverPatch            *string      `json:"osconfig-never-patch"`
+	PatchAptSecurity      string       `json:"osconfig-patch-apt-security"`
+	PatchAdvisories       *string      `json:"osconfig-patch-advisories"`
+	PatchWindow           *string      `json:"osconfig-patch-window"`
+	PatchWindowTimezone   string       `json:"osconfig-patch-window-timezone"`
+	PatchRestartServices  string       `json:"osconfig-patch-restart-services"`
 }
 
 func createConfigFromMetadata(md metadataJSON) *config {
@@ -150,6 +197,10 @@ func createConfigFromMetadata(md metadataJSON) *config {
 		debugEnabled:            debugEnabledDefault,
 		svcEndpoint:             prodEndpoint,
 		osConfigPollInterval:    osConfigPollIntervalDefault,
+		execStepTimeout:         execStepTimeoutDefault,
+		maxRebootCount:          maxRebootCountDefault,
+		maxPatchAttempts:        maxPatchAttemptsDefault,
+		inventoryRefresh:        inventoryRefreshDefault,
 
 		googetRepoFilePath: googetRepoFilePath,
 		zypperRepoFilePath: zypperRepoFilePath,
@@ -236,6 +287,69 @@ func createConfigFromMetadata(md metadataJSON) *config {
 		}
 	}
 
+	// Check project first then instance as instance metadata overrides project.
+	for _, a := range []attributesJSON{md.Project.Attributes, md.Instance.Attributes} {
+		if a.ExecStepTimeout != nil {
+			if val, err := a.ExecStepTimeout.Int64(); err == nil && val >= 0 {
+				c.execStepTimeout = int(val)
+			}
+		}
+		if a.MaxRebootCount != nil {
+			if val, err := a.MaxRebootCount.Int64(); err == nil && val > 0 {
+				c.maxRebootCount = int(val)
+			}
+		}
+		if a.MaxPatchAttempts != nil {
+			if val, err := a.MaxPatchAttempts.Int64(); err == nil && val > 0 {
+				c.maxPatchAttempts = int(val)
+			}
+		}
+		if a.InventoryRefresh != nil {
+			if val, err := a.InventoryRefresh.Int64(); err == nil && val >= 0 {
+				c.inventoryRefresh = int(val)
+			}
+		}
+		if a.ExecUser != "" {
+			c.execUser = a.ExecUser
+		}
+		if a.ExecGroup != "" {
+			c.execGroup = a.ExecGroup
+		}
+		if a.ExecWorkingDir != "" {
+			c.execWorkingDir = a.ExecWorkingDir
+		}
+		if a.ExecEnvAllowlist != nil {
+			c.execEnvAllowlist = parseList(*a.ExecEnvAllowlist)
+		}
+		if a.PatchPreHooks != nil {
+			c.patchPreHooks = parseList(*a.PatchPreHooks)
+		}
+		if a.PatchPostHooks != nil {
+			c.patchPostHooks = parseList(*a.PatchPostHooks)
+		}
+		if a.NeverPatch != nil {
+			c.neverPatch = parseList(*a.NeverPatch)
+		}
+		if a.PatchAptSecurity != "" {
+			c.patchAptSecurity = parseBool(a.PatchAptSecurity)
+		}
+		if a.PatchAdvisories != nil {
+			c.patchAdvisories = parseList(*a.PatchAdvisories)
+		}
+		if a.PatchWindow != nil {
+			c.patchWindow = *a.PatchWindow
+		}
+		if a.PatchWindowTimezone != "" {
+			c.patchWindowTimezone = a.PatchWindowTimezone
+		}
+		if a.PatchRestartServices != "" {
+			c.patchRestartServices = parseBool(a.PatchRestartServices)
+		}
+		if a.ExecUmask != "" {
+			c.execUmask = a.ExecUmask
+		}
+	}
+
 	switch {
 	case md.Project.Attributes.DebugEnabledOld != "":
 		c.debugEnabled = parseBool(md.Project.Attributes.DebugEnabledOld)
@@ -297,7 +411,7 @@ func SetConfig(ctx context.Context) error {
 	webErrorCount := 0
 	ticker := time.NewTicker(5 * time.Second)
 	for {
-		md, webError = metadata.Get("?recursive=true&alt=json")
+		md, webError = Metadata().Get("?recursive=true&alt=json")
 		if webError == nil {
 			break
 		}
@@ -334,6 +448,124 @@ func SvcPollInterval() time.Duration {
 	return time.Duration(getAgentConfig().osConfigPollInterval) * time.Minute
 }
 
+// ExecStepTimeout returns the maximum time an exec step may run, 0 means no
+// limit.
+func ExecStepTimeout() time.Duration {
+	return time.Duration(getAgentConfig().execStepTimeout) * time.Minute
+}
+
+// MaxRebootCount is the maximum number of times a single patch task may
+// reboot the system.
+func MaxRebootCount() int {
+	if c := getAgentConfig().maxRebootCount; c > 0 {
+		return c
+	}
+	return maxRebootCountDefault
+}
+
+// MaxPatchAttempts is the maximum number of times a single patch task is
+// started, including resumes after an agent restart but not after a reboot
+// done by the task.
+func MaxPatchAttempts() int {
+	if c := getAgentConfig().maxPatchAttempts; c > 0 {
+		return c
+	}
+	return maxPatchAttemptsDefault
+}
+
+// InventoryRefreshInterval is how often the full inventory, including
+// available package updates, is gathered and every field posted again. 0
+// means every poll.
+func InventoryRefreshInterval() time.Duration {
+	return time.Duration(getAgentConfig().inventoryRefresh) * time.Minute
+}
+
+// ExecUser is the user exec steps and recipe scripts are run as, empty means
+// the agent user.
+func ExecUser() string {
+	return getAgentConfig().execUser
+}
+
+// ExecGroup is the group exec steps and recipe scripts are run as, empty means
+// the primary group of ExecUser.
+func ExecGroup() string {
+	return getAgentConfig().execGroup
+}
+
+// ExecEnvAllowlist lists the agent environment variables passed to exec steps
+// and recipe scripts, nil means the full environment is passed.
+func ExecEnvAllowlist() []string {
+	return getAgentConfig().execEnvAllowlist
+}
+
+// PatchPreHooks lists the GCS URLs, gs://bucket/object[#generation], of
+// scripts run before patching, after the hooks in PatchHooksDir.
+func PatchPreHooks() []string {
+	return getAgentConfig().patchPreHooks
+}
+
+// PatchPostHooks lists the GCS URLs, gs://bucket/object[#generation], of
+// scripts run after patching, after the hooks in PatchHooksDir.
+func PatchPostHooks() []string {
+	return getAgentConfig().patchPostHooks
+}
+
+// NeverPatch lists packages, or glob patterns, that patch tasks never update
+// regardless of the patch config.
+func NeverPatch() []string {
+	return getAgentConfig().neverPatch
+}
+
+// PatchAptSecurity reports whether apt patch tasks only install updates from
+// security pockets, unless the patch job sets its own apt package filter.
+func PatchAptSecurity() bool {
+	return getAgentConfig().patchAptSecurity
+}
+
+// PatchAdvisories lists the advisory and CVE IDs patch tasks are limited to,
+// nil means all updates selected by the patch config are installed. It does
+// not apply to package managers the patch job sets its own filter for.
+func PatchAdvisories() []string {
+	return getAgentConfig().patchAdvisories
+}
+
+// PatchWindow is the maintenance window patch tasks wait for, a semicolon
+// separated list of weekly ranges or cron schedules, see ospatch.ParseWindows.
+// Empty means patch tasks run immediately.
+func PatchWindow() string {
+	return getAgentConfig().patchWindow
+}
+
+// PatchWindowTimezone is the IANA time zone of PatchWindow, empty means UTC.
+func PatchWindowTimezone() string {
+	return getAgentConfig().patchWindowTimezone
+}
+
+// PatchRestartServices reports whether patch tasks with the default reboot
+// config restart the services using replaced files after patching instead of
+// rebooting, rebooting only if the kernel or init changed or no service uses
+// replaced files.
+func PatchRestartServices() bool {
+	return getAgentConfig().patchRestartServices
+}
+
+// ExecWorkingDir is the working directory for exec steps, empty means a per
+// task directory is created. The exec user must be able to use it, its owner
+// is not changed.
+func ExecWorkingDir() string {
+	return getAgentConfig().execWorkingDir
+}
+
+// ExecUmask is the umask exec steps and recipe scripts are run with, -1 means
+// the agent umask is used.
+func ExecUmask() int {
+	val, err := strconv.ParseUint(getAgentConfig().execUmask, 8, 32)
+	if err != nil {
+		return -1
+	}
+	return int(val)
+}
+
 // MaxMetadataRetryDelay is the maximum retry delay when getting data from the metadata server.
 func MaxMetadataRetryDelay() time.Duration {
 	return 30 * time.Second
@@ -441,7 +673,7 @@ type idToken struct {
 }
 
 func (t *idToken) get() error {
-	data, err := metadata.Get(IdentityTokenPath)
+	data, err := Metadata().IdentityToken()
 	if err != nil {
 		return fmt.Errorf("error getting token from metadata: %v", err)
 	}
@@ -494,6 +726,25 @@ func TaskStateFile() string {
 	return taskStateFileLinux
 }
 
+// InventoryStateFile is the location of the inventory state file.
+func InventoryStateFile() string {
+	if runtime.GOOS == "windows" {
+		return inventoryStateFileWindows
+	}
+
+	return inventoryStateFileLinux
+}
+
+// DisabledAutoUpdateTimersFile is the location of the file listing the auto
+// update timers disabled by the agent.
+func DisabledAutoUpdateTimersFile() string {
+	if runtime.GOOS == "windows" {
+		return disabledAutoUpdateTimersFileWindows
+	}
+
+	return disabledAutoUpdateTimersFileLinux
+}
+
 // RestartFile is the location of the restart required file.
 func RestartFile() string {
 	if runtime.GOOS == "windows" {
@@ -502,3 +753,22 @@ func RestartFile() string {
 
 	return restartFileLinux
 }
+
+// PatchHooksDir is the directory containing the prepatch.d and postpatch.d
+// hook directories.
+func PatchHooksDir() string {
+	if runtime.GOOS == "windows" {
+		return patchHooksDirWindows
+	}
+
+	return patchHooksDirLinux
+}
+
+// TaskLogDir is the directory where per task output logs are written.
+func TaskLogDir() string {
+	if runtime.GOOS == "windows" {
+		return taskLogDirWindows
+	}
+
+	return taskLogDirLinux
+}
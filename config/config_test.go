@@ -30,7 +30,7 @@ import (
 
 func TestSetConfig(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, `{"project":{"numericProjectID":12345,"projectId":"projectId","attributes":{"osconfig-endpoint":"bad!!1","enable-os-inventory":"false"}},"instance":{"id":12345,"name":"name","zone":"zone","attributes":{"osconfig-endpoint":"SvcEndpoint","enable-os-inventory":"1","enable-os-config-debug":"true","osconfig-enabled-prerelease-features":"ospackage,ospatch", "osconfig-poll-interval":"3"}}}`)
+		fmt.Fprintln(w, `{"project":{"numericProjectID":12345,"projectId":"projectId","attributes":{"osconfig-endpoint":"bad!!1","enable-os-inventory":"false","osconfig-exec-user":"projuser","osconfig-exec-group":"projgroup","osconfig-exec-step-timeout":"5","osconfig-patch-max-attempts":"4","osconfig-inventory-refresh-interval":"0","osconfig-patch-pre-hooks":"gs://bucket/pre.sh","osconfig-never-patch":"kernel*, docker-ce","osconfig-patch-apt-security":"true","osconfig-patch-advisories":"RHSA-2020:0374","osconfig-patch-window":"Sat 22:00-Sun 04:00","osconfig-patch-window-timezone":"America/New_York"}},"instance":{"id":12345,"name":"name","zone":"zone","attributes":{"osconfig-endpoint":"SvcEndpoint","enable-os-inventory":"1","enable-os-config-debug":"true","osconfig-enabled-prerelease-features":"ospackage,ospatch", "osconfig-poll-interval":"3", "osconfig-exec-step-timeout":"-1", "osconfig-exec-user":"instuser", "osconfig-exec-env-allowlist":"PATH, LANG", "osconfig-exec-umask":"027", "osconfig-patch-max-reboot-count":"2", "osconfig-patch-post-hooks":"gs://bucket/post.sh, gs://bucket/check.sh#123", "osconfig-patch-advisories":"CVE-2020-1967, USN-4328-1", "osconfig-patch-window":"Mon-Fri 01:00-03:00", "osconfig-patch-restart-services":"true"}}}`)
 	}))
 	defer ts.Close()
 
@@ -79,6 +79,54 @@ func TestSetConfig(t *testing.T) {
 	if SvcPollInterval().Minutes() != float64(3) {
 		t.Errorf("Default poll interval: got(%f) != want(%d)", SvcPollInterval().Minutes(), 3)
 	}
+	if ExecStepTimeout().Minutes() != float64(5) {
+		t.Errorf("ExecStepTimeout: got(%f) != want(%d)", ExecStepTimeout().Minutes(), 5)
+	}
+	if MaxRebootCount() != 2 {
+		t.Errorf("MaxRebootCount: got(%d) != want(%d)", MaxRebootCount(), 2)
+	}
+	if MaxPatchAttempts() != 4 {
+		t.Errorf("MaxPatchAttempts: got(%d) != want(%d)", MaxPatchAttempts(), 4)
+	}
+	if InventoryRefreshInterval() != 0 {
+		t.Errorf("InventoryRefreshInterval: got(%s) != want(0)", InventoryRefreshInterval())
+	}
+	if !reflect.DeepEqual(PatchPreHooks(), []string{"gs://bucket/pre.sh"}) {
+		t.Errorf("PatchPreHooks: got(%q) != want(%q)", PatchPreHooks(), []string{"gs://bucket/pre.sh"})
+	}
+	if !reflect.DeepEqual(PatchPostHooks(), []string{"gs://bucket/post.sh", "gs://bucket/check.sh#123"}) {
+		t.Errorf("PatchPostHooks: got(%q) != want(%q)", PatchPostHooks(), []string{"gs://bucket/post.sh", "gs://bucket/check.sh#123"})
+	}
+	if !reflect.DeepEqual(NeverPatch(), []string{"kernel*", "docker-ce"}) {
+		t.Errorf("NeverPatch: got(%q) != want(%q)", NeverPatch(), []string{"kernel*", "docker-ce"})
+	}
+	if PatchWindow() != "Mon-Fri 01:00-03:00" {
+		t.Errorf("PatchWindow: got(%q) != want(%q)", PatchWindow(), "Mon-Fri 01:00-03:00")
+	}
+	if PatchWindowTimezone() != "America/New_York" {
+		t.Errorf("PatchWindowTimezone: got(%q) != want(%q)", PatchWindowTimezone(), "America/New_York")
+	}
+	if !PatchAptSecurity() {
+		t.Errorf("PatchAptSecurity: got(false) != want(true)")
+	}
+	if !PatchRestartServices() {
+		t.Errorf("PatchRestartServices: got(false) != want(true)")
+	}
+	if !reflect.DeepEqual(PatchAdvisories(), []string{"CVE-2020-1967", "USN-4328-1"}) {
+		t.Errorf("PatchAdvisories: got(%q) != want(%q)", PatchAdvisories(), []string{"CVE-2020-1967", "USN-4328-1"})
+	}
+	if ExecUser() != "instuser" {
+		t.Errorf("ExecUser: got(%s) != want(%s)", ExecUser(), "instuser")
+	}
+	if ExecGroup() != "projgroup" {
+		t.Errorf("ExecGroup: got(%s) != want(%s)", ExecGroup(), "projgroup")
+	}
+	if !reflect.DeepEqual(ExecEnvAllowlist(), []string{"PATH", "LANG"}) {
+		t.Errorf("ExecEnvAllowlist: got(%q) != want(%q)", ExecEnvAllowlist(), []string{"PATH", "LANG"})
+	}
+	if ExecUmask() != 027 {
+		t.Errorf("ExecUmask: got(%o) != want(%o)", ExecUmask(), 027)
+	}
 	if NumericProjectID() != 12345 {
 		t.Errorf("NumericProjectID: got(%v) != want(%d)", NumericProjectID(), 12345)
 	}
@@ -199,6 +247,24 @@ func TestSetConfigDefaultValues(t *testing.T) {
 	if SvcPollInterval().Minutes() != float64(osConfigPollIntervalDefault) {
 		t.Errorf("Default poll interval: got(%f) != want(%d)", SvcPollInterval().Minutes(), osConfigPollIntervalDefault)
 	}
+	if ExecStepTimeout().Minutes() != float64(execStepTimeoutDefault) {
+		t.Errorf("Default exec step timeout: got(%f) != want(%d)", ExecStepTimeout().Minutes(), execStepTimeoutDefault)
+	}
+	if MaxRebootCount() != maxRebootCountDefault {
+		t.Errorf("Default max reboot count: got(%d) != want(%d)", MaxRebootCount(), maxRebootCountDefault)
+	}
+	if MaxPatchAttempts() != maxPatchAttemptsDefault {
+		t.Errorf("Default max patch attempts: got(%d) != want(%d)", MaxPatchAttempts(), maxPatchAttemptsDefault)
+	}
+	if InventoryRefreshInterval().Minutes() != float64(inventoryRefreshDefault) {
+		t.Errorf("Default inventory refresh interval: got(%f) != want(%d)", InventoryRefreshInterval().Minutes(), inventoryRefreshDefault)
+	}
+	if ExecEnvAllowlist() != nil {
+		t.Errorf("Default exec env allowlist: got(%q) != want(nil)", ExecEnvAllowlist())
+	}
+	if ExecUmask() != -1 {
+		t.Errorf("Default exec umask: got(%o) != want(-1)", ExecUmask())
+	}
 
 	if SvcEndpoint() != prodEndpoint {
 		t.Errorf("Default endpoint: got(%s) != want(%s)", SvcEndpoint(), prodEndpoint)
@@ -0,0 +1,390 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	metadataProviderFlag = flag.String("metadata_provider", "gce", "metadata provider to use, one of: gce, file, fake")
+	metadataFile         = flag.String("metadata_file", "", "path to a JSON or YAML metadata file, used with -metadata_provider=file")
+
+	provider   MetadataProvider
+	providerMx sync.Mutex
+)
+
+// MetadataProvider provides instance metadata, identity tokens and access to
+// guest attributes.
+type MetadataProvider interface {
+	// Get returns the value of the metadata path suffix, relative to
+	// computeMetadata/v1/, e.g. "instance/attributes/foo".
+	Get(suffix string) (string, error)
+	// IdentityToken returns the instance identity token.
+	IdentityToken() (string, error)
+	// PutAttribute writes the value to the guest attribute at url.
+	PutAttribute(url string, value io.Reader) error
+}
+
+// Metadata returns the MetadataProvider selected by the metadata_provider
+// flag, or the one set by SetMetadataProvider. If the flags are invalid every
+// call to the returned provider fails, InitMetadataProvider reports the error
+// at startup.
+func Metadata() MetadataProvider {
+	providerMx.Lock()
+	defer providerMx.Unlock()
+	if provider == nil {
+		p, err := newMetadataProvider(*metadataProviderFlag, *metadataFile)
+		if err != nil {
+			return errMetadataProvider{err}
+		}
+		provider = p
+	}
+	return provider
+}
+
+// InitMetadataProvider selects the MetadataProvider from the
+// metadata_provider and metadata_file flags, it returns an error if they are
+// invalid.
+func InitMetadataProvider() error {
+	p, err := newMetadataProvider(*metadataProviderFlag, *metadataFile)
+	if err != nil {
+		return err
+	}
+	SetMetadataProvider(p)
+	return nil
+}
+
+// SetMetadataProvider overrides the MetadataProvider used by the agent.
+func SetMetadataProvider(p MetadataProvider) {
+	providerMx.Lock()
+	defer providerMx.Unlock()
+	provider = p
+
+	identity.Lock()
+	defer identity.Unlock()
+	identity.exp = nil
+}
+
+func newMetadataProvider(name, path string) (MetadataProvider, error) {
+	switch name {
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("-metadata_file is required with -metadata_provider=file")
+		}
+		return &FileMetadataProvider{Path: path}, nil
+	case "fake":
+		return &FakeMetadataProvider{}, nil
+	case "gce":
+		return GCEMetadataProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown -metadata_provider %q, want one of: gce, file, fake", name)
+	}
+}
+
+// errMetadataProvider is returned by Metadata if the flags are invalid.
+type errMetadataProvider struct {
+	err error
+}
+
+// Get implements MetadataProvider.
+func (p errMetadataProvider) Get(string) (string, error) {
+	return "", p.err
+}
+
+// IdentityToken implements MetadataProvider.
+func (p errMetadataProvider) IdentityToken() (string, error) {
+	return "", p.err
+}
+
+// PutAttribute implements MetadataProvider.
+func (p errMetadataProvider) PutAttribute(string, io.Reader) error {
+	return p.err
+}
+
+// GCEMetadataProvider reads from the GCE metadata server.
+type GCEMetadataProvider struct{}
+
+// Get implements MetadataProvider.
+func (GCEMetadataProvider) Get(suffix string) (string, error) {
+	return metadata.Get(suffix)
+}
+
+// IdentityToken implements MetadataProvider.
+func (GCEMetadataProvider) IdentityToken() (string, error) {
+	return metadata.Get(IdentityTokenPath)
+}
+
+// PutAttribute implements MetadataProvider.
+func (GCEMetadataProvider) PutAttribute(url string, value io.Reader) error {
+	req, err := http.NewRequest("PUT", url, value)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Metadata-Flavor", "Google")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, err := ioutil.ReadAll(resp.Body)
+		responseErr := fmt.Sprintf(`received status code %q for request "%s %s"`, resp.Status, req.Method, req.URL.String())
+		if err == nil {
+			responseErr = fmt.Sprintf("%s\n Error response: %s", responseErr, string(b))
+		}
+		return fmt.Errorf("%s", responseErr)
+	}
+	return nil
+}
+
+// FileMetadataProvider reads metadata from a local JSON or YAML file laid out
+// like the recursive metadata server response, for example:
+//
+//	{"instance": {"name": "foo", "attributes": {"enable-osconfig": "true"},
+//	 "serviceAccounts": {"default": {"identity": "<token>"}}}, "project": {...}}
+//
+// Guest attributes are written as files in a guest-attributes directory next
+// to the metadata file.
+type FileMetadataProvider struct {
+	Path string
+}
+
+func (p *FileMetadataProvider) read() (interface{}, error) {
+	d, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if ext := strings.ToLower(filepath.Ext(p.Path)); ext == ".yaml" || ext == ".yml" {
+		if err := yaml.Unmarshal(d, &v); err != nil {
+			return nil, fmt.Errorf("error parsing metadata file %s: %v", p.Path, err)
+		}
+		return normalizeYAML(v), nil
+	}
+	if err := json.Unmarshal(d, &v); err != nil {
+		return nil, fmt.Errorf("error parsing metadata file %s: %v", p.Path, err)
+	}
+	return v, nil
+}
+
+// Get implements MetadataProvider.
+func (p *FileMetadataProvider) Get(suffix string) (string, error) {
+	v, err := p.read()
+	if err != nil {
+		return "", err
+	}
+	return lookupMetadata(v, suffix)
+}
+
+// IdentityToken implements MetadataProvider.
+func (p *FileMetadataProvider) IdentityToken() (string, error) {
+	return p.Get(IdentityTokenPath)
+}
+
+// PutAttribute implements MetadataProvider.
+func (p *FileMetadataProvider) PutAttribute(u string, value io.Reader) error {
+	key, err := attributeKey(u)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(filepath.Dir(p.Path), "guest-attributes", filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var d []byte
+	if value != nil {
+		if d, err = ioutil.ReadAll(value); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, d, 0644)
+}
+
+// FakeMetadataProvider is an in-memory MetadataProvider.
+type FakeMetadataProvider struct {
+	// Values maps metadata path suffixes to their values, a value for
+	// "?recursive=true&alt=json" is used by SetConfig.
+	Values map[string]string
+	// Token is the identity token, if empty a token that never expires is
+	// generated.
+	Token string
+	// Attributes holds guest attributes written with PutAttribute keyed by
+	// their path below guest-attributes/.
+	Attributes map[string][]byte
+
+	mx sync.Mutex
+}
+
+// Get implements MetadataProvider.
+func (p *FakeMetadataProvider) Get(suffix string) (string, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	v, ok := p.Values[strings.TrimPrefix(suffix, "/")]
+	if !ok {
+		if suffix == "?recursive=true&alt=json" {
+			return "{}", nil
+		}
+		return "", metadata.NotDefinedError(suffix)
+	}
+	return v, nil
+}
+
+// IdentityToken implements MetadataProvider.
+func (p *FakeMetadataProvider) IdentityToken() (string, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if p.Token != "" {
+		return p.Token, nil
+	}
+	// An unsigned token with the claims we need to parse the expiry.
+	claims, err := json.Marshal(map[string]int64{"exp": time.Now().Add(24 * time.Hour).Unix()})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(claims) + ".", nil
+}
+
+// PutAttribute implements MetadataProvider.
+func (p *FakeMetadataProvider) PutAttribute(u string, value io.Reader) error {
+	key, err := attributeKey(u)
+	if err != nil {
+		return err
+	}
+	var d []byte
+	if value != nil {
+		if d, err = ioutil.ReadAll(value); err != nil {
+			return err
+		}
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if p.Attributes == nil {
+		p.Attributes = make(map[string][]byte)
+	}
+	p.Attributes[key] = d
+	return nil
+}
+
+// attributeKey returns the path of a guest attribute url below
+// guest-attributes/.
+func attributeKey(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	i := strings.Index(parsed.Path, "/guest-attributes/")
+	if i == -1 {
+		return "", fmt.Errorf("%q is not a guest attributes url", u)
+	}
+	return parsed.Path[i+len("/guest-attributes/"):], nil
+}
+
+// lookupMetadata walks v following the metadata path suffix. Path elements
+// match either the metadata server path form (service-accounts) or the
+// recursive JSON form (serviceAccounts).
+func lookupMetadata(v interface{}, suffix string) (string, error) {
+	path := suffix
+	var recursive bool
+	if i := strings.Index(path, "?"); i != -1 {
+		q, err := url.ParseQuery(path[i+1:])
+		if err != nil {
+			return "", err
+		}
+		recursive = q.Get("recursive") == "true"
+		path = path[:i]
+	}
+
+	for _, elem := range strings.Split(strings.Trim(path, "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", metadata.NotDefinedError(suffix)
+		}
+		next, ok := m[elem]
+		if !ok {
+			next, ok = m[camelCase(elem)]
+		}
+		if !ok {
+			return "", metadata.NotDefinedError(suffix)
+		}
+		v = next
+	}
+
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case map[string]interface{}, []interface{}:
+		if !recursive {
+			return "", metadata.NotDefinedError(suffix)
+		}
+		d, err := json.Marshal(t)
+		return string(d), err
+	default:
+		d, err := json.Marshal(t)
+		return string(d), err
+	}
+}
+
+func camelCase(s string) string {
+	parts := strings.Split(s, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values produced by
+// yaml.Unmarshal into map[string]interface{} so they can be JSON encoded.
+func normalizeYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalizeYAML(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
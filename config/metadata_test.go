@@ -0,0 +1,193 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMetadataYAML = `
+instance:
+  name: name
+  zone: zone
+  id: 12345
+  attributes:
+    enable-osconfig: "true"
+  serviceAccounts:
+    default:
+      identity: token
+project:
+  projectId: projectId
+`
+
+func TestFileMetadataProvider(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	jsonFile := filepath.Join(td, "metadata.json")
+	if err := ioutil.WriteFile(jsonFile, []byte(`{"instance": {"name": "name", "attributes": {"enable-osconfig": "true"}, "serviceAccounts": {"default": {"identity": "token"}}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	yamlFile := filepath.Join(td, "metadata.yaml")
+	if err := ioutil.WriteFile(yamlFile, []byte(testMetadataYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{jsonFile, yamlFile} {
+		p := &FileMetadataProvider{Path: path}
+
+		tests := []struct {
+			suffix string
+			want   string
+		}{
+			{"instance/name", "name"},
+			{"/instance/attributes/enable-osconfig", "true"},
+			{"instance/service-accounts/default/identity", "token"},
+		}
+		for _, tt := range tests {
+			got, err := p.Get(tt.suffix)
+			if err != nil {
+				t.Errorf("%s: Get(%q): unexpected error: %v", path, tt.suffix, err)
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("%s: Get(%q): want %q, got %q", path, tt.suffix, tt.want, got)
+			}
+		}
+
+		if _, err := p.Get("instance/attributes/foo"); err == nil {
+			t.Errorf("%s: expected error for missing key", path)
+		}
+		if _, err := p.Get("instance"); err == nil {
+			t.Errorf("%s: expected error for non recursive directory", path)
+		}
+
+		token, err := p.IdentityToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "token" {
+			t.Errorf("%s: unexpected identity token: %q", path, token)
+		}
+
+		if err := p.PutAttribute(ReportURL+"/guestInventory/Hostname", strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(td, "guest-attributes", "guestInventory", "Hostname"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "foo" {
+			t.Errorf("%s: unexpected guest attribute value: %q", path, got)
+		}
+	}
+}
+
+func TestSetConfigFileMetadataProvider(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	yamlFile := filepath.Join(td, "metadata.yaml")
+	if err := ioutil.WriteFile(yamlFile, []byte(testMetadataYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	SetMetadataProvider(&FileMetadataProvider{Path: yamlFile})
+	defer SetMetadataProvider(nil)
+
+	if err := SetConfig(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if Name() != "name" {
+		t.Errorf("Name: got(%s) != want(%s)", Name(), "name")
+	}
+	if ID() != "12345" {
+		t.Errorf("ID: got(%s) != want(%s)", ID(), "12345")
+	}
+	if ProjectID() != "projectId" {
+		t.Errorf("ProjectID: got(%s) != want(%s)", ProjectID(), "projectId")
+	}
+	if !TaskNotificationEnabled() {
+		t.Error("TaskNotificationEnabled: expected true")
+	}
+}
+
+func TestFakeMetadataProvider(t *testing.T) {
+	p := &FakeMetadataProvider{Values: map[string]string{"instance/attributes/foo": "bar"}}
+	SetMetadataProvider(p)
+	defer SetMetadataProvider(nil)
+
+	got, err := Metadata().Get("/instance/attributes/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "bar" {
+		t.Errorf("unexpected value: %q", got)
+	}
+	if _, err := Metadata().Get("instance/attributes/baz"); err == nil {
+		t.Error("expected error for missing key")
+	}
+
+	token, err := IDToken()
+	if err != nil {
+		t.Fatalf("unexpected error from IDToken: %v", err)
+	}
+	if token == "" {
+		t.Error("expected non empty token")
+	}
+
+	if err := Metadata().PutAttribute(ReportURL+"/guestInventory/Hostname", strings.NewReader("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Attributes["guestInventory/Hostname"]) != "foo" {
+		t.Errorf("unexpected attributes: %q", p.Attributes)
+	}
+}
+
+func TestNewMetadataProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    MetadataProvider
+		wantErr bool
+	}{
+		{"gce", "", GCEMetadataProvider{}, false},
+		{"fake", "", &FakeMetadataProvider{}, false},
+		{"file", "metadata.json", &FileMetadataProvider{Path: "metadata.json"}, false},
+		{"file", "", nil, true},
+		{"foo", "", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := newMetadataProvider(tt.name, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newMetadataProvider(%q, %q): want error %t, got: %v", tt.name, tt.path, tt.wantErr, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newMetadataProvider(%q, %q): want %#v, got %#v", tt.name, tt.path, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package execenv configures the user, environment, working directory and
+// umask that exec steps and recipe scripts are run with.
+package execenv
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/config"
+)
+
+var (
+	lookupUser  = lookupUserByNameOrID
+	lookupGroup = lookupGroupByNameOrID
+)
+
+// Options describe the environment a command is run in.
+type Options struct {
+	// User and Group to run the command as, if User is empty the agent
+	// user is used, if Group is empty the primary group of User is used.
+	User, Group string
+	// EnvAllowlist lists the variables FilterEnv keeps, nil keeps all.
+	EnvAllowlist []string
+	// Env holds additional KEY=VALUE pairs to set, for example task
+	// variables.
+	Env []string
+	// Dir is the working directory, if empty it is not changed.
+	Dir string
+	// Umask is set for the command if not negative.
+	Umask int
+}
+
+// FromConfig returns Options from the agent config.
+func FromConfig() Options {
+	return Options{
+		User:         config.ExecUser(),
+		Group:        config.ExecGroup(),
+		EnvAllowlist: config.ExecEnvAllowlist(),
+		Dir:          config.ExecWorkingDir(),
+		Umask:        config.ExecUmask(),
+	}
+}
+
+// FilterEnv returns the entries of env whose name is in the allowlist, if
+// there is no allowlist env is returned unchanged.
+func (o Options) FilterEnv(env []string) []string {
+	if o.EnvAllowlist == nil {
+		return env
+	}
+
+	ret := []string{}
+	for _, e := range env {
+		name := strings.SplitN(e, "=", 2)[0]
+		for _, a := range o.EnvAllowlist {
+			if name == a || (runtime.GOOS == "windows" && strings.EqualFold(name, a)) {
+				ret = append(ret, e)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Apply configures cmd to run with the options. cmd.Env, if set, should
+// already hold the filtered base environment, o.Env and the environment of
+// User are added to it.
+func (o Options) Apply(cmd *exec.Cmd) error {
+	if o.Dir != "" {
+		cmd.Dir = o.Dir
+	}
+
+	var env []string
+	if o.User != "" {
+		u, err := lookupUser(o.User)
+		if err != nil {
+			return err
+		}
+		env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+	env = append(env, o.Env...)
+	if cmd.Env == nil {
+		cmd.Env = o.FilterEnv(os.Environ())
+	}
+	cmd.Env = append(cmd.Env, env...)
+
+	return o.apply(cmd)
+}
+
+// Chown changes the owner of path to User and Group so the command can use
+// it, nothing is done if neither is set.
+func (o Options) Chown(path string) error {
+	if o.User == "" && o.Group == "" {
+		return nil
+	}
+	return o.chown(path)
+}
+
+// CheckDir returns an error if User and Group can not read, write and enter
+// the directory path, nothing is checked if neither is set. Unlike Chown it
+// never changes the directory.
+func (o Options) CheckDir(path string) error {
+	if o.User == "" && o.Group == "" {
+		return nil
+	}
+	return o.checkDir(path)
+}
+
+func lookupUserByNameOrID(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err == nil {
+		return u, nil
+	}
+	if u, err := user.LookupId(name); err == nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("error looking up user %q: %v", name, err)
+}
+
+func lookupGroupByNameOrID(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if err == nil {
+		return g, nil
+	}
+	if g, err := user.LookupGroupId(name); err == nil {
+		return g, nil
+	}
+	return nil, fmt.Errorf("error looking up group %q: %v", name, err)
+}
@@ -0,0 +1,142 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package execenv
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// sh is used to set the umask before executing the command.
+var sh = "/bin/sh"
+
+func (o Options) apply(cmd *exec.Cmd) error {
+	cred, err := o.credential()
+	if err != nil {
+		return err
+	}
+	if cred != nil {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	if o.Umask >= 0 {
+		// There is no way to set the umask of only the child process, so
+		// set it in a shell that then replaces itself with the command.
+		args := []string{sh, "-c", fmt.Sprintf(`umask %04o && exec "$0" "$@"`, o.Umask), cmd.Path}
+		cmd.Args = append(args, cmd.Args[1:]...)
+		cmd.Path = sh
+	}
+	return nil
+}
+
+func (o Options) credential() (*syscall.Credential, error) {
+	if o.User == "" && o.Group == "" {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if o.User != "" {
+		u, err := lookupUser(o.User)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %q for user %q: %v", u.Uid, o.User, err)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %q for user %q: %v", u.Gid, o.User, err)
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+
+		gids, err := u.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("error looking up groups for user %q: %v", o.User, err)
+		}
+		for _, g := range gids {
+			gid, err := strconv.ParseUint(g, 10, 32)
+			if err != nil {
+				continue
+			}
+			cred.Groups = append(cred.Groups, uint32(gid))
+		}
+	}
+	if o.Group != "" {
+		g, err := lookupGroup(o.Group)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %q for group %q: %v", g.Gid, o.Group, err)
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+func (o Options) chown(path string) error {
+	cred, err := o.credential()
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, int(cred.Uid), int(cred.Gid))
+}
+
+func (o Options) checkDir(path string) error {
+	cred, err := o.credential()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("can not read the owner of %s", path)
+	}
+	if !fi.IsDir() || !canUse(fi.Mode().Perm(), st.Uid, st.Gid, cred) {
+		return fmt.Errorf("%s is not a directory that uid %d gid %d can read, write and enter", path, cred.Uid, cred.Gid)
+	}
+	return nil
+}
+
+// canUse reports whether cred has read, write and execute permission on a
+// file with mode perm owned by uid and gid.
+func canUse(perm os.FileMode, uid, gid uint32, cred *syscall.Credential) bool {
+	const rwx = 07
+	switch {
+	case cred.Uid == 0:
+		return true
+	case cred.Uid == uid:
+		return (perm>>6)&rwx == rwx
+	}
+	inGroup := cred.Gid == gid
+	for _, g := range cred.Groups {
+		inGroup = inGroup || g == gid
+	}
+	if inGroup {
+		return (perm>>3)&rwx == rwx
+	}
+	return perm&rwx == rwx
+}
@@ -0,0 +1,146 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package execenv
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCredential(t *testing.T) {
+	lookupUser = func(name string) (*user.User, error) {
+		// GroupIds is not mockable, use the current user for a valid
+		// lookup and override the ids.
+		u, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		u.Username, u.Uid, u.Gid = name, "1234", "5678"
+		return u, nil
+	}
+	lookupGroup = func(name string) (*user.Group, error) {
+		return &user.Group{Name: name, Gid: "4321"}, nil
+	}
+	defer func() {
+		lookupUser = lookupUserByNameOrID
+		lookupGroup = lookupGroupByNameOrID
+	}()
+
+	tests := []struct {
+		name    string
+		o       Options
+		wantUID uint32
+		wantGID uint32
+	}{
+		{"User", Options{User: "foo", Umask: -1}, 1234, 5678},
+		{"UserAndGroup", Options{User: "foo", Group: "bar", Umask: -1}, 1234, 4321},
+		{"Group", Options{Group: "bar", Umask: -1}, uint32(os.Getuid()), 4321},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("foo")
+			if err := tt.o.Apply(cmd); err != nil {
+				t.Fatal(err)
+			}
+			cred := cmd.SysProcAttr.Credential
+			if cred.Uid != tt.wantUID || cred.Gid != tt.wantGID {
+				t.Errorf("unexpected credential, want uid: %d gid: %d, got uid: %d gid: %d", tt.wantUID, tt.wantGID, cred.Uid, cred.Gid)
+			}
+		})
+	}
+
+	cmd := exec.Command("foo")
+	if err := (Options{Umask: -1}).Apply(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.SysProcAttr != nil {
+		t.Errorf("expected no SysProcAttr to be set, got: %+v", cmd.SysProcAttr)
+	}
+}
+
+func TestApplyUmask(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "umask")
+	if err := (Options{Umask: 027}).Apply(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{sh, "-c", `umask 0027 && exec "$0" "$@"`, "/bin/sh", "-c", "umask"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("unexpected args, want: %q, got: %q", want, cmd.Args)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "0027" {
+		t.Errorf("unexpected umask, want: %q, got: %q", "0027", got)
+	}
+}
+
+func TestRunAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skipf("no nobody user: %v", err)
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", "id -u; id -g")
+	if err := (Options{User: "nobody", Umask: -1}).Apply(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("error running command: %v", err)
+	}
+	if want := u.Uid + "\n" + u.Gid + "\n"; string(out) != want {
+		t.Errorf("unexpected ids, want: %q, got: %q", want, out)
+	}
+	if cmd.SysProcAttr.Credential.Uid == 0 {
+		t.Error("expected a non root uid")
+	}
+}
+
+func TestCanUse(t *testing.T) {
+	cred := &syscall.Credential{Uid: 1000, Gid: 1000, Groups: []uint32{1000, 50}}
+	tests := []struct {
+		name     string
+		perm     os.FileMode
+		uid, gid uint32
+		want     bool
+	}{
+		{"Owner", 0700, 1000, 0, true},
+		{"OwnerNoWrite", 0555, 1000, 0, false},
+		{"Group", 0770, 0, 1000, true},
+		{"SupplementaryGroup", 0070, 0, 50, true},
+		{"GroupNoWrite", 0750, 0, 50, false},
+		{"Other", 0777, 0, 0, true},
+		{"RootOwned", 0755, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canUse(tt.perm, tt.uid, tt.gid, cred); got != tt.want {
+				t.Errorf("canUse(%o, %d, %d) = %t, want %t", tt.perm, tt.uid, tt.gid, got, tt.want)
+			}
+		})
+	}
+	if !canUse(0700, 1000, 1000, &syscall.Credential{Uid: 0}) {
+		t.Error("root should be able to use any directory")
+	}
+}
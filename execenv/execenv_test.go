@@ -0,0 +1,72 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package execenv
+
+import (
+	"os/exec"
+	"os/user"
+	"reflect"
+	"testing"
+)
+
+func TestFilterEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "HOME=/root", "SECRET=foo", "LANG=C"}
+	tests := []struct {
+		name      string
+		allowlist []string
+		want      []string
+	}{
+		{"NoAllowlist", nil, env},
+		{"EmptyAllowlist", []string{}, []string{}},
+		{"Allowlist", []string{"PATH", "LANG", "MISSING"}, []string{"PATH=/bin", "LANG=C"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Options{EnvAllowlist: tt.allowlist}.FilterEnv(env)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	lookupUser = func(name string) (*user.User, error) {
+		return &user.User{Username: name, Uid: "1234", Gid: "5678", HomeDir: "/home/" + name}, nil
+	}
+	defer func() { lookupUser = lookupUserByNameOrID }()
+
+	cmd := exec.Command("foo")
+	cmd.Env = []string{"PATH=/bin"}
+	o := Options{Env: []string{"TASK_ID=bar"}, Dir: "/tmp/work", Umask: -1}
+	if err := o.Apply(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"PATH=/bin", "TASK_ID=bar"}; !reflect.DeepEqual(cmd.Env, want) {
+		t.Errorf("unexpected env, want: %q, got: %q", want, cmd.Env)
+	}
+	if cmd.Dir != "/tmp/work" {
+		t.Errorf("unexpected Dir, want: %q, got: %q", "/tmp/work", cmd.Dir)
+	}
+
+	cmd = exec.Command("foo")
+	o = Options{User: "baz", EnvAllowlist: []string{}, Umask: -1}
+	// Running as a different user is not supported on all systems, we only
+	// check the environment here.
+	o.Apply(cmd)
+	if want := []string{"HOME=/home/baz", "USER=baz", "LOGNAME=baz"}; !reflect.DeepEqual(cmd.Env, want) {
+		t.Errorf("unexpected env, want: %q, got: %q", want, cmd.Env)
+	}
+}
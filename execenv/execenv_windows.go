@@ -0,0 +1,39 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// +build windows
+
+package execenv
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errWindowsUser = errors.New("running as a different user or group is not supported on Windows")
+
+func (o Options) apply(cmd *exec.Cmd) error {
+	if o.User != "" || o.Group != "" {
+		return errWindowsUser
+	}
+	return nil
+}
+
+func (o Options) chown(path string) error {
+	return errWindowsUser
+}
+
+func (o Options) checkDir(path string) error {
+	return errWindowsUser
+}
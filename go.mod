@@ -21,4 +21,5 @@ require (
 	google.golang.org/api v0.15.0
 	google.golang.org/genproto v0.0.0-20200115191322-ca5a22157cba
 	google.golang.org/grpc v1.26.0
+	gopkg.in/yaml.v2 v2.2.2
 )
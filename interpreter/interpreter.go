@@ -0,0 +1,147 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package interpreter resolves the command used to run a script, it is shared
+// by exec steps and software recipes.
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Interpreter is an interpreter a script can be run with.
+type Interpreter string
+
+const (
+	// Default runs the script with the interpreter named by its shebang
+	// line or file extension, or runs it directly if there is neither.
+	Default Interpreter = ""
+	// Shell runs the script with /bin/sh, or with the shell named by the
+	// shebang line of the script.
+	Shell Interpreter = "sh"
+	// Bash runs the script with bash.
+	Bash Interpreter = "bash"
+	// Python3 runs the script with python3.
+	Python3 Interpreter = "python3"
+)
+
+// maxShebangLength is the longest shebang line that is read.
+const maxShebangLength = 512
+
+var (
+	sh = "/bin/sh"
+
+	// shells are the interpreters a shebang line can select for Shell.
+	shells = map[string]bool{"sh": true, "bash": true, "dash": true, "ksh": true, "zsh": true}
+
+	extensions = map[string]Interpreter{
+		".sh":   Shell,
+		".bash": Bash,
+		".py":   Python3,
+	}
+)
+
+// Find returns the path of the named interpreter, name may be an absolute
+// path or a command to look up in PATH.
+func Find(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("interpreter %q not found: %v", name, err)
+	}
+	return path, nil
+}
+
+// Shebang returns the interpreter and arguments from the shebang line of the
+// script at path, it returns nil if the script has no shebang line.
+func Shebang(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseShebang(f)
+}
+
+func parseShebang(r io.Reader) ([]string, error) {
+	line, err := bufio.NewReader(io.LimitReader(r, maxShebangLength)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return nil, nil
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// Command returns the command and arguments used to run the script at path
+// with interpreter i, the interpreter is validated to exist.
+func Command(i Interpreter, path string) (string, []string, error) {
+	shebang, err := Shebang(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", nil, fmt.Errorf("error reading script %q: %v", path, err)
+	}
+
+	switch i {
+	case Default:
+		if shebang != nil {
+			return shebangCommand(shebang, path)
+		}
+		if ext, ok := extensions[strings.ToLower(filepath.Ext(path))]; ok {
+			return Command(ext, path)
+		}
+		return path, nil, nil
+	case Shell:
+		if shebang != nil && shells[filepath.Base(shebang[0])] {
+			return shebangCommand(shebang, path)
+		}
+		cmd, err := Find(sh)
+		if err != nil {
+			return "", nil, err
+		}
+		return cmd, []string{path}, nil
+	case Bash, Python3:
+		cmd, err := Find(string(i))
+		if err != nil {
+			return "", nil, err
+		}
+		return cmd, []string{path}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported interpreter %q", i)
+	}
+}
+
+// shebangCommand resolves the interpreter from a shebang line, "/usr/bin/env
+// name" is resolved to the path of name so a missing interpreter can be
+// reported before the script is run.
+func shebangCommand(shebang []string, path string) (string, []string, error) {
+	name, args := shebang[0], shebang[1:]
+	if filepath.Base(name) == "env" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, err := Find(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("script %q: %v", path, err)
+	}
+	return cmd, append(append([]string(nil), args...), path), nil
+}
@@ -0,0 +1,130 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package interpreter
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseShebang(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"None", "echo foo\n", nil},
+		{"Empty", "", nil},
+		{"EmptyShebang", "#!\n", nil},
+		{"Path", "#!/bin/bash\necho foo\n", []string{"/bin/bash"}},
+		{"Args", "#! /bin/sh -e\r\n", []string{"/bin/sh", "-e"}},
+		{"Env", "#!/usr/bin/env python3", []string{"/usr/bin/env", "python3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShebang(strings.NewReader(tt.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts are run with cmd or PowerShell on Windows")
+	}
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	envSh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		interp   Interpreter
+		file     string
+		script   string
+		wantCmd  string
+		wantArgs []string
+		wantErr  string
+	}{
+		{"DefaultNoShebang", Default, "script", "echo foo", "script", nil, ""},
+		{"DefaultMissingScript", Default, "", "", "missing", nil, ""},
+		{"DefaultShebang", Default, "script", "#!/bin/sh -e\necho foo", "/bin/sh", []string{"-e", "script"}, ""},
+		{"DefaultEnvShebang", Default, "script", "#!/usr/bin/env sh\necho foo", envSh, []string{"script"}, ""},
+		{"DefaultExtension", Default, "script.sh", "echo foo", "/bin/sh", []string{"script.sh"}, ""},
+		{"DefaultMissingInterpreter", Default, "script", "#!/does/not/exist\necho foo", "", nil, "not found"},
+		{"DefaultMissingEnvInterpreter", Default, "script", "#!/usr/bin/env doesnotexist\necho foo", "", nil, `"doesnotexist" not found`},
+		{"Shell", Shell, "script", "echo foo", "/bin/sh", []string{"script"}, ""},
+		{"ShellShebang", Shell, "script", "#!/bin/sh -x\necho foo", "/bin/sh", []string{"-x", "script"}, ""},
+		{"ShellIgnoresNonShellShebang", Shell, "script", "#!/usr/bin/python3\nprint('foo')", "/bin/sh", []string{"script"}, ""},
+		{"Unsupported", Interpreter("foo"), "script", "echo foo", "", nil, "unsupported interpreter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(td, tt.wantCmd)
+			if tt.file != "" {
+				path = filepath.Join(td, tt.file)
+				if err := ioutil.WriteFile(path, []byte(tt.script), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Script paths in the expectations are relative to td.
+			wantCmd := tt.wantCmd
+			if wantCmd == tt.file || (tt.file == "" && wantCmd != "") {
+				wantCmd = path
+			}
+			var wantArgs []string
+			for _, a := range tt.wantArgs {
+				if a == tt.file {
+					a = path
+				}
+				wantArgs = append(wantArgs, a)
+			}
+
+			cmd, args, err := Command(tt.interp, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cmd != wantCmd {
+				t.Errorf("unexpected command, want: %q, got: %q", wantCmd, cmd)
+			}
+			if !reflect.DeepEqual(args, wantArgs) {
+				t.Errorf("unexpected args, want: %q, got: %q", wantArgs, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+// Inventory sections that can be selected with GetSections.
+const (
+	SectionOSInfo    = "osinfo"
+	SectionInstalled = "installed"
+	SectionUpdates   = "updates"
+)
+
+var csvHeader = []string{"section", "manager", "name", "arch", "version", "details", "epoch", "release", "source", "vendor", "install_time"}
+
+// GetSections generates the inventory data of the given sections, all of
+// them if none are given. Unlike Run it does not need the agent config or
+// metadata access. If gathering the packages failed the inventory is returned
+// with the error, its package fields are incomplete.
+func GetSections(sections ...string) (*InstanceInventory, error) {
+	want := map[string]bool{}
+	for _, s := range sections {
+		switch s {
+		case SectionOSInfo, SectionInstalled, SectionUpdates:
+			want[s] = true
+		default:
+			return nil, fmt.Errorf("unknown inventory section %q, want one of %s, %s, %s", s, SectionOSInfo, SectionInstalled, SectionUpdates)
+		}
+	}
+	all := len(want) == 0
+
+	var errs []string
+	hs := &InstanceInventory{}
+	if all || want[SectionOSInfo] {
+		hs = getOSInfo()
+	}
+	if all || want[SectionInstalled] {
+		installedPackages, err := getInstalledPackages()
+		if err != nil {
+			logger.Errorf("packages.GetInstalledPackages() error: %v", err)
+			errs = append(errs, err.Error())
+		}
+		hs.InstalledPackages = installedPackages
+	}
+	if all || want[SectionUpdates] {
+		packageUpdates, err := getPackageUpdates()
+		if err != nil {
+			logger.Errorf("packages.GetPackageUpdates() error: %v", err)
+			errs = append(errs, err.Error())
+		}
+		hs.PackageUpdates = packageUpdates
+	}
+	hs.LastUpdated = time.Now().UTC().Format(time.RFC3339)
+
+	if errs != nil {
+		return hs, errors.New(strings.Join(errs, ", "))
+	}
+	return hs, nil
+}
+
+// CheckFormat returns an error if Export does not support format.
+func CheckFormat(format string) error {
+	switch format {
+	case "json", "csv":
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, want json or csv", format)
+	}
+}
+
+// Export writes inv to w in format json or csv. The csv output has a row per
+// OS info field and per package, see csvHeader for the columns.
+func Export(w io.Writer, inv *InstanceInventory, format string) error {
+	switch format {
+	case "json":
+		d, err := json.MarshalIndent(inv, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", d)
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		e := reflect.ValueOf(inv).Elem()
+		t := e.Type()
+		for i := 0; i < e.NumField(); i++ {
+			if f := e.Field(i); f.Kind() == reflect.String && f.String() != "" {
+				cw.Write(csvRow(SectionOSInfo, "", t.Field(i).Name, "", "", f.String()))
+			}
+		}
+		writePackagesCSV(cw, SectionInstalled, inv.InstalledPackages)
+		writePackagesCSV(cw, SectionUpdates, inv.PackageUpdates)
+		cw.Flush()
+		return cw.Error()
+	default:
+		return CheckFormat(format)
+	}
+}
+
+// csvRow pads fields with empty columns to the length of csvHeader.
+func csvRow(fields ...string) []string {
+	return append(fields, make([]string, len(csvHeader)-len(fields))...)
+}
+
+func writePackagesCSV(cw *csv.Writer, section string, pkgs packages.Packages) {
+	e := reflect.ValueOf(pkgs)
+	t := e.Type()
+	for i := 0; i < e.NumField(); i++ {
+		manager := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		f := e.Field(i)
+		for j := 0; j < f.Len(); j++ {
+			switch p := f.Index(j).Interface().(type) {
+			case packages.PkgInfo:
+				var installTime string
+				if p.InstallTime != nil {
+					installTime = p.InstallTime.Format(time.RFC3339)
+				}
+				cw.Write([]string{section, manager, p.Name, p.Arch, p.Version, "", p.Epoch, p.Release, p.Source, p.Vendor, installTime})
+			case packages.ZypperPatch:
+				cw.Write(csvRow(section, manager, p.Name, "", "", fmt.Sprintf("%s %s: %s", p.Category, p.Severity, p.Summary)))
+			case packages.WUAPackage:
+				cw.Write(csvRow(section, manager, p.Title, "", "", strings.Join(p.KBArticleIDs, " ")))
+			case packages.QFEPackage:
+				cw.Write(csvRow(section, manager, p.HotFixID, "", "", p.Description))
+			case packages.ContainerImage:
+				name := p.Repository
+				if p.Namespace != "" {
+					name = p.Namespace + "/" + name
+				}
+				cw.Write(csvRow(section, p.Runtime, name, "", p.Tag, strings.TrimSpace(p.ID+" "+p.Digest)))
+			}
+		}
+	}
+}
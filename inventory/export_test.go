@@ -0,0 +1,113 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+func TestExport(t *testing.T) {
+	installTime := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	inv := &InstanceInventory{
+		Hostname:  "Hostname",
+		ShortName: "ShortName",
+		InstalledPackages: packages.Packages{
+			Deb:           []packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "5.0-4", Release: "4", Source: "bash", InstallTime: &installTime}},
+			ZypperPatches: []packages.ZypperPatch{{Name: "patch", Category: "security", Severity: "important", Summary: "fix, things"}},
+			ContainerImages: []packages.ContainerImage{
+				{Runtime: "containerd", Namespace: "k8s.io", Repository: "docker.io/library/redis", Tag: "alpine", Digest: "sha256:1234"},
+			},
+		},
+		PackageUpdates: packages.Packages{
+			WUA: []packages.WUAPackage{{Title: "update", KBArticleIDs: []string{"1", "2"}}},
+			QFE: []packages.QFEPackage{{HotFixID: "KB123", Description: "Security Update"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, inv, "csv"); err != nil {
+		t.Fatalf("Export csv: %v", err)
+	}
+	want := `section,manager,name,arch,version,details,epoch,release,source,vendor,install_time
+osinfo,,Hostname,,,Hostname,,,,,
+osinfo,,ShortName,,,ShortName,,,,,
+installed,deb,bash,x86_64,5.0-4,,,4,bash,,2020-05-01T00:00:00Z
+installed,zypperPatches,patch,,,"security important: fix, things",,,,,
+installed,containerd,k8s.io/docker.io/library/redis,,alpine,sha256:1234,,,,,
+updates,wua,update,,,1 2,,,,,
+updates,qfe,KB123,,,Security Update,,,,,
+`
+	if buf.String() != want {
+		t.Errorf("csv output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, inv, "json"); err != nil {
+		t.Fatalf("Export json: %v", err)
+	}
+	var got InstanceInventory
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("json output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(&got, inv) {
+		t.Errorf("json output = %+v, want %+v", got, inv)
+	}
+
+	if err := Export(&buf, inv, "xml"); err == nil {
+		t.Error("Export xml: expected error")
+	}
+}
+
+func TestGetSectionsUnknown(t *testing.T) {
+	if _, err := GetSections(SectionOSInfo, "foo"); err == nil {
+		t.Error("expected error for unknown section")
+	}
+}
+
+func TestGetSectionsPackageError(t *testing.T) {
+	defer func() {
+		getInstalledPackages = packages.GetInstalledPackages
+		getPackageUpdates = packages.GetPackageUpdates
+	}()
+	installed := packages.Packages{Deb: []packages.PkgInfo{{Name: "bash", Arch: "x86_64", Version: "5.0-4"}}}
+	getInstalledPackages = func() (packages.Packages, error) { return installed, nil }
+	getPackageUpdates = func() (packages.Packages, error) { return packages.Packages{}, errors.New("apt-get update failed") }
+
+	inv, err := GetSections(SectionInstalled, SectionUpdates)
+	if err == nil {
+		t.Error("expected error when gathering package updates fails")
+	}
+	if inv == nil || !reflect.DeepEqual(inv.InstalledPackages, installed) {
+		t.Errorf("expected the gathered packages to be returned with the error, got %+v", inv)
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	for _, format := range []string{"json", "csv"} {
+		if err := CheckFormat(format); err != nil {
+			t.Errorf("CheckFormat(%q): unexpected error: %v", format, err)
+		}
+	}
+	if err := CheckFormat("xml"); err == nil {
+		t.Error("CheckFormat(xml): expected error")
+	}
+}
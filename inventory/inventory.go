@@ -17,7 +17,13 @@
 package inventory
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -32,8 +38,37 @@ import (
 
 const (
 	inventoryURL = config.ReportURL + "/guestInventory"
+
+	// packageRetryInterval is how long packages are not gathered after
+	// gathering them failed, so a collector that keeps failing does not turn
+	// every run into a full refresh.
+	packageRetryInterval = 15 * time.Minute
+)
+
+// packageDBFiles change when packages are installed, updated or removed.
+var packageDBFiles = []string{
+	"/var/lib/dpkg/status",
+	"/var/lib/rpm/Packages",
+	"/var/lib/rpm/Packages.db",
+	"/var/lib/rpm/rpmdb.sqlite",
+	// Changes to the sqlite rpmdb are only written to rpmdb.sqlite on a
+	// checkpoint, new files change the directory.
+	"/var/lib/rpm/rpmdb.sqlite-wal",
+	"/var/lib/rpm",
+	"/var/lib/snapd/state.json",
+	"/var/lib/flatpak/.changed",
+	"/var/lib/docker/image/overlay2/repositories.json",
+}
+
+var (
+	getInstalledPackages = packages.GetInstalledPackages
+	getPackageUpdates    = packages.GetPackageUpdates
+	refreshInterval      = config.InventoryRefreshInterval
 )
 
+// packageFields are only gathered on a full refresh.
+var packageFields = map[string]bool{"InstalledPackages": true, "PackageUpdates": true, "LastUpdated": true}
+
 // InstanceInventory is an instances inventory data.
 type InstanceInventory struct {
 	Hostname             string
@@ -49,45 +84,125 @@ type InstanceInventory struct {
 	LastUpdated          string
 }
 
-func write(state *InstanceInventory, url string) {
+// inventoryState is what was last reported, it is kept on disk so unchanged
+// fields are not posted again.
+type inventoryState struct {
+	// InstanceID guards against a disk being moved to another instance.
+	InstanceID string
+	// LastRefresh is when the package fields were last gathered.
+	LastRefresh time.Time
+	// PackageDBModTime is the newest modification time of packageDBFiles.
+	PackageDBModTime time.Time
+	// LastFailure is when gathering the packages last failed.
+	LastFailure time.Time
+	// Hashes are the hashes of the posted fields by name.
+	Hashes map[string]string
+}
+
+func loadState(path string) *inventoryState {
+	st := &inventoryState{}
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warningf("Error reading inventory state: %v", err)
+		}
+		return st
+	}
+	if err := json.Unmarshal(d, st); err != nil {
+		logger.Warningf("Error parsing inventory state, reporting the full inventory: %v", err)
+		return &inventoryState{}
+	}
+	return st
+}
+
+func saveState(path string, st *inventoryState) error {
+	d, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, d, 0644)
+}
+
+// packageDBModTime returns the newest modification time of files, missing
+// files are ignored.
+func packageDBModTime(files []string) time.Time {
+	var newest time.Time
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	return newest
+}
+
+func hash(f reflect.Value) (string, error) {
+	var d []byte
+	if f.Kind() == reflect.String {
+		d = []byte(f.String())
+	} else {
+		var err error
+		if d, err = json.Marshal(f.Interface()); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(d)), nil
+}
+
+// write posts the fields of state, fields in skip are not posted. If hashes
+// is not nil fields whose hash matches are not posted either, and the hashes
+// of the posted fields are recorded.
+func write(state *InstanceInventory, url string, hashes map[string]string, skip map[string]bool) {
 	logger.Debugf("Writing instance inventory.")
 
 	e := reflect.ValueOf(state).Elem()
 	t := e.Type()
 	for i := 0; i < e.NumField(); i++ {
 		f := e.Field(i)
-		u := fmt.Sprintf("%s/%s", url, t.Field(i).Name)
+		name := t.Field(i).Name
+		if skip[name] {
+			continue
+		}
+		h, err := hash(f)
+		if err != nil {
+			logger.Errorf("Error hashing inventory field %s: %v", name, err)
+		}
+		if hashes != nil && h != "" && hashes[name] == h {
+			logger.Debugf("Inventory field %s did not change, not posting it.", name)
+			continue
+		}
+
+		u := fmt.Sprintf("%s/%s", url, name)
 		switch f.Kind() {
 		case reflect.String:
 			logger.Debugf("postAttribute %s: %+v", u, f)
-			if err := attributes.PostAttribute(u, strings.NewReader(f.String())); err != nil {
+			err = attributes.PostAttribute(u, strings.NewReader(f.String()))
+			if err != nil {
 				logger.Errorf("postAttribute error: %v", err)
 			}
 		case reflect.Struct:
 			logger.Debugf("postAttributeCompressed %s: %+v", u, f)
-			if err := attributes.PostAttributeCompressed(u, f.Interface()); err != nil {
+			err = attributes.PostAttributeCompressed(u, f.Interface())
+			if err != nil {
 				logger.Errorf("postAttributeCompressed error: %v", err)
 			}
 		}
+		if err == nil && hashes != nil {
+			hashes[name] = h
+		}
 	}
 }
 
-// Get generates inventory data.
-func Get() *InstanceInventory {
-	logger.Debugf("Gathering instance inventory.")
-
+// getOSInfo generates the inventory data other than packages.
+func getOSInfo() *InstanceInventory {
 	hs := &InstanceInventory{}
 
-	installedPackages, err := packages.GetInstalledPackages()
-	if err != nil {
-		logger.Errorf("packages.GetInstalledPackages() error: %v", err)
-	}
-
-	packageUpdates, err := packages.GetPackageUpdates()
-	if err != nil {
-		logger.Errorf("packages.GetPackageUpdates() error: %v", err)
-	}
-
 	oi, err := osinfo.Get()
 	if err != nil {
 		logger.Errorf("osinfo.Get() error: %v", err)
@@ -101,15 +216,103 @@ func Get() *InstanceInventory {
 	hs.KernelRelease = oi.KernelRelease
 	hs.Architecture = oi.Architecture
 	hs.OSConfigAgentVersion = config.Version()
+
+	return hs
+}
+
+// Get generates inventory data.
+func Get() *InstanceInventory {
+	hs, _ := get()
+	return hs
+}
+
+// get gathers the instance inventory, the error reports that gathering the
+// packages failed and the package fields are incomplete.
+func get() (*InstanceInventory, error) {
+	logger.Debugf("Gathering instance inventory.")
+
+	var errs []string
+	installedPackages, err := getInstalledPackages()
+	if err != nil {
+		logger.Errorf("packages.GetInstalledPackages() error: %v", err)
+		errs = append(errs, err.Error())
+	}
+
+	packageUpdates, err := getPackageUpdates()
+	if err != nil {
+		logger.Errorf("packages.GetPackageUpdates() error: %v", err)
+		errs = append(errs, err.Error())
+	}
+
+	hs := getOSInfo()
 	hs.InstalledPackages = installedPackages
 	hs.PackageUpdates = packageUpdates
 
 	hs.LastUpdated = time.Now().UTC().Format(time.RFC3339)
 
-	return hs
+	if errs != nil {
+		return hs, errors.New(strings.Join(errs, ", "))
+	}
+	return hs, nil
+}
+
+// run reports the inventory fields that changed since the last run. Packages
+// are only gathered every InventoryRefreshInterval or when the package
+// database changed, as listing updates refreshes the package manager cache.
+func run(url, stateFile string) {
+	st := loadState(stateFile)
+	if st.InstanceID != config.ID() {
+		st = &inventoryState{InstanceID: config.ID()}
+	}
+	if st.Hashes == nil {
+		st.Hashes = make(map[string]string)
+	}
+
+	// Packages are gathered again after packageRetryInterval, or the refresh
+	// interval if that is shorter, if gathering them failed.
+	interval := refreshInterval()
+	retry := packageRetryInterval
+	if interval < retry {
+		retry = interval
+	}
+	dbModTime := packageDBModTime(packageDBFiles)
+	var hs *InstanceInventory
+	var skip map[string]bool
+	var err error
+	switch {
+	case time.Since(st.LastFailure) < retry:
+		logger.Debugf("Gathering packages failed at %s, gathering instance inventory without packages.", st.LastFailure.Format(time.RFC3339))
+		hs = getOSInfo()
+		skip = packageFields
+	case time.Since(st.LastRefresh) >= interval:
+		// Every field is posted on a full refresh, guest attributes deleted
+		// since they were posted would otherwise never be posted again.
+		st.Hashes = make(map[string]string)
+		if hs, err = get(); err == nil {
+			st.LastRefresh = time.Now()
+			st.PackageDBModTime = dbModTime
+		}
+	case !dbModTime.Equal(st.PackageDBModTime):
+		logger.Debugf("Package database changed at %s, gathering packages.", dbModTime.Format(time.RFC3339))
+		if hs, err = get(); err == nil {
+			st.PackageDBModTime = dbModTime
+		}
+	default:
+		logger.Debugf("Gathering instance inventory without packages, next full refresh after %s.", st.LastRefresh.Add(interval).Format(time.RFC3339))
+		hs = getOSInfo()
+		skip = packageFields
+	}
+	if err != nil {
+		st.LastFailure = time.Now()
+	}
+
+	write(hs, url, st.Hashes, skip)
+	if err := saveState(stateFile, st); err != nil {
+		logger.Errorf("Error saving inventory state: %v", err)
+	}
 }
 
 // Run gathers and records inventory information using tasker.Enqueue.
 func Run() {
-	tasker.Enqueue("Run OSInventory", func() { write(Get(), inventoryURL) })
+	tasker.Enqueue("Run OSInventory", func() { run(inventoryURL, config.InventoryStateFile()) })
 }
@@ -21,11 +21,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/GoogleCloudPlatform/osconfig/config"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
@@ -128,7 +134,7 @@ func TestWrite(t *testing.T) {
 	}))
 	defer svr.Close()
 
-	write(inv, svr.URL)
+	write(inv, svr.URL, nil, nil)
 
 	for k, v := range want {
 		if v {
@@ -137,3 +143,171 @@ func TestWrite(t *testing.T) {
 		t.Errorf("writeInventory call did not write %q", k)
 	}
 }
+
+func TestWriteChanged(t *testing.T) {
+	var posted []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = append(posted, r.URL.String())
+	}))
+	defer svr.Close()
+
+	inv := &InstanceInventory{
+		Hostname:          "Hostname",
+		InstalledPackages: packages.Packages{Deb: []packages.PkgInfo{{Name: "Name", Arch: "Arch", Version: "Version"}}},
+	}
+	hashes := make(map[string]string)
+	write(inv, svr.URL, hashes, nil)
+	if len(posted) != reflect.TypeOf(*inv).NumField() {
+		t.Errorf("first write should post every field, posted %q", posted)
+	}
+
+	posted = nil
+	write(inv, svr.URL, hashes, nil)
+	if len(posted) != 0 {
+		t.Errorf("unchanged fields should not be posted, posted %q", posted)
+	}
+
+	posted = nil
+	inv.Hostname = "NewHostname"
+	inv.InstalledPackages.Deb[0].Version = "NewVersion"
+	write(inv, svr.URL, hashes, packageFields)
+	if want := []string{"/Hostname"}; !reflect.DeepEqual(posted, want) {
+		t.Errorf("want posted %q, got %q", want, posted)
+	}
+
+	posted = nil
+	write(inv, svr.URL, hashes, nil)
+	if want := []string{"/InstalledPackages"}; !reflect.DeepEqual(posted, want) {
+		t.Errorf("want posted %q, got %q", want, posted)
+	}
+}
+
+func TestInventoryState(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "state")
+	if st := loadState(path); !reflect.DeepEqual(st, &inventoryState{}) {
+		t.Errorf("missing state file should load an empty state, got %+v", st)
+	}
+
+	status := filepath.Join(td, "status")
+	if err := ioutil.WriteFile(status, []byte("Package: bash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Date(2020, 3, 7, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(status, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	got := packageDBModTime([]string{filepath.Join(td, "missing"), status})
+	if !got.Equal(mod) {
+		t.Errorf("packageDBModTime() = %s, want %s", got, mod)
+	}
+
+	want := &inventoryState{InstanceID: "12345", LastRefresh: mod, PackageDBModTime: got, Hashes: map[string]string{"Hostname": "abc"}}
+	if err := saveState(path, want); err != nil {
+		t.Fatal(err)
+	}
+	st := loadState(path)
+	if st.InstanceID != want.InstanceID || !st.LastRefresh.Equal(want.LastRefresh) || !st.PackageDBModTime.Equal(want.PackageDBModTime) || !reflect.DeepEqual(st.Hashes, want.Hashes) {
+		t.Errorf("loadState() = %+v, want %+v", st, want)
+	}
+}
+
+func TestRunPackageError(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	stateFile := filepath.Join(td, "state")
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+
+	defer func() {
+		getInstalledPackages = packages.GetInstalledPackages
+		getPackageUpdates = packages.GetPackageUpdates
+		refreshInterval = config.InventoryRefreshInterval
+	}()
+	refreshInterval = func() time.Duration { return time.Hour }
+	getInstalledPackages = func() (packages.Packages, error) { return packages.Packages{}, nil }
+	var calls int
+	getPackageUpdates = func() (packages.Packages, error) {
+		calls++
+		return packages.Packages{}, fmt.Errorf("apt-get update failed")
+	}
+
+	run(svr.URL, stateFile)
+	st := loadState(stateFile)
+	if !st.LastRefresh.IsZero() {
+		t.Errorf("LastRefresh should not advance when gathering packages fails, got %s", st.LastRefresh)
+	}
+	if st.LastFailure.IsZero() {
+		t.Error("LastFailure should be set when gathering packages fails")
+	}
+
+	// Packages are not gathered again until the retry interval passed.
+	run(svr.URL, stateFile)
+	if calls != 1 {
+		t.Errorf("packages should not be gathered again right after a failure, gathered %d times", calls)
+	}
+
+	st.LastFailure = time.Now().Add(-packageRetryInterval)
+	if err := saveState(stateFile, st); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	getPackageUpdates = func() (packages.Packages, error) { return packages.Packages{}, nil }
+	run(svr.URL, stateFile)
+	if st := loadState(stateFile); st.LastRefresh.IsZero() {
+		t.Error("LastRefresh should be set after gathering packages")
+	}
+}
+
+func TestRunFullRefreshPostsAll(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	stateFile := filepath.Join(td, "state")
+
+	posted := make(map[string]bool)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted[path.Base(r.URL.Path)] = true
+	}))
+	defer svr.Close()
+
+	defer func() {
+		getInstalledPackages = packages.GetInstalledPackages
+		getPackageUpdates = packages.GetPackageUpdates
+		refreshInterval = config.InventoryRefreshInterval
+	}()
+	refreshInterval = func() time.Duration { return time.Hour }
+	getInstalledPackages = func() (packages.Packages, error) { return packages.Packages{}, nil }
+	getPackageUpdates = func() (packages.Packages, error) { return packages.Packages{}, nil }
+
+	run(svr.URL, stateFile)
+
+	// Unchanged fields are not posted before the next full refresh.
+	posted = make(map[string]bool)
+	run(svr.URL, stateFile)
+	if posted["Hostname"] {
+		t.Error("unchanged Hostname should not be posted again before the next full refresh")
+	}
+
+	st := loadState(stateFile)
+	st.LastRefresh = time.Now().Add(-time.Hour)
+	if err := saveState(stateFile, st); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	run(svr.URL, stateFile)
+	for _, name := range []string{"Hostname", "InstalledPackages", "PackageUpdates"} {
+		if !posted[name] {
+			t.Errorf("%s should be posted again on a full refresh", name)
+		}
+	}
+}
@@ -19,8 +19,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/util"
@@ -30,9 +33,11 @@ var (
 	dpkg      string
 	dpkgquery string
 	aptGet    string
+	aptMark   string
 
 	dpkgInstallArgs   = []string{"--install"}
-	dpkgQueryArgs     = []string{"-W", "-f", "${Package} ${Architecture} ${Version}\n"}
+	dpkgPrintArchArgs = []string{"--print-architecture"}
+	dpkgQueryArgs     = []string{"-W", "-f", "${Package}\t${Architecture}\t${Version}\t${Status}\t${Source}\t${db-fsys:Last-Modified}\t${Maintainer}\n"}
 	aptGetInstallArgs = []string{"install", "-y"}
 	aptGetRemoveArgs  = []string{"remove", "-y"}
 	aptGetUpdateArgs  = []string{"update"}
@@ -41,6 +46,11 @@ var (
 	aptGetFullUpgradeCmd = "full-upgrade"
 	aptGetDistUpgradeCmd = "dist-upgrade"
 	aptGetUpgradableArgs = []string{"--just-print", "-qq"}
+	aptMarkShowHoldArgs  = []string{"showhold"}
+	aptGetChangelogArgs  = []string{"changelog", "-qq"}
+	aptGetDowngradeArgs  = []string{"install", "-y", "--allow-downgrades"}
+
+	cveRegex = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
 )
 
 func init() {
@@ -48,6 +58,7 @@ func init() {
 		dpkg = "/usr/bin/dpkg"
 		dpkgquery = "/usr/bin/dpkg-query"
 		aptGet = "/usr/bin/apt-get"
+		aptMark = "/usr/bin/apt-mark"
 	}
 	AptExists = util.Exists(aptGet)
 	DpkgExists = util.Exists(dpkg)
@@ -67,8 +78,9 @@ const (
 )
 
 type aptGetUpgradeOpts struct {
-	upgradeType AptUpgradeType
-	showNew     bool
+	upgradeType  AptUpgradeType
+	showNew      bool
+	securityOnly bool
 }
 
 // AptGetUpgradeOption is an option for apt-get upgrade.
@@ -88,6 +100,14 @@ func AptGetUpgradeShowNew(showNew bool) AptGetUpgradeOption {
 	}
 }
 
+// AptGetUpgradeSecurityOnly returns a AptGetUpgradeOption that limits the
+// updates to packages whose candidate version comes from a security pocket.
+func AptGetUpgradeSecurityOnly(securityOnly bool) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.securityOnly = securityOnly
+	}
+}
+
 // InstallAptPackages installs apt packages.
 func InstallAptPackages(pkgs []string) error {
 	args := append(aptGetInstallArgs, pkgs...)
@@ -104,6 +124,23 @@ func InstallAptPackages(pkgs []string) error {
 	return err
 }
 
+// DowngradeAptPackages installs apt packages given as name=version, allowing
+// the version to be older than the installed one.
+func DowngradeAptPackages(pkgs []string) error {
+	args := append(aptGetDowngradeArgs, pkgs...)
+	install := exec.Command(aptGet, args...)
+	install.Env = append(os.Environ(),
+		"DEBIAN_FRONTEND=noninteractive",
+	)
+	out, err := run(install)
+	var msg string
+	for _, s := range strings.Split(string(out), "\n") {
+		msg += fmt.Sprintf(" %s\n", s)
+	}
+	DebugLogger.Printf("apt install output:\n%s", msg)
+	return err
+}
+
 // RemoveAptPackages removes apt packages.
 func RemoveAptPackages(pkgs []string) error {
 	args := append(aptGetRemoveArgs, pkgs...)
@@ -120,7 +157,22 @@ func RemoveAptPackages(pkgs []string) error {
 	return err
 }
 
-func parseAptUpdates(data []byte, showNew bool) []PkgInfo {
+// isAptSecurityOrigin reports whether an origin from apt-get --just-print, such
+// as Ubuntu:18.04/bionic-security or Debian-Security:9/stable, is a security
+// pocket.
+func isAptSecurityOrigin(origin string) bool {
+	origin = strings.TrimSuffix(origin, ",")
+	i := strings.Index(origin, ":")
+	if i == -1 {
+		return false
+	}
+	if strings.EqualFold(origin[:i], "Debian-Security") {
+		return true
+	}
+	return strings.HasSuffix(origin[strings.LastIndex(origin, "/")+1:], "-security")
+}
+
+func parseAptUpdates(data []byte, showNew, securityOnly bool) []PkgInfo {
 	/*
 		Inst libldap-common [2.4.45+dfsg-1ubuntu1.2] (2.4.45+dfsg-1ubuntu1.3 Ubuntu:18.04/bionic-updates, Ubuntu:18.04/bionic-security [all])
 		Inst firmware-linux-free (3.4 Debian:9.9/stable [all]) []
@@ -156,6 +208,20 @@ func parseAptUpdates(data []byte, showNew bool) []PkgInfo {
 		if !bytes.HasPrefix(pkg[1], []byte("(")) || !bytes.HasSuffix(pkg[len(pkg)-1], []byte(")")) {
 			continue
 		}
+		if securityOnly {
+			// The origins of the candidate version are listed between the
+			// version and the architecture.
+			var security bool
+			for _, origin := range pkg[2 : len(pkg)-1] {
+				if isAptSecurityOrigin(string(origin)) {
+					security = true
+					break
+				}
+			}
+			if !security {
+				continue
+			}
+		}
 		ver := bytes.Trim(pkg[1], "(")             // (246.0.0-0 => 246.0.0-0
 		arch := bytes.Trim(pkg[len(pkg)-1], "[])") // [all]) => all
 		pkgs = append(pkgs, PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(arch)), Version: string(ver)})
@@ -196,25 +262,45 @@ func AptUpdates(opts ...AptGetUpgradeOption) ([]PkgInfo, error) {
 		return nil, err
 	}
 
-	return parseAptUpdates(out, aptOpts.showNew), nil
+	return parseAptUpdates(out, aptOpts.showNew, aptOpts.securityOnly), nil
 }
 
 func parseInstalledDebpackages(data []byte) []PkgInfo {
 	/*
-	   foo amd64 1.2.3-4
-	   bar noarch 1.2.3-4
+	   foo	amd64	1:1.2.3-4	install ok installed		1588185600	Foo Maintainers <foo@example.com>
+	   bar	all	1.2.3-4	install ok installed	bar-src (1.2.3-1)	1588185600	Bar <bar@example.com>
 	   ...
 	*/
-	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	// Not TrimSpace, fields at the ends of the output can be empty.
+	lines := strings.Split(strings.Trim(string(data), "\n"), "\n")
 
 	var pkgs []PkgInfo
 	for _, ln := range lines {
-		pkg := strings.Fields(ln)
-		if len(pkg) != 3 {
+		pkg := strings.Split(ln, "\t")
+		if len(pkg) != 7 {
 			continue
 		}
+		// Removed packages with config files left behind are still listed.
+		if status := strings.Fields(pkg[3]); len(status) > 0 {
+			if s := status[len(status)-1]; s == "config-files" || s == "not-installed" {
+				continue
+			}
+		}
 
-		pkgs = append(pkgs, PkgInfo{Name: pkg[0], Arch: osinfo.Architecture(pkg[1]), Version: pkg[2]})
+		p := PkgInfo{Name: pkg[0], Arch: osinfo.Architecture(pkg[1]), Version: pkg[2], Source: pkg[0], Vendor: pkg[6]}
+		p.Epoch, p.Release = versionParts(p.Version)
+		// Source is empty when it matches the package name and can be
+		// followed by its version in parentheses.
+		if src := strings.Fields(pkg[4]); len(src) > 0 {
+			p.Source = src[0]
+		}
+		// Older dpkg versions do not have the modification time of the
+		// package file list.
+		if sec, err := strconv.ParseInt(pkg[5], 10, 64); err == nil {
+			t := time.Unix(sec, 0).UTC()
+			p.InstallTime = &t
+		}
+		pkgs = append(pkgs, p)
 	}
 	return pkgs
 }
@@ -228,6 +314,75 @@ func InstalledDebPackages() ([]PkgInfo, error) {
 	return parseInstalledDebpackages(out), nil
 }
 
+// DpkgArchitecture returns the native dpkg architecture, e.g. amd64.
+func DpkgArchitecture() (string, error) {
+	out, err := run(exec.Command(dpkg, dpkgPrintArchArgs...))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// AptHeldPackages returns the names of packages held with apt-mark hold.
+func AptHeldPackages() ([]string, error) {
+	out, err := run(exec.Command(aptMark, aptMarkShowHoldArgs...))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func parseAptChangelogCVEs(data []byte, sinceVersion string) []string {
+	/*
+		openssl (1.1.1-1ubuntu2.1~18.04.6) bionic-security; urgency=medium
+
+		  * SECURITY UPDATE: Segmentation fault in SSL_check_chain
+		    - debian/patches/CVE-2020-1967-1.patch: ...
+		    - CVE-2020-1967
+
+		 -- Marc Deslauriers <marc.deslauriers@ubuntu.com>  Mon, 20 Apr 2020 08:01:03 -0400
+
+		openssl (1.1.1-1ubuntu2.1~18.04.5) bionic-security; urgency=medium
+	*/
+	seen := make(map[string]bool)
+	var cves []string
+	var entries int
+	for _, ln := range strings.Split(string(data), "\n") {
+		// Entry headers are the only lines that are not indented.
+		if ln != "" && ln[0] != ' ' && ln[0] != '\t' {
+			fields := strings.Fields(ln)
+			if len(fields) > 1 && strings.HasPrefix(fields[1], "(") {
+				version := strings.Trim(fields[1], "()")
+				// Without a version to compare to only the newest entry is read.
+				if version == sinceVersion || (sinceVersion == "" && entries == 1) {
+					break
+				}
+				entries++
+			}
+			continue
+		}
+		for _, cve := range cveRegex.FindAllString(ln, -1) {
+			if !seen[cve] {
+				seen[cve] = true
+				cves = append(cves, cve)
+			}
+		}
+	}
+	return cves
+}
+
+// AptChangelogCVEs returns the CVEs listed in the changelog entries of the
+// candidate version of a package newer than sinceVersion, usually the
+// installed version. The changelog is downloaded from the archive.
+func AptChangelogCVEs(name, sinceVersion string) ([]string, error) {
+	args := append(aptGetChangelogArgs, name)
+	out, err := run(exec.Command(aptGet, args...))
+	if err != nil {
+		return nil, fmt.Errorf("error getting changelog of %s: %v, stdout: %s", name, err, out)
+	}
+	return parseAptChangelogCVEs(out, sinceVersion), nil
+}
+
 // DpkgInstall installs a deb package.
 func DpkgInstall(path string) error {
 	args := append(dpkgInstallArgs, path)
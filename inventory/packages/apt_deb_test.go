@@ -18,6 +18,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestInstallAptPackages(t *testing.T) {
@@ -50,13 +51,13 @@ func TestRemoveAptPackagesReturnError(t *testing.T) {
 }
 
 func TestInstalledDebPackages(t *testing.T) {
-	run = getMockRun([]byte("foo amd64 1.2.3-4"), nil)
+	run = getMockRun([]byte("foo\tamd64\t1.2.3-4\tinstall ok installed\t\t\tFoo <foo@example.com>"), nil)
 	ret, err := InstalledDebPackages()
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []PkgInfo{{"foo", "x86_64", "1.2.3-4"}}
+	want := []PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3-4", Release: "4", Source: "foo", Vendor: "Foo <foo@example.com>"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("InstalledDebPackages() = %v, want %v", ret, want)
 	}
@@ -68,15 +69,20 @@ func TestInstalledDebPackages(t *testing.T) {
 }
 
 func TestParseInstalledDebpackages(t *testing.T) {
+	installTime := time.Unix(1588291200, 0).UTC()
 	tests := []struct {
 		name string
 		data []byte
 		want []PkgInfo
 	}{
-		{"NormalCase", []byte("foo amd64 1.2.3-4\nbar noarch 1.2.3-4"), []PkgInfo{{"foo", "x86_64", "1.2.3-4"}, {"bar", "all", "1.2.3-4"}}},
+		{"NormalCase", []byte("foo\tamd64\t1:1.2.3-4\tinstall ok installed\t\t1588291200\tFoo <foo@example.com>\nbar\tnoarch\t1.2.3\tinstall ok installed\tbar-src (1.2.3-1)\t1588291200\t\n"), []PkgInfo{
+			{Name: "foo", Arch: "x86_64", Version: "1:1.2.3-4", Epoch: "1", Release: "4", Source: "foo", Vendor: "Foo <foo@example.com>", InstallTime: &installTime},
+			{Name: "bar", Arch: "all", Version: "1.2.3", Source: "bar-src", InstallTime: &installTime},
+		}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
-		{"UnrecognizedPackage", []byte("something we dont understand\n bar noarch 1.2.3-4"), []PkgInfo{{"bar", "all", "1.2.3-4"}}},
+		{"ConfigFilesOnly", []byte("foo\tamd64\t1.2.3-4\tdeinstall ok config-files\t\t\t\nbar\tall\t1.2.3-4\tinstall ok installed\t\t\t"), []PkgInfo{{Name: "bar", Arch: "all", Version: "1.2.3-4", Release: "4", Source: "bar"}}},
+		{"UnrecognizedPackage", []byte("something we dont understand\nbar\tnoarch\t1.2.3-4\tinstall ok installed\t\t\t"), []PkgInfo{{Name: "bar", Arch: "all", Version: "1.2.3-4", Release: "4", Source: "bar"}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -93,23 +99,32 @@ Inst libldap-common [2.4.45+dfsg-1ubuntu1.2] (2.4.45+dfsg-1ubuntu1.3 Ubuntu:18.0
 Inst google-cloud-sdk [245.0.0-0] (246.0.0-0 cloud-sdk-stretch:cloud-sdk-stretch [amd64]) []
 Inst firmware-linux-free (3.4 Debian:9.9/stable [all])
 Conf firmware-linux-free (3.4 Debian:9.9/stable [all])
+`
+
+	securityCase := `
+Inst libldap-common [2.4.45+dfsg-1ubuntu1.2] (2.4.45+dfsg-1ubuntu1.3 Ubuntu:18.04/bionic-updates, Ubuntu:18.04/bionic-security [all])
+Inst google-cloud-sdk [245.0.0-0] (246.0.0-0 cloud-sdk-stretch:cloud-sdk-stretch [amd64]) []
+Inst linux-image-4.9.0-9-amd64 (4.9.168-1+deb9u2 Debian-Security:9/stable [amd64])
+Inst tzdata [2019c-0+deb10u1] (2020a-0+deb10u1 Debian:10.4/stable-updates [all])
 `
 
 	tests := []struct {
-		name    string
-		data    []byte
-		showNew bool
-		want    []PkgInfo
+		name         string
+		data         []byte
+		showNew      bool
+		securityOnly bool
+		want         []PkgInfo
 	}{
-		{"NormalCase", []byte(normalCase), false, []PkgInfo{{"libldap-common", "all", "2.4.45+dfsg-1ubuntu1.3"}, {"google-cloud-sdk", "x86_64", "246.0.0-0"}}},
-		{"NormalCaseShowNew", []byte(normalCase), true, []PkgInfo{{"libldap-common", "all", "2.4.45+dfsg-1ubuntu1.3"}, {"google-cloud-sdk", "x86_64", "246.0.0-0"}, {"firmware-linux-free", "all", "3.4"}}},
-		{"NoPackages", []byte("nothing here"), false, nil},
-		{"nil", nil, false, nil},
-		{"UnrecognizedPackage", []byte("Inst something [we dont understand\n Inst google-cloud-sdk [245.0.0-0] (246.0.0-0 cloud-sdk-stretch:cloud-sdk-stretch [amd64])"), false, []PkgInfo{{"google-cloud-sdk", "x86_64", "246.0.0-0"}}},
+		{"NormalCase", []byte(normalCase), false, false, []PkgInfo{{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3"}, {Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}}},
+		{"NormalCaseShowNew", []byte(normalCase), true, false, []PkgInfo{{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3"}, {Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}, {Name: "firmware-linux-free", Arch: "all", Version: "3.4"}}},
+		{"SecurityOnly", []byte(securityCase), true, true, []PkgInfo{{Name: "libldap-common", Arch: "all", Version: "2.4.45+dfsg-1ubuntu1.3"}, {Name: "linux-image-4.9.0-9-amd64", Arch: "x86_64", Version: "4.9.168-1+deb9u2"}}},
+		{"NoPackages", []byte("nothing here"), false, false, nil},
+		{"nil", nil, false, false, nil},
+		{"UnrecognizedPackage", []byte("Inst something [we dont understand\n Inst google-cloud-sdk [245.0.0-0] (246.0.0-0 cloud-sdk-stretch:cloud-sdk-stretch [amd64])"), false, false, []PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := parseAptUpdates(tt.data, tt.showNew); !reflect.DeepEqual(got, tt.want) {
+			if got := parseAptUpdates(tt.data, tt.showNew, tt.securityOnly); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("parseAptUpdates() = %v, want %v", got, tt.want)
 			}
 		})
@@ -123,7 +138,7 @@ func TestAptUpdates(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []PkgInfo{{"google-cloud-sdk", "x86_64", "246.0.0-0"}}
+	want := []PkgInfo{{Name: "google-cloud-sdk", Arch: "x86_64", Version: "246.0.0-0"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("AptUpdates() = %v, want %v", ret, want)
 	}
@@ -133,3 +148,62 @@ func TestAptUpdates(t *testing.T) {
 		t.Errorf("did not get expected error")
 	}
 }
+
+func TestAptHeldPackages(t *testing.T) {
+	run = getMockRun([]byte("linux-image-amd64\ngoogle-cloud-sdk\n"), nil)
+	ret, err := AptHeldPackages()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []string{"linux-image-amd64", "google-cloud-sdk"}
+	if !reflect.DeepEqual(ret, want) {
+		t.Errorf("AptHeldPackages() = %v, want %v", ret, want)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := AptHeldPackages(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
+
+func TestParseAptChangelogCVEs(t *testing.T) {
+	data := []byte(`openssl (1.1.1-1ubuntu2.1~18.04.6) bionic-security; urgency=medium
+
+  * SECURITY UPDATE: Segmentation fault in SSL_check_chain
+    - debian/patches/CVE-2020-1967-1.patch: handle NULL signature.
+    - CVE-2020-1967
+
+ -- Marc Deslauriers <marc.deslauriers@ubuntu.com>  Mon, 20 Apr 2020 08:01:03 -0400
+
+openssl (1.1.1-1ubuntu2.1~18.04.5) bionic-security; urgency=medium
+
+  * SECURITY UPDATE: ECDSA remote timing attack
+    - CVE-2019-1547
+  * SECURITY UPDATE: padding oracle in PKCS7_dataDecode
+    - CVE-2019-1563
+
+ -- Marc Deslauriers <marc.deslauriers@ubuntu.com>  Wed, 05 Feb 2020 13:48:07 -0500
+
+openssl (1.1.1-1ubuntu2.1~18.04.4) bionic; urgency=medium
+
+  * SECURITY UPDATE: CVE-2019-1549
+`)
+
+	tests := []struct {
+		name  string
+		since string
+		want  []string
+	}{
+		{"SinceInstalled", "1.1.1-1ubuntu2.1~18.04.4", []string{"CVE-2020-1967", "CVE-2019-1547", "CVE-2019-1563"}},
+		{"NewestEntry", "", []string{"CVE-2020-1967"}},
+		{"UpToDate", "1.1.1-1ubuntu2.1~18.04.6", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAptChangelogCVEs(data, tt.since); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAptChangelogCVEs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
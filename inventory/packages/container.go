@@ -0,0 +1,138 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+var (
+	docker string
+	ctr    string
+
+	dockerImagesArgs  = []string{"images", "--no-trunc", "--format", "{{.Repository}}\t{{.Tag}}\t{{.ID}}\t{{.Digest}}"}
+	ctrNamespacesArgs = []string{"namespaces", "list", "--quiet"}
+	ctrImagesArgs     = []string{"images", "list"}
+)
+
+func init() {
+	if runtime.GOOS != "windows" {
+		docker = "/usr/bin/docker"
+		ctr = "/usr/bin/ctr"
+	}
+}
+
+// dockerNone is what docker prints for a missing repository, tag or digest.
+const dockerNone = "<none>"
+
+func parseDockerImages(data []byte) []ContainerImage {
+	/*
+	   gcr.io/foo/bar	latest	sha256:1234	sha256:5678
+	   <none>	<none>	sha256:abcd	<none>
+	   ...
+	*/
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	var images []ContainerImage
+	for _, ln := range lines {
+		img := strings.Split(ln, "\t")
+		if len(img) != 4 {
+			continue
+		}
+
+		image := ContainerImage{Runtime: "docker", ID: img[2]}
+		if img[0] != dockerNone {
+			image.Repository = img[0]
+		}
+		if img[1] != dockerNone {
+			image.Tag = img[1]
+		}
+		if img[3] != dockerNone {
+			image.Digest = img[3]
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// DockerImages queries for all local docker images.
+func DockerImages() ([]ContainerImage, error) {
+	out, err := run(exec.Command(docker, dockerImagesArgs...))
+	if err != nil {
+		return nil, err
+	}
+	return parseDockerImages(out), nil
+}
+
+func parseCtrImages(data []byte, namespace string) []ContainerImage {
+	/*
+	   REF                                TYPE                                                 DIGEST       SIZE     PLATFORMS   LABELS
+	   docker.io/library/redis:alpine     application/vnd.docker.distribution.manifest.list... sha256:1234  9.6 MiB  linux/amd64 -
+	   docker.io/library/redis@sha256:12  application/vnd.docker.distribution.manifest.list... sha256:1234  9.6 MiB  linux/amd64 -
+	   sha256:5678                        application/vnd.docker.distribution.manifest.list... sha256:1234  9.6 MiB  linux/amd64 -
+	   ...
+	*/
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	var images []ContainerImage
+	for _, ln := range lines {
+		img := strings.Fields(ln)
+		if len(img) < 3 || img[0] == "REF" || strings.HasPrefix(img[0], "sha256:") {
+			// Refs that are only a digest duplicate a named ref.
+			continue
+		}
+
+		image := ContainerImage{Runtime: "containerd", Namespace: namespace, Repository: img[0], Digest: img[2]}
+		if i := strings.Index(image.Repository, "@"); i != -1 {
+			image.Repository = image.Repository[:i]
+		} else if i := strings.LastIndex(image.Repository, ":"); i > strings.LastIndex(image.Repository, "/") {
+			image.Repository, image.Tag = image.Repository[:i], image.Repository[i+1:]
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// dockerNamespace is the containerd namespace used by docker.
+const dockerNamespace = "moby"
+
+// CtrImages queries for the local containerd images in all namespaces. The
+// docker namespace is skipped if docker is installed, DockerImages lists its
+// images.
+func CtrImages() ([]ContainerImage, error) {
+	out, err := run(exec.Command(ctr, ctrNamespacesArgs...))
+	if err != nil {
+		return nil, err
+	}
+
+	var images []ContainerImage
+	for _, ns := range strings.Fields(string(out)) {
+		if ns == dockerNamespace && util.Exists(docker) {
+			continue
+		}
+		args := append([]string{"--namespace", ns}, ctrImagesArgs...)
+		out, err := run(exec.Command(ctr, args...))
+		if err != nil {
+			return nil, fmt.Errorf("error listing images in containerd namespace %q: %v", ns, err)
+		}
+		images = append(images, parseCtrImages(out, ns)...)
+	}
+	return images, nil
+}
@@ -0,0 +1,109 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestParseDockerImages(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []ContainerImage
+	}{
+		{"NormalCase", []byte("gcr.io/foo/bar\tlatest\tsha256:1234\tsha256:5678\n<none>\t<none>\tsha256:abcd\t<none>\n"), []ContainerImage{
+			{Runtime: "docker", Repository: "gcr.io/foo/bar", Tag: "latest", ID: "sha256:1234", Digest: "sha256:5678"},
+			{Runtime: "docker", ID: "sha256:abcd"},
+		}},
+		{"NoImages", []byte("nothing here"), nil},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDockerImages(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDockerImages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCtrImages(t *testing.T) {
+	normalCase := `REF                                  TYPE                                                      DIGEST       SIZE     PLATFORMS    LABELS
+docker.io/library/redis:alpine       application/vnd.docker.distribution.manifest.list.v2+json sha256:1234  9.6 MiB  linux/amd64  -
+localhost:5000/app                   application/vnd.docker.distribution.manifest.v2+json      sha256:5678  1.0 MiB  linux/amd64  -
+docker.io/library/redis@sha256:1234  application/vnd.docker.distribution.manifest.list.v2+json sha256:1234  9.6 MiB  linux/amd64  -
+sha256:9abc                          application/vnd.docker.distribution.manifest.list.v2+json sha256:1234  9.6 MiB  linux/amd64  -
+`
+
+	want := []ContainerImage{
+		{Runtime: "containerd", Namespace: "k8s.io", Repository: "docker.io/library/redis", Tag: "alpine", Digest: "sha256:1234"},
+		{Runtime: "containerd", Namespace: "k8s.io", Repository: "localhost:5000/app", Digest: "sha256:5678"},
+		{Runtime: "containerd", Namespace: "k8s.io", Repository: "docker.io/library/redis", Digest: "sha256:1234"},
+	}
+	if got := parseCtrImages([]byte(normalCase), "k8s.io"); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCtrImages() = %v, want %v", got, want)
+	}
+	if got := parseCtrImages(nil, "default"); got != nil {
+		t.Errorf("parseCtrImages(nil) = %v, want nil", got)
+	}
+}
+
+func TestCtrImages(t *testing.T) {
+	// The docker namespace is skipped as docker is installed.
+	defer func(d string) { docker = d }(docker)
+	f, err := ioutil.TempFile("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	docker = f.Name()
+
+	var calls [][]string
+	run = func(cmd *exec.Cmd) ([]byte, error) {
+		calls = append(calls, cmd.Args[1:])
+		if cmd.Args[1] == "namespaces" {
+			return []byte("default\nk8s.io\nmoby\n"), nil
+		}
+		return []byte("docker.io/library/redis:alpine  application/vnd.oci.image.index.v1+json  sha256:1234  9.6 MiB  linux/amd64  -"), nil
+	}
+	ret, err := CtrImages()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []ContainerImage{
+		{Runtime: "containerd", Namespace: "default", Repository: "docker.io/library/redis", Tag: "alpine", Digest: "sha256:1234"},
+		{Runtime: "containerd", Namespace: "k8s.io", Repository: "docker.io/library/redis", Tag: "alpine", Digest: "sha256:1234"},
+	}
+	if !reflect.DeepEqual(ret, want) {
+		t.Errorf("CtrImages() = %v, want %v", ret, want)
+	}
+	wantCalls := [][]string{ctrNamespacesArgs, {"--namespace", "default", "images", "list"}, {"--namespace", "k8s.io", "images", "list"}}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("ctr calls = %q, want %q", calls, wantCalls)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := CtrImages(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
@@ -0,0 +1,271 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
+	"github.com/GoogleCloudPlatform/osconfig/util"
+)
+
+var (
+	dnf string
+
+	dnfInstallArgs            = []string{"install", "--assumeyes"}
+	dnfListUpdatesArgs        = []string{"upgrade", "--assumeno"}
+	dnfListUpdateMinimalArgs  = []string{"upgrade-minimal", "--assumeno"}
+	dnfUpdateinfoSecurityArgs = []string{"updateinfo", "list", "--security", "--quiet"}
+	dnfUpdateinfoListArgs     = []string{"updateinfo", "list", "--quiet"}
+	dnfUpdateinfoCVEArgs      = []string{"updateinfo", "list", "--with-cve", "--quiet"}
+	dnfVersionlockListArgs    = []string{"versionlock", "list", "--quiet"}
+	dnfHistoryListArgs        = []string{"history", "list"}
+	dnfHistoryUndoArgs        = []string{"history", "undo", "--assumeyes"}
+)
+
+func init() {
+	if runtime.GOOS != "windows" {
+		dnf = "/usr/bin/dnf"
+	}
+	DnfExists = util.Exists(dnf)
+}
+
+type dnfUpdateOpts struct {
+	security bool
+	minimal  bool
+}
+
+// DnfUpdateOption is an option for dnf upgrade.
+type DnfUpdateOption func(*dnfUpdateOpts)
+
+// DnfUpdateSecurity returns a DnfUpdateOption that limits updates to packages
+// with a security advisory.
+func DnfUpdateSecurity(security bool) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.security = security
+	}
+}
+
+// DnfUpdateMinimal returns a DnfUpdateOption that specifies the
+// upgrade-minimal command should be used.
+func DnfUpdateMinimal(minimal bool) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.minimal = minimal
+	}
+}
+
+// InstallDnfPackages installs dnf packages, a package may be given as name or
+// as name-[epoch:]version-release to install a specific version.
+func InstallDnfPackages(pkgs []string) error {
+	args := append(dnfInstallArgs, pkgs...)
+	out, err := run(exec.Command(dnf, args...))
+	var msg string
+	for _, s := range strings.Split(string(out), "\n") {
+		msg += fmt.Sprintf(" %s\n", s)
+	}
+	DebugLogger.Printf("dnf install output:\n%s", msg)
+	return err
+}
+
+func parseDnfUpdates(data []byte) []PkgInfo {
+	/*
+		Last metadata expiration check: 0:11:22 ago on Tue 12 Nov 2019 12:13:38 AM UTC.
+		Dependencies resolved.
+		================================================================================
+		 Package                   Arch    Version                 Repository      Size
+		================================================================================
+		Installing:
+		 kernel                    x86_64  4.18.0-147.5.1.el8_1    BaseOS         2.8 M
+		Upgrading:
+		 google-compute-engine     noarch  1:20191210.00-g1.el8    google-compute-engine
+		                                                                           18 k
+		 google-cloud-sdk-app-engine-python-extras
+		                           noarch  274.0.1-1               google-cloud-sdk 2.3 M
+		 python3-libs              x86_64  3.6.8-23.el8            BaseOS         7.8 M
+		     replacing  python3-foo.x86_64 3.6.8-1.el8
+		Installing dependencies:
+		 libfoo                    x86_64  1.0-1.el8               BaseOS          35 k
+
+		Transaction Summary
+		================================================================================
+		Install  1 Package
+		Upgrade  3 Packages
+
+		Total download size: 13 M
+		Operation aborted.
+
+		Without a terminal dnf wraps rows that do not fit in 80 columns onto the
+		next line, so fields are collected until a full row is read.
+	*/
+
+	var pkgs []PkgInfo
+	var upgrading bool
+	var fields [][]byte
+	for _, ln := range bytes.Split(data, []byte("\n")) {
+		trimmed := bytes.TrimSpace(ln)
+		// Section headers are the only lines ending with a colon, only the
+		// installing and upgrading sections list updates, dependencies are
+		// pulled in by the install.
+		if bytes.HasSuffix(trimmed, []byte(":")) {
+			upgrading = string(trimmed) == "Upgrading:" || string(trimmed) == "Installing:"
+			fields = nil
+			continue
+		}
+		if !upgrading {
+			continue
+		}
+		// Stop at the end of the package table.
+		if len(trimmed) == 0 || bytes.HasPrefix(trimmed, []byte("=")) {
+			break
+		}
+		if bytes.HasPrefix(trimmed, []byte("replacing ")) {
+			continue
+		}
+
+		fields = append(fields, bytes.Fields(trimmed)...)
+		// Name, arch, version, repository and the size with its unit.
+		if len(fields) < 6 {
+			continue
+		}
+		pkgs = append(pkgs, PkgInfo{Name: string(fields[0]), Arch: osinfo.Architecture(string(fields[1])), Version: string(fields[2])})
+		fields = nil
+	}
+	return pkgs
+}
+
+func parseDnfSecurityUpdates(data []byte) map[string]bool {
+	/*
+		RHSA-2020:0374 Important/Sec. kernel-4.18.0-147.5.1.el8_1.x86_64
+		RHSA-2020:0374 Important/Sec. kernel-core-4.18.0-147.5.1.el8_1.x86_64
+		FEDORA-2020-6a1ab9e5a3 security  python3-libs-3.7.6-2.fc31.x86_64
+	*/
+	advisories := make(map[string][]string)
+	parseUpdateinfo(data, advisories)
+	names := make(map[string]bool)
+	for _, pkgs := range advisories {
+		for _, name := range pkgs {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// DnfUpdates queries for all available dnf updates.
+func DnfUpdates(opts ...DnfUpdateOption) ([]PkgInfo, error) {
+	dnfOpts := &dnfUpdateOpts{
+		security: false,
+		minimal:  false,
+	}
+
+	for _, opt := range opts {
+		opt(dnfOpts)
+	}
+
+	var security map[string]bool
+	if dnfOpts.security {
+		out, err := run(exec.Command(dnf, dnfUpdateinfoSecurityArgs...))
+		if err != nil {
+			return nil, fmt.Errorf("error listing dnf security advisories: %v, stdout: %s", err, out)
+		}
+		security = parseDnfSecurityUpdates(out)
+		if len(security) == 0 {
+			return nil, nil
+		}
+	}
+
+	args := dnfListUpdatesArgs
+	if dnfOpts.minimal {
+		args = dnfListUpdateMinimalArgs
+	}
+	if dnfOpts.security {
+		args = append(append([]string(nil), args...), "--security")
+	}
+
+	// With --assumeno dnf exits 1 when there are updates to install and 0
+	// when there is nothing to do, so the exit code only matters if no
+	// packages could be parsed.
+	out, err := run(exec.Command(dnf, args...))
+	pkgs := parseDnfUpdates(out)
+	if len(pkgs) == 0 {
+		if err != nil {
+			return nil, fmt.Errorf("error checking for dnf updates: %v, stdout: %s", err, out)
+		}
+		return nil, nil
+	}
+	if security == nil {
+		return pkgs, nil
+	}
+
+	var secPkgs []PkgInfo
+	for _, pkg := range pkgs {
+		if security[pkg.Name] {
+			secPkgs = append(secPkgs, pkg)
+		}
+	}
+	return secPkgs, nil
+}
+
+// DnfAdvisories returns the names of the packages with an available update
+// keyed by the advisory and CVE IDs, in upper case, the update fixes.
+func DnfAdvisories() (map[string][]string, error) {
+	advisories := make(map[string][]string)
+	for _, args := range [][]string{dnfUpdateinfoListArgs, dnfUpdateinfoCVEArgs} {
+		out, err := run(exec.Command(dnf, args...))
+		if err != nil {
+			return nil, fmt.Errorf("error listing dnf advisories: %v, stdout: %s", err, out)
+		}
+		parseUpdateinfo(out, advisories)
+	}
+	return advisories, nil
+}
+
+// DnfVersionlockedPackages returns the names of packages locked with the dnf
+// versionlock plugin, it returns nothing if the plugin is not installed.
+func DnfVersionlockedPackages() ([]string, error) {
+	out, err := run(exec.Command(dnf, dnfVersionlockListArgs...))
+	if err != nil {
+		if bytes.Contains(out, []byte("No such command")) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseYumVersionlocks(out), nil
+}
+
+// DnfHistoryIDs returns the IDs of the dnf history transactions.
+func DnfHistoryIDs() ([]int, error) {
+	out, err := run(exec.Command(dnf, dnfHistoryListArgs...))
+	if err != nil {
+		return nil, fmt.Errorf("error listing dnf history: %v, stdout: %s", err, out)
+	}
+	return parseHistoryIDs(out), nil
+}
+
+// DnfHistoryUndo undoes the dnf history transaction id.
+func DnfHistoryUndo(id int) error {
+	args := append(dnfHistoryUndoArgs, strconv.Itoa(id))
+	out, err := run(exec.Command(dnf, args...))
+	var msg string
+	for _, s := range strings.Split(string(out), "\n") {
+		msg += fmt.Sprintf(" %s\n", s)
+	}
+	DebugLogger.Printf("dnf history undo output:\n%s", msg)
+	return err
+}
@@ -0,0 +1,145 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+var dnfUpgradeOutput = []byte(`Last metadata expiration check: 0:11:22 ago on Tue 12 Nov 2019 12:13:38 AM UTC.
+Dependencies resolved.
+================================================================================
+ Package                   Arch    Version                 Repository      Size
+================================================================================
+Installing:
+ kernel                    x86_64  4.18.0-147.5.1.el8_1    BaseOS         2.8 M
+Upgrading:
+ google-compute-engine     noarch  1:20191210.00-g1.el8    google-compute-engine
+                                                                           18 k
+ google-cloud-sdk-app-engine-python-extras
+                           noarch  274.0.1-1               google-cloud-sdk 2.3 M
+ python3-libs              x86_64  3.6.8-23.el8            BaseOS         7.8 M
+     replacing  python3-foo.x86_64 3.6.8-1.el8
+Installing dependencies:
+ libfoo                    x86_64  1.0-1.el8               BaseOS          35 k
+
+Transaction Summary
+================================================================================
+Install  1 Package
+Upgrade  3 Packages
+
+Total download size: 13 M
+Operation aborted.
+`)
+
+func TestInstallDnfPackages(t *testing.T) {
+	run = getMockRun([]byte("TestInstallDnfPackages"), nil)
+	if err := InstallDnfPackages(pkgs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	run = getMockRun([]byte("TestInstallDnfPackagesReturnsError"), errors.New("Could not install package"))
+	if err := InstallDnfPackages(pkgs); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
+
+func TestParseDnfUpdates(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []PkgInfo
+	}{
+		{"NormalCase", dnfUpgradeOutput, []PkgInfo{
+			{Name: "kernel", Arch: "x86_64", Version: "4.18.0-147.5.1.el8_1"},
+			{Name: "google-compute-engine", Arch: "all", Version: "1:20191210.00-g1.el8"},
+			{Name: "google-cloud-sdk-app-engine-python-extras", Arch: "all", Version: "274.0.1-1"},
+			{Name: "python3-libs", Arch: "x86_64", Version: "3.6.8-23.el8"},
+		}},
+		{"NothingToDo", []byte("Dependencies resolved.\nNothing to do.\nComplete!\n"), nil},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDnfUpdates(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDnfUpdates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDnfSecurityUpdates(t *testing.T) {
+	data := []byte(`RHSA-2020:0374 Important/Sec. kernel-4.18.0-147.5.1.el8_1.x86_64
+RHSA-2020:0374 Important/Sec. kernel-core-4.18.0-147.5.1.el8_1.x86_64
+FEDORA-2020-6a1ab9e5a3 security  python3-libs-3.7.6-2.fc31.x86_64
+RHSA-2020:0375 Moderate/Sec.  google-compute-engine-1:20191210.00-g1.el8.noarch
+`)
+	want := map[string]bool{"kernel": true, "kernel-core": true, "python3-libs": true, "google-compute-engine": true}
+	if got := parseDnfSecurityUpdates(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDnfSecurityUpdates() = %v, want %v", got, want)
+	}
+}
+
+func TestDnfUpdates(t *testing.T) {
+	run = getMockRun(dnfUpgradeOutput, errors.New("exit status 1"))
+	got, err := DnfUpdates()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("unexpected return: %v", got)
+	}
+
+	run = getMockRun([]byte("Nothing to do."), nil)
+	got, err = DnfUpdates()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Errorf("unexpected return: %v", got)
+	}
+
+	run = getMockRun([]byte("Error: Failed to download metadata"), errors.New("exit status 1"))
+	if _, err := DnfUpdates(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
+
+func TestDnfUpdatesSecurity(t *testing.T) {
+	var gotArgs [][]string
+	run = func(cmd *exec.Cmd) ([]byte, error) {
+		gotArgs = append(gotArgs, cmd.Args[1:])
+		if cmd.Args[1] == "updateinfo" {
+			return []byte("RHSA-2020:0374 Important/Sec. kernel-4.18.0-147.5.1.el8_1.x86_64\n"), nil
+		}
+		return dnfUpgradeOutput, errors.New("exit status 1")
+	}
+
+	got, err := DnfUpdates(DnfUpdateSecurity(true), DnfUpdateMinimal(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "4.18.0-147.5.1.el8_1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DnfUpdates() = %v, want %v", got, want)
+	}
+	wantArgs := [][]string{dnfUpdateinfoSecurityArgs, {"upgrade-minimal", "--assumeno", "--security"}}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Errorf("unexpected commands: got %q, want %q", gotArgs, wantArgs)
+	}
+}
@@ -0,0 +1,70 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
+)
+
+var (
+	flatpak string
+
+	flatpakListArgs = []string{"list", "--columns=application,arch,version,branch"}
+)
+
+func init() {
+	if runtime.GOOS != "windows" {
+		flatpak = "/usr/bin/flatpak"
+	}
+}
+
+func parseInstalledFlatpakPackages(data []byte) []PkgInfo {
+	/*
+	   org.gimp.GIMP	x86_64	2.10.18	stable
+	   org.gnome.Platform	x86_64		3.36
+	   ...
+	*/
+	lines := strings.Split(strings.Trim(string(data), "\n"), "\n")
+
+	var pkgs []PkgInfo
+	for _, ln := range lines {
+		pkg := strings.Split(ln, "\t")
+		if len(pkg) != 4 || pkg[0] == "" {
+			continue
+		}
+
+		// Runtimes only have a branch.
+		ver := pkg[2]
+		if ver == "" {
+			ver = pkg[3]
+		}
+		pkgs = append(pkgs, PkgInfo{Name: pkg[0], Arch: osinfo.Architecture(pkg[1]), Version: ver})
+	}
+	return pkgs
+}
+
+// InstalledFlatpakPackages queries for all installed flatpak applications
+// and runtimes.
+func InstalledFlatpakPackages() ([]PkgInfo, error) {
+	out, err := run(exec.Command(flatpak, flatpakListArgs...))
+	if err != nil {
+		return nil, err
+	}
+	return parseInstalledFlatpakPackages(out), nil
+}
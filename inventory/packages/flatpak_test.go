@@ -0,0 +1,61 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseInstalledFlatpakPackages(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []PkgInfo
+	}{
+		{"NormalCase", []byte("org.gimp.GIMP\tx86_64\t2.10.18\tstable\norg.gnome.Platform\tx86_64\t\t3.36\n"), []PkgInfo{
+			{Name: "org.gimp.GIMP", Arch: "x86_64", Version: "2.10.18"},
+			{Name: "org.gnome.Platform", Arch: "x86_64", Version: "3.36"},
+		}},
+		{"NoPackages", []byte("nothing here"), nil},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseInstalledFlatpakPackages(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInstalledFlatpakPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstalledFlatpakPackages(t *testing.T) {
+	run = getMockRun([]byte("org.gimp.GIMP\tx86_64\t2.10.18\tstable"), nil)
+	ret, err := InstalledFlatpakPackages()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []PkgInfo{{Name: "org.gimp.GIMP", Arch: "x86_64", Version: "2.10.18"}}
+	if !reflect.DeepEqual(ret, want) {
+		t.Errorf("InstalledFlatpakPackages() = %v, want %v", ret, want)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := InstalledFlatpakPackages(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
@@ -42,6 +42,14 @@ func init() {
 	GooGetExists = util.Exists(googet)
 }
 
+// googetRelease returns the release of a GooGet version like 1.2.3@4.
+func googetRelease(v string) string {
+	if i := strings.LastIndex(v, "@"); i != -1 {
+		return v[i+1:]
+	}
+	return ""
+}
+
 func parseGooGetUpdates(data []byte) []PkgInfo {
 	/*
 	   Searching for available updates...
@@ -62,7 +70,7 @@ func parseGooGetUpdates(data []byte) []PkgInfo {
 		if len(p) != 2 {
 			continue
 		}
-		pkgs = append(pkgs, PkgInfo{Name: p[0], Arch: strings.Trim(p[1], ","), Version: pkg[3]})
+		pkgs = append(pkgs, PkgInfo{Name: p[0], Arch: strings.Trim(p[1], ","), Version: pkg[3], Release: googetRelease(pkg[3])})
 	}
 	return pkgs
 }
@@ -122,7 +130,7 @@ func parseInstalledGooGetPackages(data []byte) []PkgInfo {
 			continue
 		}
 
-		pkgs = append(pkgs, PkgInfo{Name: string(p[0]), Arch: string(p[1]), Version: string(pkg[1])})
+		pkgs = append(pkgs, PkgInfo{Name: string(p[0]), Arch: string(p[1]), Version: string(pkg[1]), Release: googetRelease(string(pkg[1]))})
 	}
 	return pkgs
 }
@@ -54,10 +54,10 @@ func TestParseInstalledGooGetPackages(t *testing.T) {
 		data []byte
 		want []PkgInfo
 	}{
-		{"NormalCase", []byte(" Installed Packages:\nfoo.x86_64 1.2.3@4\nbar.noarch 1.2.3@4"), []PkgInfo{{"foo", "x86_64", "1.2.3@4"}, {"bar", "noarch", "1.2.3@4"}}},
+		{"NormalCase", []byte(" Installed Packages:\nfoo.x86_64 1.2.3@4\nbar.noarch 1.2.3@4"), []PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3@4", Release: "4"}, {Name: "bar", Arch: "noarch", Version: "1.2.3@4", Release: "4"}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
-		{"UnrecognizedPackage", []byte("Inst something we dont understand\n foo.x86_64 1.2.3@4"), []PkgInfo{{"foo", "x86_64", "1.2.3@4"}}},
+		{"UnrecognizedPackage", []byte("Inst something we dont understand\n foo.x86_64 1.2.3@4"), []PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3@4", Release: "4"}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -75,7 +75,7 @@ func TestInstalledGooGetPackages(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []PkgInfo{{"foo", "x86_64", "1.2.3@4"}}
+	want := []PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3@4", Release: "4"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("InstalledGooGetPackages() = %v, want %v", ret, want)
 	}
@@ -92,10 +92,10 @@ func TestParseGooGetUpdates(t *testing.T) {
 		data []byte
 		want []PkgInfo
 	}{
-		{"NormalCase", []byte("Searching for available updates...\nfoo.noarch, 3.5.4@1 --> 3.6.7@1 from repo\nbar.x86_64, 1.0.0@1 --> 2.0.0@1 from repo\nPerform update? (y/N):"), []PkgInfo{{"foo", "noarch", "3.6.7@1"}, {"bar", "x86_64", "2.0.0@1"}}},
+		{"NormalCase", []byte("Searching for available updates...\nfoo.noarch, 3.5.4@1 --> 3.6.7@1 from repo\nbar.x86_64, 1.0.0@1 --> 2.0.0@1 from repo\nPerform update? (y/N):"), []PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1", Release: "1"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0@1", Release: "1"}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
-		{"UnrecognizedPackage", []byte("Inst something we dont understand\n foo.noarch, 3.5.4@1 --> 3.6.7@1 from repo"), []PkgInfo{{"foo", "noarch", "3.6.7@1"}}},
+		{"UnrecognizedPackage", []byte("Inst something we dont understand\n foo.noarch, 3.5.4@1 --> 3.6.7@1 from repo"), []PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1", Release: "1"}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -113,7 +113,7 @@ func TestGooGetUpdates(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []PkgInfo{{"foo", "noarch", "3.6.7@1"}}
+	want := []PkgInfo{{Name: "foo", Arch: "noarch", Version: "3.6.7@1", Release: "1"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("GooGetUpdates() = %v, want %v", ret, want)
 	}
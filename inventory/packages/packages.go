@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
@@ -33,6 +34,8 @@ var (
 	DpkgQueryExists bool
 	// YumExists indicates whether yum is installed.
 	YumExists bool
+	// DnfExists indicates whether dnf is installed.
+	DnfExists bool
 	// ZypperExists indicates whether zypper is installed.
 	ZypperExists bool
 	// RPMExists indicates whether rpm is installed.
@@ -65,11 +68,53 @@ type Packages struct {
 	GooGet        []PkgInfo     `json:"googet,omitempty"`
 	WUA           []WUAPackage  `json:"wua,omitempty"`
 	QFE           []QFEPackage  `json:"qfe,omitempty"`
+	Snap          []PkgInfo     `json:"snap,omitempty"`
+	Flatpak       []PkgInfo     `json:"flatpak,omitempty"`
+	// ContainerImages are the images stored by local container runtimes.
+	ContainerImages []ContainerImage `json:"containerImages,omitempty"`
 }
 
 // PkgInfo describes a package.
 type PkgInfo struct {
 	Name, Arch, Version string
+
+	// The fields below are only set by package managers that report them,
+	// they are omitted from the inventory when empty.
+
+	// Epoch and Release are the epoch and release (or Debian revision) parts
+	// of Version.
+	Epoch   string `json:",omitempty"`
+	Release string `json:",omitempty"`
+	// Source is the name of the source package this package was built from.
+	Source string `json:",omitempty"`
+	// Vendor is the rpm vendor or deb maintainer.
+	Vendor string `json:",omitempty"`
+	// InstallTime is when the package was installed or last upgraded.
+	InstallTime *time.Time `json:",omitempty"`
+}
+
+// versionParts returns the epoch and release of a rpm or deb style
+// [epoch:]version[-release] version string.
+func versionParts(v string) (epoch, release string) {
+	if i := strings.Index(v, ":"); i != -1 {
+		epoch = v[:i]
+	}
+	if i := strings.LastIndex(v, "-"); i != -1 {
+		release = v[i+1:]
+	}
+	return epoch, release
+}
+
+// ContainerImage describes a local container image.
+type ContainerImage struct {
+	// Runtime is docker or containerd.
+	Runtime string
+	// Namespace is the containerd namespace of the image.
+	Namespace  string `json:",omitempty"`
+	Repository string `json:",omitempty"`
+	Tag        string `json:",omitempty"`
+	ID         string `json:",omitempty"`
+	Digest     string `json:",omitempty"`
 }
 
 // ZypperPatch describes a Zypper patch.
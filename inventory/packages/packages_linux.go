@@ -36,7 +36,18 @@ func GetPackageUpdates() (Packages, error) {
 			pkgs.Apt = apt
 		}
 	}
-	if YumExists {
+	// On EL8 and later yum is an alias of dnf, prefer dnf as it can list
+	// updates without a terminal.
+	if DnfExists {
+		dnf, err := DnfUpdates()
+		if err != nil {
+			msg := fmt.Sprintf("error getting dnf updates: %v", err)
+			DebugLogger.Println("Error:", msg)
+			errs = append(errs, msg)
+		} else {
+			pkgs.Yum = dnf
+		}
+	} else if YumExists {
 		yum, err := YumUpdates()
 		if err != nil {
 			msg := fmt.Sprintf("error getting yum updates: %v", err)
@@ -145,6 +156,44 @@ func GetInstalledPackages() (Packages, error) {
 			pkgs.Pip = pip
 		}
 	}
+	if util.Exists(snap) {
+		snap, err := InstalledSnapPackages()
+		if err != nil {
+			msg := fmt.Sprintf("error listing installed snap packages: %v", err)
+			DebugLogger.Println("Error:", msg)
+			errs = append(errs, msg)
+		} else {
+			pkgs.Snap = snap
+		}
+	}
+	if util.Exists(flatpak) {
+		flatpak, err := InstalledFlatpakPackages()
+		if err != nil {
+			msg := fmt.Sprintf("error listing installed flatpak packages: %v", err)
+			DebugLogger.Println("Error:", msg)
+			errs = append(errs, msg)
+		} else {
+			pkgs.Flatpak = flatpak
+		}
+	}
+	// Container runtimes are often installed without their daemon running,
+	// errors listing their images are not reported.
+	if util.Exists(docker) {
+		images, err := DockerImages()
+		if err != nil {
+			DebugLogger.Println("Error listing docker images:", err)
+		} else {
+			pkgs.ContainerImages = append(pkgs.ContainerImages, images...)
+		}
+	}
+	if util.Exists(ctr) {
+		images, err := CtrImages()
+		if err != nil {
+			DebugLogger.Println("Error listing containerd images:", err)
+		} else {
+			pkgs.ContainerImages = append(pkgs.ContainerImages, images...)
+		}
+	}
 
 	var err error
 	if len(errs) != 0 {
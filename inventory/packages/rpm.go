@@ -18,7 +18,9 @@ import (
 	"bytes"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
 	"github.com/GoogleCloudPlatform/osconfig/util"
@@ -29,7 +31,8 @@ var (
 	rpm      string
 
 	rpmInstallArgs = []string{"--upgrade", "--replacepkgs", "-v"}
-	rpmqueryArgs   = []string{"-a", "--queryformat", "%{NAME} %{ARCH} %{VERSION}-%{RELEASE}\n"}
+	// VENDOR is last as it can contain spaces.
+	rpmqueryArgs = []string{"-a", "--queryformat", "%{NAME} %{ARCH} %{VERSION}-%{RELEASE} %{EPOCH} %{RELEASE} %{SOURCERPM} %{INSTALLTIME} %{VENDOR}\n"}
 )
 
 func init() {
@@ -41,10 +44,13 @@ func init() {
 	RPMExists = util.Exists(rpm)
 }
 
+// rpmNone is what rpm prints for unset tags.
+const rpmNone = "(none)"
+
 func parseInstalledRPMPackages(data []byte) []PkgInfo {
 	/*
-	   foo x86_64 1.2.3-4
-	   bar noarch 1.2.3-4
+	   foo x86_64 1.2.3-4 (none) 4 foo-1.2.3-4.src.rpm 1588185600 Google
+	   bar noarch 1.2.3-4 1 4 bar-1.2.3-4.src.rpm 1588185600 Red Hat, Inc.
 	   ...
 	*/
 	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
@@ -52,15 +58,50 @@ func parseInstalledRPMPackages(data []byte) []PkgInfo {
 	var pkgs []PkgInfo
 	for _, ln := range lines {
 		pkg := bytes.Fields(ln)
-		if len(pkg) != 3 {
+		if len(pkg) < 8 {
 			continue
 		}
 
-		pkgs = append(pkgs, PkgInfo{Name: string(pkg[0]), Arch: osinfo.Architecture(string(pkg[1])), Version: string(pkg[2])})
+		p := PkgInfo{
+			Name:    string(pkg[0]),
+			Arch:    osinfo.Architecture(string(pkg[1])),
+			Version: string(pkg[2]),
+			Release: string(pkg[4]),
+			Source:  rpmSourceName(string(pkg[5])),
+		}
+		if epoch := string(pkg[3]); epoch != rpmNone {
+			p.Epoch = epoch
+		}
+		if vendor := string(bytes.Join(pkg[7:], []byte(" "))); vendor != rpmNone {
+			p.Vendor = vendor
+		}
+		if sec, err := strconv.ParseInt(string(pkg[6]), 10, 64); err == nil {
+			t := time.Unix(sec, 0).UTC()
+			p.InstallTime = &t
+		}
+		pkgs = append(pkgs, p)
 	}
 	return pkgs
 }
 
+// rpmSourceName returns the package name of a source rpm file name like
+// foo-1.2.3-4.el8.src.rpm.
+func rpmSourceName(srpm string) string {
+	if srpm == rpmNone {
+		return ""
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(srpm, ".src.rpm"), ".nosrc.rpm")
+	// Strip the release and version.
+	for i := 0; i < 2; i++ {
+		j := strings.LastIndex(name, "-")
+		if j == -1 {
+			return ""
+		}
+		name = name[:j]
+	}
+	return name
+}
+
 // InstalledRPMPackages queries for all installed rpm packages.
 func InstalledRPMPackages() ([]PkgInfo, error) {
 	out, err := run(exec.Command(rpmquery, rpmqueryArgs...))
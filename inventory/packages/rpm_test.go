@@ -18,18 +18,23 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseInstalledRPMPackages(t *testing.T) {
+	installTime := time.Unix(1588291200, 0).UTC()
 	tests := []struct {
 		name string
 		data []byte
 		want []PkgInfo
 	}{
-		{"NormalCase", []byte("foo x86_64 1.2.3-4\nbar noarch 1.2.3-4"), []PkgInfo{{"foo", "x86_64", "1.2.3-4"}, {"bar", "all", "1.2.3-4"}}},
+		{"NormalCase", []byte("foo x86_64 1.2.3-4.el8 (none) 4.el8 foo-libs-1.2.3-4.el8.src.rpm 1588291200 Red Hat, Inc.\nbar noarch 1.2.3-4 1 4 (none) 1588291200 (none)"), []PkgInfo{
+			{Name: "foo", Arch: "x86_64", Version: "1.2.3-4.el8", Release: "4.el8", Source: "foo-libs", Vendor: "Red Hat, Inc.", InstallTime: &installTime},
+			{Name: "bar", Arch: "all", Version: "1.2.3-4", Epoch: "1", Release: "4", InstallTime: &installTime},
+		}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
-		{"UnrecognizedPackage", []byte("foo.x86_64 1.2.3-4\nsomething we dont understand\n bar noarch 1.2.3-4 "), []PkgInfo{{"bar", "all", "1.2.3-4"}}},
+		{"UnrecognizedPackage", []byte("foo.x86_64 1.2.3-4\nsomething we dont understand\n bar noarch 1.2.3-4 (none) 4 bar-1.2.3-4.src.rpm 1588291200 Google "), []PkgInfo{{Name: "bar", Arch: "all", Version: "1.2.3-4", Release: "4", Source: "bar", Vendor: "Google", InstallTime: &installTime}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -42,13 +47,13 @@ func TestParseInstalledRPMPackages(t *testing.T) {
 }
 
 func TestInstalledRPMPackages(t *testing.T) {
-	run = getMockRun([]byte("foo x86_64 1.2.3-4"), nil)
+	run = getMockRun([]byte("foo x86_64 1.2.3-4 (none) 4 foo-1.2.3-4.src.rpm (none) (none)"), nil)
 	ret, err := InstalledRPMPackages()
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []PkgInfo{{"foo", "x86_64", "1.2.3-4"}}
+	want := []PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.2.3-4", Release: "4", Source: "foo"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("InstalledRPMPackages() = %v, want %v", ret, want)
 	}
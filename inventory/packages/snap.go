@@ -0,0 +1,69 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var (
+	snap string
+
+	snapListArgs = []string{"list", "--color=never", "--unicode=never"}
+)
+
+func init() {
+	if runtime.GOOS != "windows" {
+		snap = "/usr/bin/snap"
+	}
+}
+
+func parseInstalledSnapPackages(data []byte) []PkgInfo {
+	/*
+	   Name    Version   Rev    Tracking       Publisher   Notes
+	   core18  20200427  1754   latest/stable  canonical*  base
+	   lxd     4.0.1     14890  latest/stable  canonical*  -
+	   ...
+	*/
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	var pkgs []PkgInfo
+	for _, ln := range lines {
+		pkg := strings.Fields(ln)
+		if len(pkg) < 6 || pkg[0] == "Name" {
+			continue
+		}
+
+		p := PkgInfo{Name: pkg[0], Arch: noarch, Version: pkg[1], Release: pkg[2]}
+		// Verified and starred publishers are marked with * or **.
+		if publisher := strings.TrimRight(pkg[4], "*"); publisher != "-" {
+			p.Vendor = publisher
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+// InstalledSnapPackages queries for all installed snaps, Release is the snap
+// revision.
+func InstalledSnapPackages() ([]PkgInfo, error) {
+	out, err := run(exec.Command(snap, snapListArgs...))
+	if err != nil {
+		return nil, err
+	}
+	return parseInstalledSnapPackages(out), nil
+}
@@ -0,0 +1,68 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseInstalledSnapPackages(t *testing.T) {
+	normalCase := `Name    Version   Rev    Tracking       Publisher   Notes
+core18  20200427  1754   latest/stable  canonical*  base
+lxd     4.0.1     14890  latest/stable  canonical*  -
+hello   2.10      38     -              -           -
+`
+
+	tests := []struct {
+		name string
+		data []byte
+		want []PkgInfo
+	}{
+		{"NormalCase", []byte(normalCase), []PkgInfo{
+			{Name: "core18", Arch: "all", Version: "20200427", Release: "1754", Vendor: "canonical"},
+			{Name: "lxd", Arch: "all", Version: "4.0.1", Release: "14890", Vendor: "canonical"},
+			{Name: "hello", Arch: "all", Version: "2.10", Release: "38"},
+		}},
+		{"NoPackages", []byte("No snaps are installed yet."), nil},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseInstalledSnapPackages(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInstalledSnapPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstalledSnapPackages(t *testing.T) {
+	run = getMockRun([]byte("lxd  4.0.1  14890  latest/stable  canonical**  -"), nil)
+	ret, err := InstalledSnapPackages()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []PkgInfo{{Name: "lxd", Arch: "all", Version: "4.0.1", Release: "14890", Vendor: "canonical"}}
+	if !reflect.DeepEqual(ret, want) {
+		t.Errorf("InstalledSnapPackages() = %v, want %v", ret, want)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := InstalledSnapPackages(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
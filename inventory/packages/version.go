@@ -0,0 +1,310 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The Compare functions return -1 if a is older than b, 0 if they are the
+// same version and 1 if a is newer than b.
+
+// CompareDebVersions compares two [epoch:]upstream[-revision] versions the
+// way dpkg does.
+func CompareDebVersions(a, b string) int {
+	aEpoch, aUpstream, aRevision := splitEVR(a)
+	bEpoch, bUpstream, bRevision := splitEVR(b)
+	if c := compareInts(aEpoch, bEpoch); c != 0 {
+		return c
+	}
+	if c := debVerRevCmp(aUpstream, bUpstream); c != 0 {
+		return c
+	}
+	return debVerRevCmp(aRevision, bRevision)
+}
+
+// CompareRPMVersions compares two [epoch:]version[-release] versions the way
+// rpm does. The release is only compared if both versions have one.
+func CompareRPMVersions(a, b string) int {
+	aEpoch, aVersion, aRelease := splitEVR(a)
+	bEpoch, bVersion, bRelease := splitEVR(b)
+	if c := compareInts(aEpoch, bEpoch); c != 0 {
+		return c
+	}
+	if c := rpmVerCmp(aVersion, bVersion); c != 0 {
+		return c
+	}
+	if aRelease == "" || bRelease == "" {
+		return 0
+	}
+	return rpmVerCmp(aRelease, bRelease)
+}
+
+// CompareSemver compares two semantic versions. A leading v is ignored and
+// missing minor or patch numbers are 0, so 1.2 is the same as v1.2.0. Build
+// metadata after a + is ignored.
+func CompareSemver(a, b string) int {
+	aCore, aPre := splitSemver(a)
+	bCore, bPre := splitSemver(b)
+	for len(aCore) < len(bCore) {
+		aCore = append(aCore, "0")
+	}
+	for len(bCore) < len(aCore) {
+		bCore = append(bCore, "0")
+	}
+	for i := range aCore {
+		if c := compareIdentifiers(aCore[i], bCore[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A pre-release is older than the release itself.
+	switch {
+	case aPre == nil && bPre == nil:
+		return 0
+	case aPre == nil:
+		return 1
+	case bPre == nil:
+		return -1
+	}
+	for i := 0; i < len(aPre) && i < len(bPre); i++ {
+		if c := compareIdentifiers(aPre[i], bPre[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(aPre), len(bPre))
+}
+
+// splitEVR splits a [epoch:]version[-release] version, a missing or invalid
+// epoch is 0.
+func splitEVR(v string) (int, string, string) {
+	var epoch int
+	if i := strings.Index(v, ":"); i != -1 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	var release string
+	if i := strings.LastIndex(v, "-"); i != -1 {
+		release = v[i+1:]
+		v = v[:i]
+	}
+	return epoch, v, release
+}
+
+func splitSemver(v string) (core, pre []string) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.Index(v, "+"); i != -1 {
+		v = v[:i]
+	}
+	if i := strings.Index(v, "-"); i != -1 {
+		pre = strings.Split(v[i+1:], ".")
+		v = v[:i]
+	}
+	return strings.Split(v, "."), pre
+}
+
+// compareIdentifiers compares numeric identifiers numerically, other
+// identifiers in ASCII order, numeric identifiers are older.
+func compareIdentifiers(a, b string) int {
+	aNum, aErr := strconv.ParseUint(a, 10, 64)
+	bNum, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case aNum < bNum:
+			return -1
+		case aNum > bNum:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// debOrder is the dpkg sort weight of the character at i of s: ~ sorts before
+// everything, even the end of the string, and letters sort before other
+// characters.
+func debOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+// debVerRevCmp compares alternating non-digit and digit parts of a dpkg
+// upstream version or revision, see verrevcmp in dpkg.
+func debVerRevCmp(a, b string) int {
+	var i, j int
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := debOrder(a, i), debOrder(b, j)
+			if ac != bc {
+				return compareInts(ac, bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		var firstDiff int
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = compareInts(int(a[i]), int(b[j]))
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
+
+// rpmVerCmp compares alphanumeric segments of a rpm version or release, see
+// rpmvercmp in rpm.
+func rpmVerCmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	var i, j int
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) && !isAlpha(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isDigit(b[j]) && !isAlpha(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+
+		// ~ sorts before everything, even the end of the version.
+		if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		// ^ sorts after the end of the version but before anything else.
+		if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		// Compare segments of the same type, numbers are newer than
+		// letters.
+		isNum := isDigit(a[i])
+		same := isAlpha
+		if isNum {
+			same = isDigit
+		}
+		si, sj := i, j
+		for i < len(a) && same(a[i]) {
+			i++
+		}
+		for j < len(b) && same(b[j]) {
+			j++
+		}
+		segA, segB := a[si:i], b[sj:j]
+		if segB == "" {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		if isNum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if c := compareInts(len(segA), len(segB)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	}
+	return 1
+}
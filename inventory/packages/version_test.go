@@ -0,0 +1,185 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package packages
+
+import "testing"
+
+type versionTest struct {
+	a, b string
+	want int
+}
+
+func runVersionTests(t *testing.T, name string, cmp func(a, b string) int, tests []versionTest) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := cmp(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s(%q, %q) = %d, want %d", name, tt.a, tt.b, got, tt.want)
+		}
+		// Comparing the other way around gives the opposite result.
+		if got := cmp(tt.b, tt.a); got != -tt.want {
+			t.Errorf("%s(%q, %q) = %d, want %d", name, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareDebVersions(t *testing.T) {
+	runVersionTests(t, "CompareDebVersions", CompareDebVersions, []versionTest{
+		// Equal versions.
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-1", 0},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0", "1.0-0", 0},
+		{"1.01", "1.1", 0},
+		{"1.001-1", "1.1-1", 0},
+		{"", "", 0},
+
+		// Epochs.
+		{"1:1.0", "2.0", 1},
+		{"1:1.0", "2:0.1", -1},
+		{"10:1.0", "9:1.0", 1},
+
+		// Upstream versions.
+		{"1.0", "1.1", -1},
+		{"1.2", "1.10", -1},
+		{"1.0", "1.0.1", -1},
+		{"2.0", "10.0", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0b", -1},
+		{"1.0.a", "1.0a", 1},
+		{"1.0+dfsg", "1.0", 1},
+		{"1.0+dfsg", "1.0.1", -1},
+		{"1.0-1", "1.0.1-1", -1},
+		{"1.0a", "1.0+", -1},
+		{"2.4.45+dfsg-1ubuntu1.2", "2.4.45+dfsg-1ubuntu1.3", -1},
+
+		// Tilde sorts before everything, even the end of the version.
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~~a", "1.0~~", 1},
+		{"1.0~", "1.0", -1},
+		{"1.0~beta", "1.0~alpha", 1},
+		{"1.0~rc1-1", "1.0-1", -1},
+
+		// Revisions.
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-9", "1.0-10", -1},
+		{"1.0-1ubuntu1", "1.0-1", 1},
+		{"1.0-1+deb9u1", "1.0-1+deb9u2", -1},
+		{"1.0-1~bpo9+1", "1.0-1", -1},
+		{"1.0-1-1", "1.0-1", 1},
+		{"1.0", "1.0-1", -1},
+	})
+}
+
+func TestCompareRPMVersions(t *testing.T) {
+	runVersionTests(t, "CompareRPMVersions", CompareRPMVersions, []versionTest{
+		// Cases from the rpmvercmp tests in rpm.
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0.1", 0},
+		{"2.0", "2.0.1", -1},
+		{"2.0.1a", "2.0.1a", 0},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p1", 0},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p10", 0},
+		{"5.5p1", "5.5p10", -1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10", 0},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "xyz.4", 0},
+		{"xyz.4", "8", -1},
+		{"xyz.4", "2", -1},
+		{"5.5p2", "5.6p1", -1},
+		{"5.6p1", "6.5p1", -1},
+		{"6.0.rc1", "6.0", 1},
+		{"10b2", "10a1", 1},
+		{"1.0aa", "1.0aa", 0},
+		{"1.0a", "1.0aa", -1},
+		{"10.0001", "10.0001", 0},
+		{"10.0001", "10.1", 0},
+		{"10.0001", "10.0039", -1},
+		{"4.999.9", "5.0", -1},
+		{"20101121", "20101122", -1},
+		{"2_0", "2_0", 0},
+		{"2.0", "2_0", 0},
+		{"a", "a", 0},
+		{"a+", "a+", 0},
+		{"a+", "a_", 0},
+		{"+a", "_a", 0},
+		{"+_", "_+", 0},
+		{"_+", "+_", 0},
+		{"_+", "_", 0},
+		{"+", "_", 0},
+		{"1.0~rc1", "1.0~rc1", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1~git123", 0},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0^", 0},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0^git1", 0},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^20160101", "1.0.1", -1},
+		{"1.0^20160101^git1", "1.0^20160101^git1", 0},
+		{"1.0^20160102", "1.0^20160101^git1", 1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+		{"1.0^git1~pre", "1.0^git1", -1},
+
+		// Epochs and releases.
+		{"1:1.0-1", "2.0-1", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-1.el8", "1.0-1.el8_1", -1},
+		{"4.18.0-147.5.1.el8_1", "4.18.0-147.el8", 1},
+		{"1.0-10", "1.0-9", 1},
+		// A missing release matches any release.
+		{"1.0", "1.0-5", 0},
+		{"1.1", "1.0-5", 1},
+	})
+}
+
+func TestCompareSemver(t *testing.T) {
+	runVersionTests(t, "CompareSemver", CompareSemver, []versionTest{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"1", "1.0.0", 0},
+		{"1.0.0+build1", "1.0.0+build2", 0},
+		{"1.0.0", "2.0.0", -1},
+		{"2.0.0", "2.1.0", -1},
+		{"2.1.0", "2.1.1", -1},
+		{"1.9.0", "1.10.0", -1},
+		{"1.2.3.4", "1.2.3", 1},
+		{"1.2.3.4", "1.2.3.10", -1},
+
+		// Pre-release ordering from the semver spec.
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta", "1.0.0-beta.2", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.2.3-rc1", "1.2.3", -1},
+		{"1.2.3-rc1", "1.2.3-rc2", -1},
+		{"1.2.3-rc1", "1.2.2", 1},
+		{"1.2.3-rc1+build5", "1.2.3-rc1", 0},
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
@@ -34,6 +35,11 @@ var (
 	yumUpdateArgs            = []string{"update", "--assumeyes"}
 	yumListUpdatesArgs       = []string{"update", "--assumeno", "--cacheonly"}
 	yumListUpdateMinimalArgs = []string{"update-minimal", "--assumeno", "--cacheonly"}
+	yumVersionlockListArgs   = []string{"versionlock", "list", "--quiet"}
+	yumUpdateinfoListArgs    = []string{"updateinfo", "list", "--quiet"}
+	yumUpdateinfoCVEArgs     = []string{"updateinfo", "list", "cves", "--quiet"}
+	yumHistoryListArgs       = []string{"history", "list"}
+	yumHistoryUndoArgs       = []string{"history", "undo", "--assumeyes"}
 )
 
 func init() {
@@ -204,3 +210,144 @@ func YumUpdates(opts ...YumUpdateOption) ([]PkgInfo, error) {
 	}
 	return pkgs, nil
 }
+
+func parseYumVersionlocks(data []byte) []string {
+	/*
+		Loaded plugins: fastestmirror, versionlock
+		0:bash-4.2.46-34.el7.*
+		kernel-0:3.10.0-1062.el7.*
+		!0:curl-7.29.0-54.el7.*
+		versionlock list done
+	*/
+	var names []string
+	for _, ln := range strings.Split(string(data), "\n") {
+		ln = strings.TrimSpace(ln)
+		// Entries starting with ! exclude a version rather than lock it.
+		if ln == "" || strings.ContainsAny(ln, " \t") || strings.HasPrefix(ln, "!") {
+			continue
+		}
+		// yum lists epoch:name-version-release.arch, dnf lists
+		// name-epoch:version-release.arch, in both the name is before the
+		// last two dashes.
+		nevra := strings.TrimSuffix(ln, ".*")
+		if i := strings.Index(nevra, ":"); i != -1 && !strings.Contains(nevra[:i], "-") {
+			nevra = nevra[i+1:]
+		}
+		i := strings.LastIndex(nevra, "-")
+		if i <= 0 {
+			continue
+		}
+		j := strings.LastIndex(nevra[:i], "-")
+		if j <= 0 {
+			continue
+		}
+		names = append(names, nevra[:j])
+	}
+	return names
+}
+
+// YumVersionlockedPackages returns the names of packages locked with the yum
+// versionlock plugin, it returns nothing if the plugin is not installed.
+func YumVersionlockedPackages() ([]string, error) {
+	out, err := run(exec.Command(yum, yumVersionlockListArgs...))
+	if err != nil {
+		if bytes.Contains(out, []byte("No such command")) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseYumVersionlocks(out), nil
+}
+
+// nevraName returns the name of a name-[epoch:]version-release.arch string.
+func nevraName(nevra string) (string, bool) {
+	if i := strings.LastIndex(nevra, "."); i != -1 {
+		nevra = nevra[:i]
+	}
+	i := strings.LastIndex(nevra, "-")
+	if i <= 0 {
+		return "", false
+	}
+	j := strings.LastIndex(nevra[:i], "-")
+	if j <= 0 {
+		return "", false
+	}
+	return nevra[:j], true
+}
+
+func parseUpdateinfo(data []byte, advisories map[string][]string) {
+	/*
+		RHSA-2020:0374 Important/Sec. kernel-4.18.0-147.5.1.el8_1.x86_64
+		CVE-2019-14816 Important/Sec. kernel-4.18.0-147.5.1.el8_1.x86_64
+		FEDORA-2020-6a1ab9e5a3 security  python3-libs-3.7.6-2.fc31.x86_64
+	*/
+	for _, ln := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.Fields(ln)
+		if len(fields) != 3 {
+			continue
+		}
+		name, ok := nevraName(string(fields[2]))
+		if !ok {
+			continue
+		}
+		id := strings.ToUpper(string(fields[0]))
+		advisories[id] = append(advisories[id], name)
+	}
+}
+
+// YumAdvisories returns the names of the packages with an available update
+// keyed by the advisory and CVE IDs, in upper case, the update fixes.
+func YumAdvisories() (map[string][]string, error) {
+	advisories := make(map[string][]string)
+	for _, args := range [][]string{yumUpdateinfoListArgs, yumUpdateinfoCVEArgs} {
+		out, err := run(exec.Command(yum, args...))
+		if err != nil {
+			return nil, fmt.Errorf("error listing yum advisories: %v, stdout: %s", err, out)
+		}
+		parseUpdateinfo(out, advisories)
+	}
+	return advisories, nil
+}
+
+func parseHistoryIDs(data []byte) []int {
+	/*
+		Loaded plugins: fastestmirror
+		ID     | Login user               | Date and time    | Action(s)      | Altered
+		-------------------------------------------------------------------------------
+		    12 | root <root>              | 2020-03-01 10:00 | Update         |    5
+		     1 | System <unset>           | 2019-10-01 12:00 | Install        |  300 EE
+		history list
+	*/
+	var ids []int
+	for _, ln := range strings.Split(string(data), "\n") {
+		fields := strings.Split(ln, "|")
+		if len(fields) < 2 {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimSpace(fields[0])); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// YumHistoryIDs returns the IDs of the most recent yum history transactions.
+func YumHistoryIDs() ([]int, error) {
+	out, err := run(exec.Command(yum, yumHistoryListArgs...))
+	if err != nil {
+		return nil, fmt.Errorf("error listing yum history: %v, stdout: %s", err, out)
+	}
+	return parseHistoryIDs(out), nil
+}
+
+// YumHistoryUndo undoes the yum history transaction id.
+func YumHistoryUndo(id int) error {
+	args := append(yumHistoryUndoArgs, strconv.Itoa(id))
+	out, err := run(exec.Command(yum, args...))
+	var msg string
+	for _, s := range strings.Split(string(out), "\n") {
+		msg += fmt.Sprintf(" %s\n", s)
+	}
+	DebugLogger.Printf("yum history undo output:\n%s", msg)
+	return err
+}
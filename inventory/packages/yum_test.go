@@ -85,7 +85,7 @@ func TestParseYumUpdates(t *testing.T) {
 		data []byte
 		want []PkgInfo
 	}{
-		{"NormalCase", data, []PkgInfo{{"kernel", "x86_64", "2.6.32-754.24.3.el6"}, {"foo", "all", "2.0.0-1"}, {"bar", "x86_64", "2.0.0-1"}}},
+		{"NormalCase", data, []PkgInfo{{Name: "kernel", Arch: "x86_64", Version: "2.6.32-754.24.3.el6"}, {Name: "foo", Arch: "all", Version: "2.0.0-1"}, {Name: "bar", Arch: "x86_64", Version: "2.0.0-1"}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
 	}
@@ -97,3 +97,87 @@ func TestParseYumUpdates(t *testing.T) {
 		})
 	}
 }
+
+func TestParseYumVersionlocks(t *testing.T) {
+	data := []byte(`Loaded plugins: fastestmirror, versionlock
+0:bash-4.2.46-34.el7.*
+kernel-0:3.10.0-1062.el7.*
+google-cloud-sdk-270.0.0-1.*
+!0:curl-7.29.0-54.el7.*
+versionlock list done`)
+
+	want := []string{"bash", "kernel", "google-cloud-sdk"}
+	if got := parseYumVersionlocks(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYumVersionlocks() = %q, want %q", got, want)
+	}
+}
+
+func TestYumVersionlockedPackages(t *testing.T) {
+	run = getMockRun([]byte("No such command: versionlock."), errors.New("exit status 1"))
+	ret, err := YumVersionlockedPackages()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if ret != nil {
+		t.Errorf("unexpected return: %v", ret)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := YumVersionlockedPackages(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
+
+func TestYumAdvisories(t *testing.T) {
+	run = getMockRun([]byte(`RHSA-2019:2091 Important/Sec. systemd-219-67.el7.x86_64
+RHSA-2019:2091 Important/Sec. systemd-libs-219-67.el7.x86_64
+rhba-2019:2145 bugfix         bash-4.2.46-33.el7.x86_64
+CVE-2018-15686 Important/Sec. systemd-219-67.el7.x86_64
+updateinfo list done
+`), nil)
+	got, err := YumAdvisories()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The mock returns the same output for the advisory and CVE listing.
+	want := map[string][]string{
+		"RHSA-2019:2091": {"systemd", "systemd-libs", "systemd", "systemd-libs"},
+		"RHBA-2019:2145": {"bash", "bash"},
+		"CVE-2018-15686": {"systemd", "systemd"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("YumAdvisories() = %v, want %v", got, want)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := YumAdvisories(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
+
+func TestYumHistoryIDs(t *testing.T) {
+	run = getMockRun([]byte(`Loaded plugins: fastestmirror
+ID     | Login user               | Date and time    | Action(s)      | Altered
+-------------------------------------------------------------------------------
+    12 | root <root>              | 2020-03-01 10:00 | Update         |    5
+     1 | System <unset>           | 2019-10-01 12:00 | Install        |  300 EE
+history list
+`), nil)
+	got, err := YumHistoryIDs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{12, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("YumHistoryIDs() = %v, want %v", got, want)
+	}
+
+	run = getMockRun([]byte("No transactions"), nil)
+	if got, err := YumHistoryIDs(); err != nil || got != nil {
+		t.Errorf("YumHistoryIDs() = %v, %v, want no IDs", got, err)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, err := YumHistoryIDs(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
@@ -36,6 +36,8 @@ var (
 	zypperListUpdatesArgs = []string{"--gpg-auto-import-keys", "-q", "list-updates"}
 	zypperListPatchesArgs = []string{"--gpg-auto-import-keys", "-q", "list-patches"}
 	zypperPatchInfoArgs   = []string{"info", "-t", "patch"}
+	zypperLocksArgs       = []string{"--non-interactive", "-q", "locks"}
+	zypperListCVEArgs     = []string{"--gpg-auto-import-keys", "-q", "list-patches", "--cve"}
 )
 
 func init() {
@@ -161,7 +163,9 @@ func parseZypperUpdates(data []byte) []PkgInfo {
 		name := string(bytes.TrimSpace(pkg[2]))
 		arch := string(bytes.TrimSpace(pkg[5]))
 		ver := string(bytes.TrimSpace(pkg[4]))
-		pkgs = append(pkgs, PkgInfo{Name: name, Arch: osinfo.Architecture(arch), Version: ver})
+		p := PkgInfo{Name: name, Arch: osinfo.Architecture(arch), Version: ver}
+		p.Epoch, p.Release = versionParts(ver)
+		pkgs = append(pkgs, p)
 	}
 	return pkgs
 }
@@ -407,3 +411,70 @@ func ZypperPackagesInPatch(patches []ZypperPatch) (map[string][]string, error) {
 	}
 	return parseZypperPatchInfo(out)
 }
+
+func parseZypperLocks(data []byte) ([]string, []string) {
+	/*
+		# | Name           | Type    | Repository
+		--+----------------+---------+-----------
+		1 | kernel-default | package | (any)
+		2 | SUSE-2019-1    | patch   | (any)
+	*/
+	var pkgs, patches []string
+	for _, ln := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		fields := bytes.Split(ln, []byte("|"))
+		if len(fields) < 3 {
+			continue
+		}
+		if _, err := strconv.Atoi(string(bytes.TrimSpace(fields[0]))); err != nil {
+			continue
+		}
+		name := string(bytes.TrimSpace(fields[1]))
+		switch string(bytes.TrimSpace(fields[2])) {
+		case "package":
+			pkgs = append(pkgs, name)
+		case "patch":
+			patches = append(patches, name)
+		}
+	}
+	return pkgs, patches
+}
+
+// ZypperLocks returns the names of locked packages and patches, names may be
+// glob patterns.
+func ZypperLocks() ([]string, []string, error) {
+	out, err := run(exec.Command(zypper, zypperLocksArgs...))
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgs, patches := parseZypperLocks(out)
+	return pkgs, patches, nil
+}
+
+func parseZypperPatchCVEs(data []byte) map[string][]string {
+	/*
+		Issue | No.            | Patch                                       | Category | Severity  | Interactive | Status | Summary
+		------+----------------+---------------------------------------------+----------+-----------+-------------+--------+-------------------------------------
+		cve   | CVE-2019-11477 | SUSE-SLE-Module-Basesystem-15-SP1-2019-1550 | security | important | reboot      | needed | Security update for the Linux Kernel
+		cve   | CVE-2019-11478 | SUSE-SLE-Module-Basesystem-15-SP1-2019-1550 | security | important | reboot      | needed | Security update for the Linux Kernel
+	*/
+	cves := make(map[string][]string)
+	for _, ln := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.Split(ln, []byte("|"))
+		if len(fields) != 8 || string(bytes.TrimSpace(fields[0])) != "cve" {
+			continue
+		}
+		id := strings.ToUpper(string(bytes.TrimSpace(fields[1])))
+		cves[id] = append(cves[id], string(bytes.TrimSpace(fields[2])))
+	}
+	return cves
+}
+
+// ZypperPatchCVEs returns the names of the needed patches keyed by the CVE
+// IDs, in upper case, the patch fixes.
+func ZypperPatchCVEs() (map[string][]string, error) {
+	out, err := run(exec.Command(zypper, zypperListCVEArgs...))
+	if err != nil {
+		return nil, fmt.Errorf("error listing zypper patch CVEs: %v, stdout: %s", err, out)
+	}
+	return parseZypperPatchCVEs(out), nil
+}
@@ -68,7 +68,7 @@ this is junk data`
 		data []byte
 		want []PkgInfo
 	}{
-		{"NormalCase", []byte(normalCase), []PkgInfo{{"at", "x86_64", "3.1.14-8.3.1"}, {"autoyast2-installation", "all", "3.2.22-2.9.2"}}},
+		{"NormalCase", []byte(normalCase), []PkgInfo{{Name: "at", Arch: "x86_64", Version: "3.1.14-8.3.1", Release: "8.3.1"}, {Name: "autoyast2-installation", Arch: "all", Version: "3.2.22-2.9.2", Release: "2.9.2"}}},
 		{"NoPackages", []byte("nothing here"), nil},
 		{"nil", nil, nil},
 	}
@@ -88,7 +88,7 @@ func TestZypperUpdates(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	want := []PkgInfo{{"at", "x86_64", "3.1.14-8.3.1"}}
+	want := []PkgInfo{{Name: "at", Arch: "x86_64", Version: "3.1.14-8.3.1", Release: "8.3.1"}}
 	if !reflect.DeepEqual(ret, want) {
 		t.Errorf("ZypperUpdates() = %v, want %v", ret, want)
 	}
@@ -289,3 +289,44 @@ Conflicts   : [32]
 	}
 
 }
+
+func TestZypperLocks(t *testing.T) {
+	run = getMockRun([]byte(`
+# | Name           | Type    | Repository
+--+----------------+---------+-----------
+1 | kernel-default | package | (any)
+2 | SUSE-2019-1    | patch   | (any)
+3 | python3-*      | package | (any)
+`), nil)
+	pkgs, patches, err := ZypperLocks()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if want := []string{"kernel-default", "python3-*"}; !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("ZypperLocks() packages = %q, want %q", pkgs, want)
+	}
+	if want := []string{"SUSE-2019-1"}; !reflect.DeepEqual(patches, want) {
+		t.Errorf("ZypperLocks() patches = %q, want %q", patches, want)
+	}
+
+	run = getMockRun(nil, errors.New("bad error"))
+	if _, _, err := ZypperLocks(); err == nil {
+		t.Errorf("did not get expected error")
+	}
+}
+
+func TestParseZypperPatchCVEs(t *testing.T) {
+	data := []byte(`Issue | No.            | Patch                                       | Category | Severity  | Interactive | Status | Summary
+------+----------------+---------------------------------------------+----------+-----------+-------------+--------+-------------------------------------
+cve   | CVE-2019-11477 | SUSE-SLE-Module-Basesystem-15-SP1-2019-1550 | security | important | reboot      | needed | Security update for the Linux Kernel
+cve   | CVE-2019-11478 | SUSE-SLE-Module-Basesystem-15-SP1-2019-1550 | security | important | reboot      | needed | Security update for the Linux Kernel
+bugzilla | 1137586     | SUSE-SLE-Module-Basesystem-15-SP1-2019-1550 | security | important | reboot      | needed | Security update for the Linux Kernel`)
+
+	want := map[string][]string{
+		"CVE-2019-11477": {"SUSE-SLE-Module-Basesystem-15-SP1-2019-1550"},
+		"CVE-2019-11478": {"SUSE-SLE-Module-Basesystem-15-SP1-2019-1550"},
+	}
+	if got := parseZypperPatchCVEs(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseZypperPatchCVEs() = %v, want %v", got, want)
+	}
+}
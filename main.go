@@ -25,6 +25,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
@@ -131,6 +132,11 @@ func run(ctx context.Context) {
 		policies.Run(ctx)
 		tasker.Close()
 		return
+	case "rollback":
+		if err := agentendpoint.RollbackPatchTask(flag.Arg(1)); err != nil {
+			logger.Fatalf(err.Error())
+		}
+		return
 	case "w", "waitfortasknotification", "ospatch":
 		client, err := agentendpoint.NewClient(ctx)
 		if err != nil {
@@ -147,6 +153,9 @@ func run(ctx context.Context) {
 
 func runLoop(ctx context.Context) {
 	var taskNotificationClient *agentendpoint.Client
+	// autoUpdatesRestored is set once auto updates were restored after task
+	// notification was disabled, or at startup if it is disabled.
+	var autoUpdatesRestored bool
 	var err error
 	ticker := time.NewTicker(config.SvcPollInterval())
 	for {
@@ -166,6 +175,7 @@ func runLoop(ctx context.Context) {
 
 		if config.TaskNotificationEnabled() && (taskNotificationClient == nil || taskNotificationClient.Closed()) {
 			ospatch.DisableAutoUpdates()
+			autoUpdatesRestored = false
 
 			// Start WaitForTaskNotification if we need to.
 			taskNotificationClient, err = agentendpoint.NewClient(ctx)
@@ -174,11 +184,19 @@ func runLoop(ctx context.Context) {
 			} else {
 				taskNotificationClient.WaitForTaskNotification(ctx)
 			}
-		} else if !config.TaskNotificationEnabled() && taskNotificationClient != nil && !taskNotificationClient.Closed() {
-			// Cancel WaitForTaskNotification if we need to, this will block if there is
-			// an existing current task running.
-			if err := taskNotificationClient.Close(); err != nil {
-				logger.Errorf(err.Error())
+		} else if !config.TaskNotificationEnabled() {
+			if taskNotificationClient != nil && !taskNotificationClient.Closed() {
+				// Cancel WaitForTaskNotification if we need to, this will block if there is
+				// an existing current task running.
+				if err := taskNotificationClient.Close(); err != nil {
+					logger.Errorf(err.Error())
+				}
+			}
+			// Patch tasks no longer keep the system up to date, restore the
+			// auto updates disabled while they were enabled.
+			if !autoUpdatesRestored {
+				ospatch.EnableAutoUpdates()
+				autoUpdatesRestored = true
 			}
 		}
 
@@ -200,8 +218,70 @@ func runLoop(ctx context.Context) {
 	}
 }
 
+// runInventoryExport writes the inventory to stdout or a file instead of
+// posting it, it does not need the agent config or metadata access.
+func runInventoryExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	output := fs.String("output", "json", "output format, json or csv")
+	file := fs.String("file", "", "file to write the inventory to instead of stdout")
+	sections := fs.String("sections", "", "comma separated inventory sections to export, any of osinfo, installed, updates; all if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := logger.LogOpts{LoggerName: "OSConfigAgent", DisableLocalLogging: true, DisableCloudLogging: true, Writers: []io.Writer{os.Stderr}}
+	if err := logger.Init(ctx, opts); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Close()
+
+	if err := inventory.CheckFormat(*output); err != nil {
+		return err
+	}
+	var names []string
+	if *sections != "" {
+		for _, s := range strings.Split(*sections, ",") {
+			names = append(names, strings.TrimSpace(s))
+		}
+	}
+	// The inventory is still written if gathering some packages failed, the
+	// error is returned afterwards so the command exits non-zero.
+	inv, gatherErr := inventory.GetSections(names...)
+	if inv == nil {
+		return gatherErr
+	}
+
+	if err := writeInventory(inv, *output, *file); err != nil {
+		return err
+	}
+	if gatherErr != nil {
+		return fmt.Errorf("inventory is incomplete: %v", gatherErr)
+	}
+	return nil
+}
+
+// writeInventory exports inv to file, or stdout if file is empty.
+func writeInventory(inv *inventory.InstanceInventory, format, file string) error {
+	if file == "" {
+		return inventory.Export(os.Stdout, inv, format)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := inventory.Export(f, inv, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func main() {
 	flag.Parse()
+	if err := config.InitMetadataProvider(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	ctx, cncl := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
@@ -215,6 +295,17 @@ func main() {
 	switch action := flag.Arg(0); action {
 	case "", "run":
 		runService(ctx)
+	case "inventory", "osinventory":
+		// With flags the inventory is exported locally, without them it is
+		// posted like the agent does.
+		if flag.NArg() > 1 {
+			if err := runInventoryExport(ctx, flag.Args()[1:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+		run(ctx)
 	default:
 		run(ctx)
 	}
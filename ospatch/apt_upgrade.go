@@ -15,14 +15,27 @@
 package ospatch
 
 import (
+	"strings"
+
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
+var (
+	aptUpdates           = packages.AptUpdates
+	aptHeldPackages      = packages.AptHeldPackages
+	installedDebPackages = packages.InstalledDebPackages
+	installAptPackages   = packages.InstallAptPackages
+	aptGetChangelogCVEs  = packages.AptChangelogCVEs
+)
+
 type aptGetUpgradeOpts struct {
 	upgradeType       packages.AptUpgradeType
 	exclusivePackages []string
 	excludes          []string
+	neverPatch        []string
+	advisories        []string
+	securityOnly      bool
 	dryrun            bool
 }
 
@@ -50,6 +63,31 @@ func AptGetExclusivePackages(exclusivePackages []string) AptGetUpgradeOption {
 	}
 }
 
+// AptGetNeverPatch never updates these packages, they are reported as
+// skipped like packages held with apt-mark hold.
+func AptGetNeverPatch(neverPatch []string) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.neverPatch = neverPatch
+	}
+}
+
+// AptGetSecurityOnly only installs updates whose candidate version comes from
+// a security pocket such as bionic-security.
+func AptGetSecurityOnly(securityOnly bool) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.securityOnly = securityOnly
+	}
+}
+
+// AptGetAdvisories only installs updates that fix these CVEs, the CVEs are
+// read from the package changelogs. Debian and Ubuntu advisory IDs are not
+// recorded in the archive so only CVE IDs can be targeted.
+func AptGetAdvisories(advisories []string) AptGetUpgradeOption {
+	return func(args *aptGetUpgradeOpts) {
+		args.advisories = advisories
+	}
+}
+
 // AptGetDryRun performs a dry run.
 func AptGetDryRun(dryrun bool) AptGetUpgradeOption {
 	return func(args *aptGetUpgradeOpts) {
@@ -57,8 +95,9 @@ func AptGetDryRun(dryrun bool) AptGetUpgradeOption {
 	}
 }
 
-// RunAptGetUpgrade runs apt-get upgrade.
-func RunAptGetUpgrade(opts ...AptGetUpgradeOption) error {
+// RunAptGetUpgrade runs apt-get upgrade, the result lists every available
+// update.
+func RunAptGetUpgrade(opts ...AptGetUpgradeOption) (*Result, error) {
 	aptOpts := &aptGetUpgradeOpts{
 		upgradeType:       packages.AptGetUpgrade,
 		excludes:          nil,
@@ -70,31 +109,86 @@ func RunAptGetUpgrade(opts ...AptGetUpgradeOption) error {
 		opt(aptOpts)
 	}
 
-	pkgs, err := packages.AptUpdates(packages.AptGetUpgradeType(aptOpts.upgradeType), packages.AptGetUpgradeShowNew(true))
+	pkgs, err := aptUpdates(packages.AptGetUpgradeType(aptOpts.upgradeType), packages.AptGetUpgradeShowNew(true), packages.AptGetUpgradeSecurityOnly(aptOpts.securityOnly))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fPkgs, err := filterPackages(pkgs, aptOpts.exclusivePackages, aptOpts.excludes)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	fPkgs, err = selectAdvisories(fPkgs, aptOpts.advisories, func() (map[string][]string, error) {
+		return aptChangelogCVEs(fPkgs, aptOpts.advisories)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if len(fPkgs) == 0 {
-		logger.Infof("No packages to update.")
-		return nil
+
+	h := listHolds(aptHeldPackages, "held with apt-mark hold", aptOpts.neverPatch)
+	fPkgs = h.filter(fPkgs)
+	return updatePackages("apt", pkgs, fPkgs, h, aptOpts.dryrun, installedDebPackages, func() error {
+		return installAptPackages(pkgNames(fPkgs))
+	})
+}
+
+// aptChangelogCVEs returns the names of the packages keyed by the CVEs fixed
+// since the installed version. Packages built from the same source share a
+// changelog so it is only downloaded once per source package. A package whose
+// changelog can not be read is left out rather than failing the whole run.
+func aptChangelogCVEs(pkgs []packages.PkgInfo, ids []string) (map[string][]string, error) {
+	for _, id := range ids {
+		if !strings.HasPrefix(strings.ToUpper(id), "CVE-") {
+			logger.Warningf("Only CVE IDs can be targeted with apt, ignoring %s.", id)
+		}
 	}
 
-	var pkgNames []string
-	for _, pkg := range fPkgs {
-		pkgNames = append(pkgNames, pkg.Name)
+	installed, err := installedDebPackages()
+	if err != nil {
+		logger.Warningf("Error listing installed packages, reading the full changelogs: %v", err)
+	}
+	installedByName := make(map[string]packages.PkgInfo, len(installed))
+	for _, pkg := range installed {
+		installedByName[pkgKey(pkg.Name, pkg.Arch)] = pkg
+		installedByName[pkg.Name] = pkg
 	}
-	logger.Infof("Updating %d packages.", len(pkgNames))
-	logger.Debugf("Packages to be installed: %s", fPkgs)
 
-	if aptOpts.dryrun {
-		logger.Infof("Running in dryrun mode, not updating packages.")
-		return nil
+	type changelog struct {
+		name, since string
+		pkgs        []string
+	}
+	var changelogs []*changelog
+	bySource := make(map[string]*changelog)
+	for _, pkg := range pkgs {
+		inst, ok := installedByName[pkgKey(pkg.Name, pkg.Arch)]
+		if !ok {
+			inst = installedByName[pkg.Name]
+		}
+		source := inst.Source
+		if source == "" {
+			source = pkg.Name
+		}
+		key := strings.Join([]string{source, pkg.Version, inst.Version}, " ")
+		c, ok := bySource[key]
+		if !ok {
+			c = &changelog{name: pkg.Name, since: inst.Version}
+			bySource[key] = c
+			changelogs = append(changelogs, c)
+		}
+		c.pkgs = append(c.pkgs, pkg.Name)
 	}
 
-	return packages.InstallAptPackages(pkgNames)
+	cves := make(map[string][]string)
+	for _, c := range changelogs {
+		ids, err := aptGetChangelogCVEs(c.name, c.since)
+		if err != nil {
+			logger.Warningf("Error reading CVEs of %s: %v", strings.Join(c.pkgs, ", "), err)
+			continue
+		}
+		for _, id := range ids {
+			cves[id] = append(cves[id], c.pkgs...)
+		}
+	}
+	return cves, nil
 }
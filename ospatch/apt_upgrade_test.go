@@ -0,0 +1,112 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+func TestRunAptGetUpgradeHolds(t *testing.T) {
+	defer func() {
+		aptUpdates = packages.AptUpdates
+		aptHeldPackages = packages.AptHeldPackages
+		installedDebPackages = packages.InstalledDebPackages
+		installAptPackages = packages.InstallAptPackages
+	}()
+	aptUpdates = func(...packages.AptGetUpgradeOption) ([]packages.PkgInfo, error) {
+		return []packages.PkgInfo{{Name: "foo", Version: "2"}, {Name: "bar", Version: "2"}, {Name: "baz", Version: "2"}}, nil
+	}
+	installedDebPackages = func() ([]packages.PkgInfo, error) { return nil, nil }
+
+	tests := []struct {
+		name        string
+		held        []string
+		neverPatch  []string
+		wantInstall []string
+	}{
+		{"NoHolds", nil, nil, []string{"foo", "bar", "baz"}},
+		{"Held", []string{"bar"}, nil, []string{"foo", "baz"}},
+		{"HeldGlob", []string{"ba*"}, nil, []string{"foo"}},
+		{"NeverPatch", nil, []string{"foo"}, []string{"bar", "baz"}},
+		{"HeldAndNeverPatch", []string{"bar"}, []string{"foo"}, []string{"baz"}},
+		{"AllHeld", []string{"*"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aptHeldPackages = func() ([]string, error) { return tt.held, nil }
+			var gotInstall []string
+			installAptPackages = func(pkgs []string) error {
+				gotInstall = pkgs
+				return nil
+			}
+
+			if _, err := RunAptGetUpgrade(AptGetNeverPatch(tt.neverPatch)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(gotInstall, tt.wantInstall) {
+				t.Errorf("installed packages = %q, want %q", gotInstall, tt.wantInstall)
+			}
+		})
+	}
+}
+
+func TestAptChangelogCVEs(t *testing.T) {
+	defer func() {
+		installedDebPackages = packages.InstalledDebPackages
+		aptGetChangelogCVEs = packages.AptChangelogCVEs
+	}()
+	installedDebPackages = func() ([]packages.PkgInfo, error) {
+		return []packages.PkgInfo{
+			{Name: "libssl1.1", Arch: "x86_64", Version: "1.1.1-1", Source: "openssl"},
+			{Name: "openssl", Arch: "x86_64", Version: "1.1.1-1", Source: "openssl"},
+			{Name: "bash", Arch: "x86_64", Version: "5.0-1", Source: "bash"},
+		}, nil
+	}
+	var calls []string
+	aptGetChangelogCVEs = func(name, since string) ([]string, error) {
+		calls = append(calls, name+" "+since)
+		switch name {
+		case "libssl1.1":
+			return []string{"CVE-2020-1967"}, nil
+		case "bash":
+			return []string{"CVE-2019-18276"}, nil
+		}
+		return nil, nil
+	}
+
+	pkgs := []packages.PkgInfo{
+		{Name: "libssl1.1", Arch: "x86_64", Version: "1.1.1-2"},
+		{Name: "openssl", Arch: "x86_64", Version: "1.1.1-2"},
+		{Name: "bash", Arch: "x86_64", Version: "5.0-2"},
+	}
+	got, err := aptChangelogCVEs(pkgs, []string{"CVE-2020-1967"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"CVE-2020-1967":  {"libssl1.1", "openssl"},
+		"CVE-2019-18276": {"bash"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("aptChangelogCVEs() = %v, want %v", got, want)
+	}
+	// The openssl changelog is only read once for both of its packages.
+	if wantCalls := []string{"libssl1.1 1.1.1-1", "bash 5.0-1"}; !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("changelogs read = %q, want %q", calls, wantCalls)
+	}
+}
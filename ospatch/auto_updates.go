@@ -0,0 +1,79 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"strings"
+)
+
+// autoUpdatesMarker precedes an option changed to disable auto updates, it
+// is followed by the original line so the change can be reverted.
+const autoUpdatesMarker = "# Disabled by google-osconfig-agent, original setting: "
+
+// disableOption sets key in section of an ini or shell style config file to
+// value, keeping the original line in a marker comment. Lines before the first
+// section are in section "". Options that are missing or already set to value
+// are left alone, as they are not enabling auto updates.
+func disableOption(data []byte, section, key, value string) ([]byte, bool) {
+	lines := strings.Split(string(data), "\n")
+	var current string
+	var changed bool
+	for i := 0; i < len(lines); i++ {
+		ln := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(ln, "[") && strings.HasSuffix(ln, "]") {
+			current = strings.TrimSpace(ln[1 : len(ln)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		eq := strings.Index(lines[i], "=")
+		if eq == -1 || strings.TrimSpace(lines[i][:eq]) != key {
+			continue
+		}
+		if i > 0 && strings.HasPrefix(lines[i-1], autoUpdatesMarker) {
+			// Already disabled.
+			continue
+		}
+		rest := lines[i][eq+1:]
+		if strings.Trim(strings.TrimSpace(rest), `"'`) == value {
+			continue
+		}
+		ws := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+		disabled := lines[i][:eq+1] + ws + value
+		lines = append(lines[:i], append([]string{autoUpdatesMarker + lines[i], disabled}, lines[i+1:]...)...)
+		i++
+		changed = true
+	}
+	return []byte(strings.Join(lines, "\n")), changed
+}
+
+// restoreOptions reverts the options changed by disableOption.
+func restoreOptions(data []byte) ([]byte, bool) {
+	lines := strings.Split(string(data), "\n")
+	var out []string
+	var changed bool
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], autoUpdatesMarker) && i+1 < len(lines) {
+			out = append(out, strings.TrimPrefix(lines[i], autoUpdatesMarker))
+			// Skip the disabled setting.
+			i++
+			changed = true
+			continue
+		}
+		out = append(out, lines[i])
+	}
+	return []byte(strings.Join(out, "\n")), changed
+}
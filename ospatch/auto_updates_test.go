@@ -0,0 +1,76 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"testing"
+)
+
+func TestDisableAndRestoreOption(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		section     string
+		key         string
+		value       string
+		want        string
+		wantChanged bool
+	}{
+		{
+			"DnfAutomatic",
+			"[commands]\nupgrade_type = default\napply_updates = yes\n\n[emitters]\napply_updates = yes\n",
+			"commands", "apply_updates", "no",
+			"[commands]\nupgrade_type = default\n" + autoUpdatesMarker + "apply_updates = yes\napply_updates = no\n\n[emitters]\napply_updates = yes\n",
+			true,
+		},
+		{
+			"ShellStyle",
+			"# Don't install, just check.\nCHECK_ONLY=no\nDOWNLOAD_ONLY=no\n",
+			"", "CHECK_ONLY", "yes",
+			"# Don't install, just check.\n" + autoUpdatesMarker + "CHECK_ONLY=no\nCHECK_ONLY=yes\nDOWNLOAD_ONLY=no\n",
+			true,
+		},
+		{
+			"AlreadyDisabled",
+			"[commands]\napply_updates = no\n",
+			"commands", "apply_updates", "no",
+			"[commands]\napply_updates = no\n",
+			false,
+		},
+		{
+			"Missing",
+			"[commands]\nupgrade_type = security\n",
+			"commands", "apply_updates", "no",
+			"[commands]\nupgrade_type = security\n",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := disableOption([]byte(tt.in), tt.section, tt.key, tt.value)
+			if string(got) != tt.want || changed != tt.wantChanged {
+				t.Fatalf("disableOption() = %q, %t, want %q, %t", got, changed, tt.want, tt.wantChanged)
+			}
+			// Disabling again does not change anything.
+			if again, changed := disableOption(got, tt.section, tt.key, tt.value); changed || string(again) != tt.want {
+				t.Errorf("second disableOption() = %q, %t, want no change", again, changed)
+			}
+			restored, changed := restoreOptions(got)
+			if string(restored) != tt.in || changed != tt.wantChanged {
+				t.Errorf("restoreOptions() = %q, %t, want %q, %t", restored, changed, tt.in, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+var (
+	dnfUpdates               = packages.DnfUpdates
+	dnfAdvisories            = packages.DnfAdvisories
+	dnfVersionlockedPackages = packages.DnfVersionlockedPackages
+	installDnfPackages       = packages.InstallDnfPackages
+)
+
+type dnfUpdateOpts struct {
+	security          bool
+	minimal           bool
+	exclusivePackages []string
+	excludes          []string
+	neverPatch        []string
+	advisories        []string
+	dryrun            bool
+}
+
+// DnfUpdateOption is an option for dnf upgrade.
+type DnfUpdateOption func(*dnfUpdateOpts)
+
+// DnfUpdateSecurity returns a DnfUpdateOption that limits the upgrade to
+// packages with a security advisory.
+func DnfUpdateSecurity(security bool) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.security = security
+	}
+}
+
+// DnfUpdateMinimal returns a DnfUpdateOption that specifies the
+// upgrade-minimal command should be used.
+func DnfUpdateMinimal(minimal bool) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.minimal = minimal
+	}
+}
+
+// DnfUpdateExcludes returns a DnfUpdateOption that specifies what packages to
+// exclude from the upgrade.
+func DnfUpdateExcludes(excludes []string) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.excludes = excludes
+	}
+}
+
+// DnfExclusivePackages includes only these packages in the upgrade.
+func DnfExclusivePackages(exclusivePackages []string) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.exclusivePackages = exclusivePackages
+	}
+}
+
+// DnfUpdateNeverPatch never updates these packages, they are reported as
+// skipped like packages locked with dnf versionlock.
+func DnfUpdateNeverPatch(neverPatch []string) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.neverPatch = neverPatch
+	}
+}
+
+// DnfUpdateAdvisories only installs updates that fix these advisories or CVEs.
+func DnfUpdateAdvisories(advisories []string) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.advisories = advisories
+	}
+}
+
+// DnfDryRun performs a dry run.
+func DnfDryRun(dryrun bool) DnfUpdateOption {
+	return func(args *dnfUpdateOpts) {
+		args.dryrun = dryrun
+	}
+}
+
+// dnfInstallSpecs returns the package specs to pass to dnf install. For a
+// minimal upgrade the version is pinned, otherwise dnf would install the
+// latest version.
+func dnfInstallSpecs(pkgs []packages.PkgInfo, minimal bool) []string {
+	if !minimal {
+		return pkgNames(pkgs)
+	}
+	var specs []string
+	for _, pkg := range pkgs {
+		specs = append(specs, pkg.Name+"-"+pkg.Version)
+	}
+	return specs
+}
+
+// RunDnfUpdate runs dnf upgrade, the result lists every available update.
+func RunDnfUpdate(opts ...DnfUpdateOption) (*Result, error) {
+	dnfOpts := &dnfUpdateOpts{
+		security: false,
+		minimal:  false,
+		dryrun:   false,
+	}
+
+	for _, opt := range opts {
+		opt(dnfOpts)
+	}
+
+	pkgs, err := dnfUpdates(packages.DnfUpdateMinimal(dnfOpts.minimal), packages.DnfUpdateSecurity(dnfOpts.security))
+	if err != nil {
+		return nil, err
+	}
+
+	fPkgs, err := filterPackages(pkgs, dnfOpts.exclusivePackages, dnfOpts.excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	fPkgs, err = selectAdvisories(fPkgs, dnfOpts.advisories, dnfAdvisories)
+	if err != nil {
+		return nil, err
+	}
+
+	h := listHolds(dnfVersionlockedPackages, "locked with dnf versionlock", dnfOpts.neverPatch)
+	fPkgs = h.filter(fPkgs)
+	return updatePackages("dnf", pkgs, fPkgs, h, dnfOpts.dryrun, installedRPMPackages, func() error {
+		return installDnfPackages(dnfInstallSpecs(fPkgs, dnfOpts.minimal))
+	})
+}
@@ -0,0 +1,127 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+func TestRunDnfUpdate(t *testing.T) {
+	defer func() {
+		dnfUpdates = packages.DnfUpdates
+		dnfAdvisories = packages.DnfAdvisories
+		dnfVersionlockedPackages = packages.DnfVersionlockedPackages
+		installedRPMPackages = packages.InstalledRPMPackages
+		installDnfPackages = packages.InstallDnfPackages
+	}()
+	dnfUpdates = func(...packages.DnfUpdateOption) ([]packages.PkgInfo, error) {
+		return []packages.PkgInfo{{Name: "foo", Arch: "x86_64", Version: "2.0-1"}, {Name: "bar", Arch: "x86_64", Version: "2.0-1"}, {Name: "baz", Arch: "noarch", Version: "2.0-1"}}, nil
+	}
+	dnfAdvisories = func() (map[string][]string, error) {
+		return map[string][]string{"RHSA-2020:0001": {"bar"}, "CVE-2020-0001": {"baz"}}, nil
+	}
+
+	const lockReason = "locked with dnf versionlock"
+	tests := []struct {
+		name        string
+		opts        []DnfUpdateOption
+		held        []string
+		wantInstall []string
+		// wantStatus is the status, and for skipped packages the reason, of
+		// each package in the result.
+		wantStatus map[string]string
+	}{
+		{
+			name:        "NoHolds",
+			wantInstall: []string{"foo", "bar", "baz"},
+			wantStatus:  map[string]string{"foo": "UPDATED", "bar": "UPDATED", "baz": "UPDATED"},
+		},
+		{
+			name:        "Versionlock",
+			held:        []string{"ba*"},
+			wantInstall: []string{"foo"},
+			wantStatus:  map[string]string{"foo": "UPDATED", "bar": lockReason, "baz": lockReason},
+		},
+		{
+			name:        "NeverPatch",
+			opts:        []DnfUpdateOption{DnfUpdateNeverPatch([]string{"foo"})},
+			held:        []string{"bar"},
+			wantInstall: []string{"baz"},
+			wantStatus:  map[string]string{"foo": reasonNeverPatch, "bar": lockReason, "baz": "UPDATED"},
+		},
+		{
+			name:        "Minimal",
+			opts:        []DnfUpdateOption{DnfUpdateMinimal(true), DnfUpdateExcludes([]string{"baz"})},
+			wantInstall: []string{"foo-2.0-1", "bar-2.0-1"},
+			wantStatus:  map[string]string{"foo": "UPDATED", "bar": "UPDATED", "baz": reasonExcluded},
+		},
+		{
+			name:        "Advisories",
+			opts:        []DnfUpdateOption{DnfUpdateAdvisories([]string{"rhsa-2020:0001", "CVE-2020-0001"})},
+			held:        []string{"baz"},
+			wantInstall: []string{"bar"},
+			wantStatus:  map[string]string{"foo": reasonExcluded, "bar": "UPDATED", "baz": lockReason},
+		},
+		{
+			name:       "DryRun",
+			opts:       []DnfUpdateOption{DnfDryRun(true), DnfUpdateNeverPatch([]string{"baz"})},
+			wantStatus: map[string]string{"foo": reasonDryRun, "bar": reasonDryRun, "baz": reasonNeverPatch},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installed := []packages.PkgInfo{{Name: "foo", Arch: "x86_64", Version: "1.0-1"}, {Name: "bar", Arch: "x86_64", Version: "1.0-1"}, {Name: "baz", Arch: "noarch", Version: "1.0-1"}}
+			installedRPMPackages = func() ([]packages.PkgInfo, error) { return installed, nil }
+			dnfVersionlockedPackages = func() ([]string, error) { return tt.held, nil }
+			var gotInstall []string
+			installDnfPackages = func(pkgs []string) error {
+				gotInstall = pkgs
+				var after []packages.PkgInfo
+				for _, pkg := range installed {
+					for _, spec := range pkgs {
+						if spec == pkg.Name || strings.HasPrefix(spec, pkg.Name+"-") {
+							pkg.Version = "2.0-1"
+						}
+					}
+					after = append(after, pkg)
+				}
+				installed = after
+				return nil
+			}
+
+			res, err := RunDnfUpdate(tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(gotInstall, tt.wantInstall) {
+				t.Errorf("installed packages = %q, want %q", gotInstall, tt.wantInstall)
+			}
+			gotStatus := make(map[string]string)
+			for _, pkg := range res.Packages {
+				gotStatus[pkg.Name] = string(pkg.Status)
+				if pkg.Status == PackageSkipped {
+					gotStatus[pkg.Name] = pkg.Reason
+				}
+			}
+			if !reflect.DeepEqual(gotStatus, tt.wantStatus) {
+				t.Errorf("package results = %q, want %q", gotStatus, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -15,13 +15,13 @@
 package ospatch
 
 import (
-	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
 type googetUpdateOpts struct {
 	exclusivePackages []string
 	excludes          []string
+	neverPatch        []string
 	dryrun            bool
 }
 
@@ -42,6 +42,13 @@ func GooGetExclusivePackages(exclusivePackages []string) GooGetUpdateOption {
 	}
 }
 
+// GooGetNeverPatch never updates these packages.
+func GooGetNeverPatch(neverPatch []string) GooGetUpdateOption {
+	return func(args *googetUpdateOpts) {
+		args.neverPatch = neverPatch
+	}
+}
+
 // GooGetDryRun performs a dry run.
 func GooGetDryRun(dryrun bool) GooGetUpdateOption {
 	return func(args *googetUpdateOpts) {
@@ -49,8 +56,9 @@ func GooGetDryRun(dryrun bool) GooGetUpdateOption {
 	}
 }
 
-// RunGooGetUpdate runs googet update.
-func RunGooGetUpdate(opts ...GooGetUpdateOption) error {
+// RunGooGetUpdate runs googet update, the result lists every available
+// update.
+func RunGooGetUpdate(opts ...GooGetUpdateOption) (*Result, error) {
 	googetOpts := &googetUpdateOpts{}
 
 	for _, opt := range opts {
@@ -59,29 +67,17 @@ func RunGooGetUpdate(opts ...GooGetUpdateOption) error {
 
 	pkgs, err := packages.GooGetUpdates()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fPkgs, err := filterPackages(pkgs, googetOpts.exclusivePackages, googetOpts.excludes)
 	if err != nil {
-		return err
-	}
-	if len(fPkgs) == 0 {
-		logger.Infof("No packages to update.")
-		return nil
-	}
-
-	var pkgNames []string
-	for _, pkg := range fPkgs {
-		pkgNames = append(pkgNames, pkg.Name)
-	}
-	logger.Infof("Updating %d packages.", len(pkgNames))
-	logger.Debugf("Packages to be installed: %s", fPkgs)
-
-	if googetOpts.dryrun {
-		logger.Infof("Running in dryrun mode, not updating packages.")
-		return nil
+		return nil, err
 	}
 
-	return packages.InstallGooGetPackages(pkgNames)
+	h := holds{neverPatch: googetOpts.neverPatch}
+	fPkgs = h.filter(fPkgs)
+	return updatePackages("googet", pkgs, fPkgs, h, googetOpts.dryrun, packages.InstalledGooGetPackages, func() error {
+		return packages.InstallGooGetPackages(pkgNames(fPkgs))
+	})
 }
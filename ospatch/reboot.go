@@ -0,0 +1,223 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+)
+
+const (
+	rpmquery        = "/usr/bin/rpmquery"
+	needsRestarting = "/usr/bin/needs-restarting"
+)
+
+// maxReasonItems limits how many packages or files are listed in a reboot
+// reason.
+const maxReasonItems = 5
+
+func listItems(items []string) string {
+	if len(items) <= maxReasonItems {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:maxReasonItems], ", "), len(items)-maxReasonItems)
+}
+
+// parseNeedsRestarting parses the output of needs-restarting -r, ok is false
+// if the output is not recognized, for example because the installed version
+// does not support -r.
+func parseNeedsRestarting(out []byte) (required bool, reason string, ok bool) {
+	/*
+		Core libraries or services have been updated since boot-up:
+		  * kernel
+		  * glibc
+
+		Reboot is required to fully utilize these updates.
+		More information: https://access.redhat.com/solutions/27943
+
+		No core libraries or services have been updated since boot-up.
+		Reboot should not be necessary.
+
+		EL7 lists 'kernel -> 3.10.0-1062.el7' and 'Reboot is probably not
+		necessary.'
+	*/
+	switch {
+	case bytes.Contains(out, []byte("Reboot is required")):
+		var updated []string
+		for _, ln := range strings.Split(string(out), "\n") {
+			if !strings.HasPrefix(ln, " ") {
+				continue
+			}
+			if item := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ln), "*")); item != "" {
+				updated = append(updated, item)
+			}
+		}
+		return true, "needs-restarting reports core libraries or services updated since boot: " + listItems(updated), true
+	case bytes.Contains(out, []byte("Reboot should not be necessary")), bytes.Contains(out, []byte("Reboot is probably not necessary")):
+		return false, "", true
+	default:
+		return false, "", false
+	}
+}
+
+// rpmKernelPackages are the packages installing a kernel image on rpm
+// systems, they are queried when the package of the running kernel can not
+// be found.
+var rpmKernelPackages = []string{"kernel", "kernel-core", "kernel-default", "kernel-uek", "kernel-uek-core", "kernel-rt", "kernel-rt-core"}
+
+// checkKernel reports whether the running kernel, as reported by uname -r, is
+// older than the newest installed kernel of the same package, rpmq runs
+// rpmquery with the given arguments. A system without a known kernel package,
+// such as a container, does not require a reboot.
+func checkKernel(running string, rpmq func(args ...string) ([]byte, error)) (bool, string) {
+	names := rpmKernelPackages
+	if out, err := rpmq("--queryformat", "%{NAME}\n", "-f", "/boot/vmlinuz-"+running); err == nil {
+		if fields := strings.Fields(string(out)); len(fields) > 0 {
+			names = fields[:1]
+		}
+	}
+
+	// rpmquery exits non zero if any of the packages is not installed.
+	out, _ := rpmq(append([]string{"--queryformat", "%{INSTALLTIME} %{VERSION}-%{RELEASE}.%{ARCH}\n"}, names...)...)
+	installed := newestKernel(out)
+	if installed == "" {
+		logger.Debugf("No kernel package of %s is installed, not checking the running kernel.", strings.Join(names, ", "))
+		return false, ""
+	}
+	logger.Debugf("Running kernel %s, newest installed kernel %s.", running, installed)
+	if kernelMatches(running, installed) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("running kernel %s is not the newest installed kernel %s", running, installed)
+}
+
+// newestKernel returns the version-release.arch of the most recently
+// installed kernel from rpmquery output in the
+// '%{INSTALLTIME} %{VERSION}-%{RELEASE}.%{ARCH}' format.
+func newestKernel(out []byte) string {
+	var newest string
+	var newestTime int64
+	for _, ln := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(ln)
+		if len(fields) != 2 {
+			continue
+		}
+		t, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if t >= newestTime {
+			newest, newestTime = fields[1], t
+		}
+	}
+	return newest
+}
+
+// kernelMatches reports whether the running kernel, as reported by uname -r,
+// is the installed kernel version-release.arch. SUSE kernels report
+// 4.12.14-122.17-default for the 4.12.14-122.17.1 release.
+func kernelMatches(running, installed string) bool {
+	if running == installed {
+		return true
+	}
+	i := strings.LastIndex(running, "-")
+	if i == -1 {
+		return false
+	}
+	return strings.HasPrefix(installed, running[:i]+".")
+}
+
+// deletedFiles returns the deleted shared libraries and executables used by
+// each process in the proc file system mounted at proc, from the process
+// maps and exe link. Processes that exit or can not be read are skipped.
+func deletedFiles(proc string) map[int][]string {
+	/*
+		7f5c2a1b2000-7f5c2a1d9000 r-xp 00000000 fd:01 1234 /usr/lib64/libc-2.28.so (deleted)
+	*/
+	dirs, err := filepath.Glob(filepath.Join(proc, "[0-9]*"))
+	if err != nil {
+		return nil
+	}
+	files := make(map[int][]string)
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "maps"))
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, ln := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(ln)
+			if len(fields) < 7 || fields[len(fields)-1] != "(deleted)" {
+				continue
+			}
+			path := strings.Join(fields[5:len(fields)-1], " ")
+			if seen[path] || !isLibraryOrBinary(path) {
+				continue
+			}
+			seen[path] = true
+			files[pid] = append(files[pid], path)
+		}
+		if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil && strings.HasSuffix(exe, " (deleted)") {
+			path := strings.TrimSuffix(exe, " (deleted)")
+			if !seen[path] && isLibraryOrBinary(path) {
+				files[pid] = append(files[pid], path)
+			}
+		}
+	}
+	return files
+}
+
+// isLibraryOrBinary filters out deleted mappings that are not package files,
+// such as shared memory and memfd mappings.
+func isLibraryOrBinary(path string) bool {
+	for _, prefix := range []string{"/dev/", "/memfd:", "/tmp/", "/run/", "/var/", "/home/"} {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return strings.Contains(filepath.Base(path), ".so") || strings.Contains(path, "bin/") || strings.Contains(path, "/libexec/")
+}
+
+// deletedFilesReason describes the deleted files in use, or returns an empty
+// string if there are none.
+func deletedFilesReason(files map[int][]string) string {
+	pids := make(map[string][]int)
+	for pid, paths := range files {
+		for _, path := range paths {
+			pids[path] = append(pids[path], pid)
+		}
+	}
+	if len(pids) == 0 {
+		return ""
+	}
+	var paths []string
+	for path := range pids {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("%d processes use deleted or replaced files: %s", len(files), listItems(paths))
+}
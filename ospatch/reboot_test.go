@@ -0,0 +1,172 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNeedsRestarting(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           string
+		wantRequired bool
+		wantReason   string
+		wantOK       bool
+	}{
+		{
+			"Required",
+			"Core libraries or services have been updated since boot-up:\n  * kernel\n  * glibc\n\nReboot is required to fully utilize these updates.\nMore information: https://access.redhat.com/solutions/27943\n",
+			true,
+			"needs-restarting reports core libraries or services updated since boot: kernel, glibc",
+			true,
+		},
+		{"NotRequired", "No core libraries or services have been updated since boot-up.\nReboot should not be necessary.\n", false, "", true},
+		{"EL7NotRequired", "No core libraries or services have been updated.\nReboot is probably not necessary.\n", false, "", true},
+		{"Unsupported", "Usage: needs-restarting [options]\n\nneeds-restarting: error: no such option: -r\n", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			required, reason, ok := parseNeedsRestarting([]byte(tt.in))
+			if required != tt.wantRequired || reason != tt.wantReason || ok != tt.wantOK {
+				t.Errorf("parseNeedsRestarting() = (%t, %q, %t), want (%t, %q, %t)", required, reason, ok, tt.wantRequired, tt.wantReason, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewestKernel(t *testing.T) {
+	in := "1580000000 3.10.0-1062.el7.x86_64\n1590000000 3.10.0-1127.el7.x86_64\npackage kernel-core is not installed\n1570000000 3.10.0-957.el7.x86_64\n"
+	if got, want := newestKernel([]byte(in)), "3.10.0-1127.el7.x86_64"; got != want {
+		t.Errorf("newestKernel() = %q, want %q", got, want)
+	}
+	if got := newestKernel([]byte("package kernel is not installed\n")); got != "" {
+		t.Errorf("newestKernel() = %q, want empty", got)
+	}
+}
+
+func TestKernelMatches(t *testing.T) {
+	tests := []struct {
+		running, installed string
+		want               bool
+	}{
+		{"3.10.0-1127.el7.x86_64", "3.10.0-1127.el7.x86_64", true},
+		{"3.10.0-1062.el7.x86_64", "3.10.0-1127.el7.x86_64", false},
+		{"4.12.14-122.17-default", "4.12.14-122.17.1.x86_64", true},
+		{"4.12.14-122.12-default", "4.12.14-122.17.1.x86_64", false},
+		{"5.4.0", "5.4.0-1.x86_64", false},
+	}
+	for _, tt := range tests {
+		if got := kernelMatches(tt.running, tt.installed); got != tt.want {
+			t.Errorf("kernelMatches(%q, %q) = %t, want %t", tt.running, tt.installed, got, tt.want)
+		}
+	}
+}
+
+func TestCheckKernel(t *testing.T) {
+	const running = "5.4.17-2011.0.7.el8uek.x86_64"
+	tests := []struct {
+		name         string
+		owner        string
+		kernels      map[string]string
+		wantQuery    string
+		wantRequired bool
+	}{
+		{"NoKernelPackage", "", nil, strings.Join(rpmKernelPackages, " "), false},
+		{"RunningNewest", "kernel-uek-core", map[string]string{"kernel-uek-core": "1590000000 5.4.17-2011.0.7.el8uek.x86_64\n"}, "kernel-uek-core", false},
+		{"NewerInstalled", "kernel-uek-core", map[string]string{"kernel-uek-core": "1590000000 5.4.17-2011.0.7.el8uek.x86_64\n1600000000 5.4.17-2011.1.2.el8uek.x86_64\n"}, "kernel-uek-core", true},
+		// A newer kernel of another flavor does not require a reboot.
+		{"OtherFlavor", "kernel-uek-core", map[string]string{"kernel-uek-core": "1590000000 5.4.17-2011.0.7.el8uek.x86_64\n", "kernel-core": "1600000000 4.18.0-193.el8.x86_64\n"}, "kernel-uek-core", false},
+		{"UnownedKernel", "", map[string]string{"kernel-uek": "1600000000 5.4.17-2011.1.2.el8uek.x86_64\n"}, strings.Join(rpmKernelPackages, " "), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery string
+			rpmq := func(args ...string) ([]byte, error) {
+				if args[2] == "-f" {
+					if tt.owner == "" {
+						return []byte("file /boot/vmlinuz-" + running + " is not owned by any package\n"), errors.New("exit status 1")
+					}
+					return []byte(tt.owner + "\n"), nil
+				}
+				gotQuery = strings.Join(args[2:], " ")
+				var out string
+				for _, name := range args[2:] {
+					if k, ok := tt.kernels[name]; ok {
+						out += k
+					} else {
+						out += "package " + name + " is not installed\n"
+					}
+				}
+				return []byte(out), nil
+			}
+
+			got, reason := checkKernel(running, rpmq)
+			if got != tt.wantRequired {
+				t.Errorf("checkKernel() = %t, %q, want %t", got, reason, tt.wantRequired)
+			}
+			if gotQuery != tt.wantQuery {
+				t.Errorf("checkKernel() queried %q, want %q", gotQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestDeletedFiles(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	procs := map[string]string{
+		"1": "7f5c2a1b2000-7f5c2a1d9000 r-xp 00000000 fd:01 1234 /usr/lib64/libc-2.28.so (deleted)\n" +
+			"7f5c2a1d9000-7f5c2a1da000 r--p 00027000 fd:01 1234 /usr/lib64/libc-2.28.so (deleted)\n" +
+			"7f5c2a1da000-7f5c2a1db000 rw-s 00000000 00:05 5678 /dev/zero (deleted)\n",
+		"22": "7f5c2a1b2000-7f5c2a1d9000 r-xp 00000000 fd:01 4321 /usr/sbin/sshd (deleted)\n" +
+			"7f5c2a1d9000-7f5c2a1da000 rw-s 00000000 00:01 8765 /memfd:pulseaudio (deleted)\n",
+		"333":  "7f5c2a1b2000-7f5c2a1d9000 r-xp 00000000 fd:01 1111 /usr/lib64/libz.so.1.2.11\n",
+		"self": "7f5c2a1b2000-7f5c2a1d9000 r-xp 00000000 fd:01 1234 /usr/lib64/libc-2.28.so (deleted)\n",
+	}
+	for pid, maps := range procs {
+		if err := os.Mkdir(filepath.Join(td, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(td, pid, "maps"), []byte(maps), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/usr/bin/cron (deleted)", filepath.Join(td, "333", "exe")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := deletedFiles(td)
+	want := map[int][]string{1: {"/usr/lib64/libc-2.28.so"}, 22: {"/usr/sbin/sshd"}, 333: {"/usr/bin/cron"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deletedFiles() = %v, want %v", got, want)
+	}
+	if got, want := deletedFilesReason(got), "3 processes use deleted or replaced files: /usr/bin/cron, /usr/lib64/libc-2.28.so, /usr/sbin/sshd"; got != want {
+		t.Errorf("deletedFilesReason() = %q, want %q", got, want)
+	}
+	if got := deletedFilesReason(nil); got != "" {
+		t.Errorf("deletedFilesReason(nil) = %q, want empty", got)
+	}
+}
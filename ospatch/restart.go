@@ -0,0 +1,139 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+)
+
+// neverRestartUnits are units that can not be safely restarted without
+// disrupting the system or logged in users.
+var neverRestartUnits = []string{
+	"dbus.service",
+	"dbus-broker.service",
+	"systemd-logind.service",
+	"getty@*.service",
+	"serial-getty@*.service",
+	"user@*.service",
+	"gdm.service",
+	"lightdm.service",
+	"sddm.service",
+}
+
+// ServiceRestarts describes the systemd units using deleted or replaced
+// files after patching.
+type ServiceRestarts struct {
+	// Units are the units to restart.
+	Units []string `json:",omitempty"`
+	// Skipped are units using replaced files that are not restarted, such as
+	// the agent itself.
+	Skipped []string `json:",omitempty"`
+	// RebootReason is set if restarting units is not enough because the
+	// kernel or init changed.
+	RebootReason string `json:",omitempty"`
+}
+
+// parseCgroupUnit returns the systemd system service of a process from its
+// /proc/<pid>/cgroup, or an empty string if the process does not belong to
+// one.
+func parseCgroupUnit(data []byte) string {
+	/*
+		cgroup v1:
+		12:pids:/system.slice/sshd.service
+		1:name=systemd:/system.slice/sshd.service
+
+		cgroup v2:
+		0::/system.slice/sshd.service
+	*/
+	for _, ln := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(ln, ":", 3)
+		if len(fields) != 3 || (fields[1] != "name=systemd" && fields[1] != "") {
+			continue
+		}
+		path := strings.Split(strings.Trim(fields[2], "/"), "/")
+		if len(path) < 2 || path[0] != "system.slice" {
+			return ""
+		}
+		for _, p := range path[1:] {
+			if strings.HasSuffix(p, ".service") {
+				return p
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// planRestarts maps the processes using deleted files to the units to
+// restart. The unit of the process self is never restarted.
+func planRestarts(proc string, files map[int][]string, self int) *ServiceRestarts {
+	unitOf := func(pid int) string {
+		data, err := ioutil.ReadFile(filepath.Join(proc, strconv.Itoa(pid), "cgroup"))
+		if err != nil {
+			return ""
+		}
+		return parseCgroupUnit(data)
+	}
+
+	s := &ServiceRestarts{}
+	if paths, ok := files[1]; ok {
+		s.RebootReason = fmt.Sprintf("init (pid 1) uses deleted or replaced files: %s", listItems(paths))
+	}
+	selfUnit := unitOf(self)
+	units := make(map[string]bool)
+	skipped := make(map[string]bool)
+	for pid, paths := range files {
+		if pid == 1 {
+			continue
+		}
+		unit := unitOf(pid)
+		switch {
+		case unit == "":
+			logger.Debugf("Process %d uses deleted or replaced files %q but is not part of a system service.", pid, paths)
+		case unit == selfUnit || matchesAny(neverRestartUnits, unit):
+			skipped[unit] = true
+		default:
+			units[unit] = true
+		}
+	}
+	for u := range units {
+		s.Units = append(s.Units, u)
+	}
+	for u := range skipped {
+		s.Skipped = append(s.Skipped, u)
+	}
+	sort.Strings(s.Units)
+	sort.Strings(s.Skipped)
+	return s
+}
+
+// kernelPackages returns the kernel packages of the packages that requested
+// a reboot on Debian based systems, from /var/run/reboot-required.pkgs.
+func kernelPackages(pkgs []string) []string {
+	var kernels []string
+	for _, p := range pkgs {
+		if strings.HasPrefix(p, "linux-image") || strings.HasPrefix(p, "linux-signed-image") {
+			kernels = append(kernels, p)
+		}
+	}
+	return kernels
+}
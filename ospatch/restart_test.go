@@ -0,0 +1,95 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCgroupUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"V1", "12:pids:/system.slice/sshd.service\n1:name=systemd:/system.slice/sshd.service\n", "sshd.service"},
+		{"V2", "0::/system.slice/cron.service\n", "cron.service"},
+		{"Nested", "0::/system.slice/containerd.service/kubepods/pod1\n", "containerd.service"},
+		{"Session", "0::/user.slice/user-1000.slice/session-3.scope\n", ""},
+		{"Scope", "0::/system.slice/docker-abc.scope\n", ""},
+		{"Kernel", "0::/\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCgroupUnit([]byte(tt.in)); got != tt.want {
+				t.Errorf("parseCgroupUnit() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanRestarts(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	cgroups := map[string]string{
+		"1":   "0::/init.scope\n",
+		"10":  "0::/system.slice/sshd.service\n",
+		"11":  "0::/system.slice/sshd.service\n",
+		"12":  "0::/system.slice/dbus.service\n",
+		"13":  "0::/system.slice/google-osconfig-agent.service\n",
+		"14":  "0::/user.slice/user-1000.slice/session-3.scope\n",
+		"15":  "0::/system.slice/cron.service\n",
+		"100": "0::/system.slice/google-osconfig-agent.service\n",
+	}
+	for pid, cgroup := range cgroups {
+		if err := os.Mkdir(filepath.Join(td, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(td, pid, "cgroup"), []byte(cgroup), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lib := []string{"/usr/lib64/libc-2.28.so"}
+	files := map[int][]string{10: lib, 11: lib, 12: lib, 13: lib, 14: lib, 15: lib}
+	want := &ServiceRestarts{
+		Units:   []string{"cron.service", "sshd.service"},
+		Skipped: []string{"dbus.service", "google-osconfig-agent.service"},
+	}
+	if got := planRestarts(td, files, 100); !reflect.DeepEqual(got, want) {
+		t.Errorf("planRestarts() = %+v, want %+v", got, want)
+	}
+
+	files[1] = []string{"/usr/lib/systemd/systemd"}
+	if got := planRestarts(td, files, 100); got.RebootReason == "" {
+		t.Errorf("planRestarts() should require a reboot when init uses deleted files: %+v", got)
+	}
+}
+
+func TestKernelPackages(t *testing.T) {
+	got := kernelPackages([]string{"libc6", "linux-image-4.19.0-9-cloud-amd64", "dbus", "linux-signed-image-5.4.0-1-generic"})
+	want := []string{"linux-image-4.19.0-9-cloud-amd64", "linux-signed-image-5.4.0-1-generic"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kernelPackages() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+// PackageStatus is the outcome of a patch run for a single package.
+type PackageStatus string
+
+const (
+	// PackageUpdated means the package is at the new version after the run.
+	PackageUpdated PackageStatus = "UPDATED"
+	// PackageFailed means the package was selected for update but is not at
+	// the new version after the run.
+	PackageFailed PackageStatus = "FAILED"
+	// PackageSkipped means an update is available but was not installed.
+	PackageSkipped PackageStatus = "SKIPPED"
+)
+
+// PackageResult describes what a patch run did to a single package.
+type PackageResult struct {
+	Name       string
+	Arch       string `json:",omitempty"`
+	OldVersion string `json:",omitempty"`
+	NewVersion string `json:",omitempty"`
+	Status     PackageStatus
+	// Reason explains a FAILED or SKIPPED status.
+	Reason string `json:",omitempty"`
+}
+
+// PatchResult describes what a patch run did to a single zypper patch.
+type PatchResult struct {
+	Name     string
+	Category string `json:",omitempty"`
+	Severity string `json:",omitempty"`
+	Status   PackageStatus
+	Reason   string `json:",omitempty"`
+}
+
+// Result is the result of a patch run of a single package manager.
+type Result struct {
+	PackageManager string
+	Packages       []PackageResult `json:",omitempty"`
+	Patches        []PatchResult   `json:",omitempty"`
+}
+
+// Count returns the number of packages and patches with status s.
+func (r *Result) Count(s PackageStatus) int {
+	var n int
+	for _, p := range r.Packages {
+		if p.Status == s {
+			n++
+		}
+	}
+	for _, p := range r.Patches {
+		if p.Status == s {
+			n++
+		}
+	}
+	return n
+}
+
+// String returns a one line summary of the result.
+func (r *Result) String() string {
+	return fmt.Sprintf("%s: %d updated, %d failed, %d skipped", r.PackageManager, r.Count(PackageUpdated), r.Count(PackageFailed), r.Count(PackageSkipped))
+}
+
+const (
+	reasonExcluded = "excluded by patch config"
+	reasonDryRun   = "dry run"
+)
+
+func pkgKey(name, arch string) string {
+	return name + "." + arch
+}
+
+// installedVersions returns the installed versions keyed by name.arch and by
+// name, it returns nil if the installed packages could not be listed.
+func installedVersions(installed func() ([]packages.PkgInfo, error)) map[string]string {
+	pkgs, err := installed()
+	if err != nil {
+		logger.Warningf("Error listing installed packages, patch results will be incomplete: %v", err)
+		return nil
+	}
+	versions := make(map[string]string, 2*len(pkgs))
+	for _, pkg := range pkgs {
+		versions[pkgKey(pkg.Name, pkg.Arch)] = pkg.Version
+		versions[pkg.Name] = pkg.Version
+	}
+	return versions
+}
+
+func lookupVersion(versions map[string]string, pkg packages.PkgInfo) (string, bool) {
+	if v, ok := versions[pkgKey(pkg.Name, pkg.Arch)]; ok {
+		return v, true
+	}
+	v, ok := versions[pkg.Name]
+	return v, ok
+}
+
+// stripEpoch removes the epoch from a version, yum lists updates with the
+// epoch while rpmquery lists installed packages without it.
+func stripEpoch(v string) string {
+	if i := strings.Index(v, ":"); i != -1 {
+		return v[i+1:]
+	}
+	return v
+}
+
+// packageResults returns the result of every available update and of every
+// installed held package. before and after are the installed versions before
+// and after the install ran, if after is nil the status of selected packages
+// is derived from installErr.
+func packageResults(available, selected []packages.PkgInfo, h holds, before, after map[string]string, dryrun bool, installErr error) []PackageResult {
+	isSelected := make(map[string]bool, len(selected))
+	for _, pkg := range selected {
+		isSelected[pkgKey(pkg.Name, pkg.Arch)] = true
+	}
+
+	var results []PackageResult
+	isAvailable := make(map[string]bool, len(available))
+	for _, pkg := range available {
+		isAvailable[pkg.Name] = true
+		r := PackageResult{Name: pkg.Name, Arch: pkg.Arch, NewVersion: pkg.Version}
+		r.OldVersion, _ = lookupVersion(before, pkg)
+		switch {
+		case !isSelected[pkgKey(pkg.Name, pkg.Arch)]:
+			r.Status, r.Reason = PackageSkipped, reasonExcluded
+			if reason, ok := h.reason(pkg.Name); ok {
+				r.Reason = reason
+			}
+		case dryrun:
+			r.Status, r.Reason = PackageSkipped, reasonDryRun
+		case after == nil && installErr == nil:
+			r.Status = PackageUpdated
+		case after == nil:
+			r.Status, r.Reason = PackageFailed, installErr.Error()
+		default:
+			v, ok := lookupVersion(after, pkg)
+			switch {
+			case ok && stripEpoch(v) == stripEpoch(pkg.Version):
+				r.Status = PackageUpdated
+			case !ok:
+				r.Status, r.Reason = PackageFailed, "package is not installed after update"
+			default:
+				r.Status, r.Reason = PackageFailed, fmt.Sprintf("installed version is %s after update", v)
+			}
+		}
+		results = append(results, r)
+	}
+
+	// Package managers may not list updates for held packages at all, list
+	// them so the report shows every held package.
+	for _, name := range h.held {
+		if isAvailable[name] || strings.ContainsAny(name, "*?[") {
+			continue
+		}
+		v, ok := before[name]
+		if before != nil && !ok {
+			continue
+		}
+		results = append(results, PackageResult{Name: name, OldVersion: v, Status: PackageSkipped, Reason: h.heldReason})
+	}
+	return results
+}
+
+// updatePackages installs the selected updates and returns the result for
+// every available update.
+func updatePackages(name string, available, selected []packages.PkgInfo, h holds, dryrun bool, installed func() ([]packages.PkgInfo, error), install func() error) (*Result, error) {
+	res := &Result{PackageManager: name}
+	var before map[string]string
+	if len(selected) > 0 || len(h.held) > 0 {
+		before = installedVersions(installed)
+	}
+	if len(selected) == 0 {
+		logger.Infof("No packages to update.")
+		res.Packages = packageResults(available, selected, h, before, nil, dryrun, nil)
+		return res, nil
+	}
+
+	logger.Infof("Updating %d packages.", len(selected))
+	logger.Debugf("Packages to be installed: %s", selected)
+
+	if dryrun {
+		logger.Infof("Running in dryrun mode, not updating packages.")
+		res.Packages = packageResults(available, selected, h, before, nil, dryrun, nil)
+		return res, nil
+	}
+
+	err := install()
+	res.Packages = packageResults(available, selected, h, before, installedVersions(installed), dryrun, err)
+	return res, err
+}
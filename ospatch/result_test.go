@@ -0,0 +1,139 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestPackageResults(t *testing.T) {
+	available := []packages.PkgInfo{
+		{Name: "foo", Arch: "x86_64", Version: "1:1.1-1"},
+		{Name: "bar", Arch: "noarch", Version: "2.0"},
+		{Name: "baz", Arch: "x86_64", Version: "3.0"},
+	}
+	selected := available[:2]
+	before := map[string]string{"foo.x86_64": "1.0-1", "foo": "1.0-1", "bar.noarch": "1.0", "bar": "1.0", "baz": "2.0"}
+	installErr := errors.New("install error")
+
+	tests := []struct {
+		name       string
+		after      map[string]string
+		dryrun     bool
+		installErr error
+		want       []PackageResult
+	}{
+		{
+			"Updated",
+			map[string]string{"foo.x86_64": "1.1-1", "bar": "2.0", "baz": "2.0"},
+			false,
+			nil,
+			[]PackageResult{
+				{Name: "foo", Arch: "x86_64", OldVersion: "1.0-1", NewVersion: "1:1.1-1", Status: PackageUpdated},
+				{Name: "bar", Arch: "noarch", OldVersion: "1.0", NewVersion: "2.0", Status: PackageUpdated},
+				{Name: "baz", Arch: "x86_64", OldVersion: "2.0", NewVersion: "3.0", Status: PackageSkipped, Reason: reasonExcluded},
+			},
+		},
+		{
+			"PartialFailure",
+			map[string]string{"foo.x86_64": "1.1-1", "bar": "1.0"},
+			false,
+			installErr,
+			[]PackageResult{
+				{Name: "foo", Arch: "x86_64", OldVersion: "1.0-1", NewVersion: "1:1.1-1", Status: PackageUpdated},
+				{Name: "bar", Arch: "noarch", OldVersion: "1.0", NewVersion: "2.0", Status: PackageFailed, Reason: "installed version is 1.0 after update"},
+				{Name: "baz", Arch: "x86_64", OldVersion: "2.0", NewVersion: "3.0", Status: PackageSkipped, Reason: reasonExcluded},
+			},
+		},
+		{
+			"UnknownAfter",
+			nil,
+			false,
+			installErr,
+			[]PackageResult{
+				{Name: "foo", Arch: "x86_64", OldVersion: "1.0-1", NewVersion: "1:1.1-1", Status: PackageFailed, Reason: "install error"},
+				{Name: "bar", Arch: "noarch", OldVersion: "1.0", NewVersion: "2.0", Status: PackageFailed, Reason: "install error"},
+				{Name: "baz", Arch: "x86_64", OldVersion: "2.0", NewVersion: "3.0", Status: PackageSkipped, Reason: reasonExcluded},
+			},
+		},
+		{
+			"DryRun",
+			nil,
+			true,
+			nil,
+			[]PackageResult{
+				{Name: "foo", Arch: "x86_64", OldVersion: "1.0-1", NewVersion: "1:1.1-1", Status: PackageSkipped, Reason: reasonDryRun},
+				{Name: "bar", Arch: "noarch", OldVersion: "1.0", NewVersion: "2.0", Status: PackageSkipped, Reason: reasonDryRun},
+				{Name: "baz", Arch: "x86_64", OldVersion: "2.0", NewVersion: "3.0", Status: PackageSkipped, Reason: reasonExcluded},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := packageResults(available, selected, holds{}, before, tt.after, tt.dryrun, tt.installErr)
+			if diff := pretty.Compare(got, tt.want); diff != "" {
+				t.Errorf("packageResults does not match expectation: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPatchResults(t *testing.T) {
+	available := []packages.ZypperPatch{{Name: "patch-1", Category: "security", Severity: "important"}, {Name: "patch-2"}}
+	got := patchResults(available, available[:1], nil, false, nil)
+	want := []PatchResult{
+		{Name: "patch-1", Category: "security", Severity: "important", Status: PackageUpdated},
+		{Name: "patch-2", Status: PackageSkipped, Reason: reasonExcluded},
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("patchResults does not match expectation: (-got +want)\n%s", diff)
+	}
+
+	res := &Result{PackageManager: "zypper", Patches: got}
+	if res.String() != "zypper: 1 updated, 0 failed, 1 skipped" {
+		t.Errorf("unexpected summary: %q", res)
+	}
+}
+
+func TestPackageResultsHolds(t *testing.T) {
+	available := []packages.PkgInfo{
+		{Name: "linux-image-amd64", Arch: "x86_64", Version: "4.9+80+deb9u7"},
+		{Name: "google-cloud-sdk", Arch: "all", Version: "246.0.0-0"},
+		{Name: "libc6", Arch: "x86_64", Version: "2.24-11+deb9u4"},
+	}
+	before := map[string]string{"linux-image-amd64": "4.9+80+deb9u6", "google-cloud-sdk": "245.0.0-0", "libc6": "2.24-11+deb9u3", "bash": "4.4-5"}
+	after := map[string]string{"linux-image-amd64": "4.9+80+deb9u6", "google-cloud-sdk": "245.0.0-0", "libc6": "2.24-11+deb9u4", "bash": "4.4-5"}
+	h := holds{held: []string{"linux-image-amd64", "bash", "removed", "python3-*"}, heldReason: "held", neverPatch: []string{"google-*"}}
+
+	selected := h.filter(available)
+	if len(selected) != 1 || selected[0].Name != "libc6" {
+		t.Fatalf("unexpected selected packages: %v", selected)
+	}
+
+	got := packageResults(available, selected, h, before, after, false, nil)
+	want := []PackageResult{
+		{Name: "linux-image-amd64", Arch: "x86_64", OldVersion: "4.9+80+deb9u6", NewVersion: "4.9+80+deb9u7", Status: PackageSkipped, Reason: "held"},
+		{Name: "google-cloud-sdk", Arch: "all", OldVersion: "245.0.0-0", NewVersion: "246.0.0-0", Status: PackageSkipped, Reason: reasonNeverPatch},
+		{Name: "libc6", Arch: "x86_64", OldVersion: "2.24-11+deb9u3", NewVersion: "2.24-11+deb9u4", Status: PackageUpdated},
+		{Name: "bash", OldVersion: "4.4-5", Status: PackageSkipped, Reason: "held"},
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("packageResults does not match expectation: (-got +want)\n%s", diff)
+	}
+}
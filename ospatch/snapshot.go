@@ -0,0 +1,292 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/inventory/osinfo"
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+// Snapshot is the installed package state before a patch run, it is used to
+// roll the patch run back.
+type Snapshot struct {
+	Time     time.Time
+	Packages packages.Packages
+	// HistoryID is the last yum or dnf history transaction before patching,
+	// nil if the history was not available.
+	HistoryID *int `json:",omitempty"`
+}
+
+// TakeSnapshot records the installed packages.
+func TakeSnapshot() (*Snapshot, error) {
+	pkgs, err := packages.GetInstalledPackages()
+	if err != nil {
+		// The error may only be about one package manager, keep what was
+		// listed.
+		if len(pkgs.Deb) == 0 && len(pkgs.Rpm) == 0 {
+			return nil, err
+		}
+		logger.Warningf("Error listing some installed packages for the snapshot: %v", err)
+	}
+	s := &Snapshot{Time: time.Now(), Packages: pkgs}
+
+	var historyIDs func() ([]int, error)
+	switch {
+	case packages.DnfExists:
+		historyIDs = packages.DnfHistoryIDs
+	case packages.YumExists:
+		historyIDs = packages.YumHistoryIDs
+	}
+	if historyIDs != nil {
+		ids, err := historyIDs()
+		if err != nil {
+			logger.Warningf("Error listing the package history, rollback will not be able to use it: %v", err)
+			return s, nil
+		}
+		var last int
+		for _, id := range ids {
+			if id > last {
+				last = id
+			}
+		}
+		s.HistoryID = &last
+	}
+	return s, nil
+}
+
+// Rollback restores the package versions recorded in s. Yum and dnf undo
+// the history transactions made since the snapshot, apt installs the recorded
+// versions. The result lists every package changed since the snapshot, the
+// ones that could not be restored are FAILED.
+func Rollback(s *Snapshot) (*Result, error) {
+	switch {
+	case packages.AptExists:
+		return rollbackApt(s)
+	case packages.DnfExists:
+		return rollbackHistory(s, "dnf", packages.DnfHistoryIDs, packages.DnfHistoryUndo)
+	case packages.YumExists:
+		return rollbackHistory(s, "yum", packages.YumHistoryIDs, packages.YumHistoryUndo)
+	default:
+		return nil, errors.New("rollback is only supported with apt, yum and dnf")
+	}
+}
+
+// aptRollbackSpecs returns the apt-get install specs that restore targets.
+// Packages of a foreign architecture are qualified with it, apt would
+// otherwise install the package of the native architecture.
+func aptRollbackSpecs(targets []PackageResult, native string) []string {
+	var specs []string
+	for _, t := range targets {
+		if t.NewVersion == "" {
+			continue
+		}
+		name := t.Name
+		if t.Arch != "" && t.Arch != "all" && t.Arch != osinfo.Architecture(native) {
+			name += ":" + debArch(t.Arch)
+		}
+		specs = append(specs, name+"="+t.NewVersion)
+	}
+	return specs
+}
+
+// debArch returns the dpkg name of an architecture normalized by
+// osinfo.Architecture.
+func debArch(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "x86_32":
+		return "i386"
+	default:
+		return arch
+	}
+}
+
+func rollbackApt(s *Snapshot) (*Result, error) {
+	current, err := packages.InstalledDebPackages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing installed deb packages: %v", err)
+	}
+	targets := rollbackTargets(s.Packages.Deb, current)
+	if len(targets) == 0 {
+		return &Result{PackageManager: "apt"}, nil
+	}
+
+	native, err := packages.DpkgArchitecture()
+	if err != nil {
+		logger.Warningf("Error getting the native dpkg architecture, qualifying every package with its architecture: %v", err)
+	}
+	specs := aptRollbackSpecs(targets, native)
+	if len(specs) > 0 {
+		if err := packages.DowngradeAptPackages(specs); err != nil {
+			// One unavailable version fails the whole install, restore the
+			// rest one at a time.
+			logger.Warningf("Error restoring packages, restoring them one at a time: %v", err)
+			for _, spec := range specs {
+				if err := packages.DowngradeAptPackages([]string{spec}); err != nil {
+					logger.Warningf("Error restoring %s: %v", spec, err)
+				}
+			}
+		}
+	}
+
+	after, err := packages.InstalledDebPackages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing installed deb packages: %v", err)
+	}
+	res := verifyRollback("apt", targets, after)
+	for i, p := range res.Packages {
+		if p.Status == PackageFailed && p.NewVersion == "" {
+			res.Packages[i].Reason = "installed since the snapshot, apt rollback does not remove packages"
+		}
+	}
+	return res, nil
+}
+
+func rollbackHistory(s *Snapshot, name string, historyIDs func() ([]int, error), undo func(int) error) (*Result, error) {
+	current, err := packages.InstalledRPMPackages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing installed rpm packages: %v", err)
+	}
+	targets := rollbackTargets(s.Packages.Rpm, current)
+	if len(targets) == 0 {
+		return &Result{PackageManager: name}, nil
+	}
+	if s.HistoryID == nil {
+		res := verifyRollback(name, targets, current)
+		for i := range res.Packages {
+			res.Packages[i].Reason = fmt.Sprintf("%s history was not available when the snapshot was taken", name)
+		}
+		return res, nil
+	}
+
+	ids, err := historyIDs()
+	if err != nil {
+		return nil, err
+	}
+	// Undo the newest transaction first.
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	for _, id := range ids {
+		if id <= *s.HistoryID {
+			continue
+		}
+		logger.Infof("Undoing %s history transaction %d.", name, id)
+		if err := undo(id); err != nil {
+			logger.Warningf("Error undoing %s history transaction %d: %v", name, id, err)
+		}
+	}
+
+	after, err := packages.InstalledRPMPackages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing installed rpm packages: %v", err)
+	}
+	return verifyRollback(name, targets, after), nil
+}
+
+// pkgVersions returns the installed versions and a package of each name.arch.
+func pkgVersions(pkgs []packages.PkgInfo) (map[string][]string, map[string]packages.PkgInfo) {
+	versions := make(map[string][]string)
+	infos := make(map[string]packages.PkgInfo)
+	for _, p := range pkgs {
+		k := pkgKey(p.Name, p.Arch)
+		versions[k] = append(versions[k], p.Version)
+		infos[k] = p
+	}
+	return versions, infos
+}
+
+func containsVersion(versions []string, v string) bool {
+	for _, ver := range versions {
+		if ver == v {
+			return true
+		}
+	}
+	return false
+}
+
+// rollbackTargets compares the packages in a snapshot to the current ones.
+// NewVersion is the version to restore, it is empty for versions installed
+// since the snapshot that should be removed. OldVersion is the current
+// version, it is empty for packages removed since the snapshot.
+func rollbackTargets(snapshot, current []packages.PkgInfo) []PackageResult {
+	before, beforeInfo := pkgVersions(snapshot)
+	now, nowInfo := pkgVersions(current)
+
+	var targets []PackageResult
+	for k, vers := range before {
+		for _, v := range vers {
+			if containsVersion(now[k], v) {
+				continue
+			}
+			t := PackageResult{Name: beforeInfo[k].Name, Arch: beforeInfo[k].Arch, NewVersion: v}
+			// A single changed version is an update, several versions
+			// of the same package are install only packages like kernels.
+			if len(vers) == 1 && len(now[k]) == 1 {
+				t.OldVersion = now[k][0]
+			}
+			targets = append(targets, t)
+		}
+	}
+	for k, vers := range now {
+		for _, v := range vers {
+			if containsVersion(before[k], v) {
+				continue
+			}
+			if len(vers) == 1 && len(before[k]) == 1 {
+				// Already recorded as an update.
+				continue
+			}
+			targets = append(targets, PackageResult{Name: nowInfo[k].Name, Arch: nowInfo[k].Arch, OldVersion: v})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Name != targets[j].Name {
+			return targets[i].Name < targets[j].Name
+		}
+		return targets[i].NewVersion < targets[j].NewVersion
+	})
+	return targets
+}
+
+// verifyRollback checks which targets were restored, restored targets are
+// UPDATED and the rest FAILED.
+func verifyRollback(name string, targets []PackageResult, after []packages.PkgInfo) *Result {
+	now, _ := pkgVersions(after)
+	res := &Result{PackageManager: name}
+	for _, t := range targets {
+		vers := now[pkgKey(t.Name, t.Arch)]
+		t.Status = PackageUpdated
+		switch {
+		case t.NewVersion != "" && !containsVersion(vers, t.NewVersion):
+			t.Status = PackageFailed
+			t.Reason = fmt.Sprintf("version %s was not restored", t.NewVersion)
+			if len(vers) > 0 {
+				t.Reason += ", installed: " + strings.Join(vers, ", ")
+			}
+		case t.NewVersion == "" && containsVersion(vers, t.OldVersion):
+			t.Status = PackageFailed
+			t.Reason = fmt.Sprintf("version %s was not removed", t.OldVersion)
+		}
+		res.Packages = append(res.Packages, t)
+	}
+	return res
+}
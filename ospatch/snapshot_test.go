@@ -0,0 +1,99 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+func TestRollbackTargets(t *testing.T) {
+	snapshot := []packages.PkgInfo{
+		{Name: "bash", Arch: "x86_64", Version: "4.4-1"},
+		{Name: "curl", Arch: "x86_64", Version: "7.64-1"},
+		{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1062.el7"},
+		{Name: "kernel", Arch: "x86_64", Version: "3.10.0-957.el7"},
+		{Name: "obsolete", Arch: "noarch", Version: "1.0-1"},
+	}
+	current := []packages.PkgInfo{
+		{Name: "bash", Arch: "x86_64", Version: "4.4-1"},
+		{Name: "curl", Arch: "x86_64", Version: "7.64-2"},
+		{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1062.el7"},
+		{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1127.el7"},
+		{Name: "new", Arch: "noarch", Version: "2.0-1"},
+	}
+	want := []PackageResult{
+		{Name: "curl", Arch: "x86_64", OldVersion: "7.64-2", NewVersion: "7.64-1"},
+		{Name: "kernel", Arch: "x86_64", OldVersion: "3.10.0-1127.el7"},
+		{Name: "kernel", Arch: "x86_64", NewVersion: "3.10.0-957.el7"},
+		{Name: "new", Arch: "noarch", OldVersion: "2.0-1"},
+		{Name: "obsolete", Arch: "noarch", NewVersion: "1.0-1"},
+	}
+	got := rollbackTargets(snapshot, current)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rollbackTargets() = %+v, want %+v", got, want)
+	}
+	if got := rollbackTargets(snapshot, snapshot); got != nil {
+		t.Errorf("rollbackTargets() = %+v, want nothing to roll back", got)
+	}
+}
+
+func TestAptRollbackSpecs(t *testing.T) {
+	targets := []PackageResult{
+		{Name: "curl", Arch: "x86_64", OldVersion: "7.64-2", NewVersion: "7.64-1"},
+		{Name: "libc6", Arch: "x86_32", OldVersion: "2.28-2", NewVersion: "2.28-1"},
+		{Name: "new", Arch: "x86_64", OldVersion: "2.0-1"},
+		{Name: "tzdata", Arch: "all", OldVersion: "2020b", NewVersion: "2020a"},
+	}
+	tests := []struct {
+		native string
+		want   []string
+	}{
+		{"amd64", []string{"curl=7.64-1", "libc6:i386=2.28-1", "tzdata=2020a"}},
+		{"i386", []string{"curl:amd64=7.64-1", "libc6=2.28-1", "tzdata=2020a"}},
+		{"", []string{"curl:amd64=7.64-1", "libc6:i386=2.28-1", "tzdata=2020a"}},
+	}
+	for _, tt := range tests {
+		if got := aptRollbackSpecs(targets, tt.native); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("aptRollbackSpecs(%q) = %q, want %q", tt.native, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyRollback(t *testing.T) {
+	targets := []PackageResult{
+		{Name: "curl", Arch: "x86_64", OldVersion: "7.64-2", NewVersion: "7.64-1"},
+		{Name: "kernel", Arch: "x86_64", OldVersion: "3.10.0-1127.el7"},
+		{Name: "new", Arch: "noarch", OldVersion: "2.0-1"},
+		{Name: "openssl", Arch: "x86_64", OldVersion: "1.1.1d-1", NewVersion: "1.1.1c-1"},
+	}
+	after := []packages.PkgInfo{
+		{Name: "curl", Arch: "x86_64", Version: "7.64-1"},
+		{Name: "kernel", Arch: "x86_64", Version: "3.10.0-1062.el7"},
+		{Name: "new", Arch: "noarch", Version: "2.0-1"},
+		{Name: "openssl", Arch: "x86_64", Version: "1.1.1d-1"},
+	}
+	want := &Result{PackageManager: "yum", Packages: []PackageResult{
+		{Name: "curl", Arch: "x86_64", OldVersion: "7.64-2", NewVersion: "7.64-1", Status: PackageUpdated},
+		{Name: "kernel", Arch: "x86_64", OldVersion: "3.10.0-1127.el7", Status: PackageUpdated},
+		{Name: "new", Arch: "noarch", OldVersion: "2.0-1", Status: PackageFailed, Reason: "version 2.0-1 was not removed"},
+		{Name: "openssl", Arch: "x86_64", OldVersion: "1.1.1d-1", NewVersion: "1.1.1c-1", Status: PackageFailed, Reason: "version 1.1.1c-1 was not restored, installed: 1.1.1d-1"},
+	}}
+	if got := verifyRollback("yum", targets, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("verifyRollback() = %+v, want %+v", got, want)
+	}
+}
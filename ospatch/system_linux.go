@@ -17,87 +17,149 @@
 package ospatch
 
 import (
-	"bytes"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/config"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
 const (
 	systemctl = "/bin/systemctl"
+
+	// aptAutoUpdatesFile sorts after 20auto-upgrades and 50unattended-upgrades
+	// so its setting wins.
+	aptAutoUpdatesFile     = "/etc/apt/apt.conf.d/99google-osconfig-disable-unattended-upgrades"
+	aptAutoUpdatesContents = `// Written by google-osconfig-agent while OS Config patch tasks are enabled,
+// removed when they are disabled.
+APT::Periodic::Unattended-Upgrade "0";
+`
 )
 
-// DisableAutoUpdates disables system auto updates.
+// disabledTimersFile lists the timers disabled by DisableAutoUpdates.
+var disabledTimersFile = config.DisabledAutoUpdateTimersFile()
+
+// autoUpdateOptions are the config options that make yum-cron and
+// dnf-automatic install updates.
+var autoUpdateOptions = []struct {
+	path, section, key, value string
+}{
+	// dnf-automatic.timer on el8 systems.
+	{"/etc/dnf/automatic.conf", "commands", "apply_updates", "no"},
+	// yum-cron on el7 systems.
+	{"/etc/yum/yum-cron.conf", "commands", "apply_updates", "no"},
+	{"/etc/yum/yum-cron-hourly.conf", "commands", "apply_updates", "no"},
+	// yum-cron on el6 systems.
+	{"/etc/sysconfig/yum-cron", "", "CHECK_ONLY", "yes"},
+}
+
+// autoUpdateTimers install updates regardless of config files so they are
+// disabled.
+var autoUpdateTimers = []string{
+	// Ignores apply_updates in /etc/dnf/automatic.conf.
+	"dnf-automatic-install.timer",
+	// SUSE transactional systems.
+	"transactional-update.timer",
+}
+
+// DisableAutoUpdates disables system auto updates by changing their config,
+// EnableAutoUpdates reverts the changes.
 func DisableAutoUpdates() {
-	// yum-cron on el systems
-	if _, err := os.Stat("/usr/lib/systemd/system/yum-cron.service"); err == nil {
-		out, err := exec.Command(systemctl, "is-enabled", "yum-cron.service").CombinedOutput()
-		if err != nil {
-			if eerr, ok := err.(*exec.ExitError); ok {
-				// Error code of 1 indicates disabled.
-				if eerr.ExitCode() == 1 {
-					return
-				}
+	if packages.AptExists {
+		if data, err := ioutil.ReadFile(aptAutoUpdatesFile); err != nil || string(data) != aptAutoUpdatesContents {
+			logger.Debugf("Disabling unattended-upgrades in %s", aptAutoUpdatesFile)
+			if err := ioutil.WriteFile(aptAutoUpdatesFile, []byte(aptAutoUpdatesContents), 0644); err != nil {
+				logger.Errorf("Error disabling unattended-upgrades: %v", err)
 			}
-			logger.Errorf("Error checking status of yum-cron, error: %v, out: %s", err, out)
 		}
+	}
 
-		logger.Debugf("Disabling yum-cron")
-		out, err = exec.Command(systemctl, "stop", "yum-cron.service").CombinedOutput()
-		if err != nil {
-			logger.Errorf("Error stopping yum-cron, error: %v, out: %s", err, out)
-		}
-		out, err = exec.Command(systemctl, "disable", "yum-cron.service").CombinedOutput()
-		if err != nil {
-			logger.Errorf("Error disabling yum-cron, error: %v, out: %s", err, out)
+	for _, o := range autoUpdateOptions {
+		editConfig(o.path, func(data []byte) ([]byte, bool) { return disableOption(data, o.section, o.key, o.value) })
+	}
+
+	var disabled []string
+	for _, timer := range autoUpdateTimers {
+		// is-enabled exits 0 only for enabled units.
+		if err := exec.Command(systemctl, "is-enabled", "--quiet", timer).Run(); err != nil {
+			continue
 		}
-	} else if _, err := os.Stat("/usr/sbin/yum-cron"); err == nil {
-		out, err := exec.Command("/sbin/chkconfig", "yum-cron").CombinedOutput()
+		logger.Debugf("Disabling %s", timer)
+		out, err := exec.Command(systemctl, "disable", "--now", timer).CombinedOutput()
 		if err != nil {
-			logger.Errorf("Error checking status of yum-cron, error: %v, out: %s", err, out)
+			logger.Errorf("Error disabling %s, error: %v, out: %s", timer, err, out)
+			continue
 		}
-		if bytes.Contains(out, []byte("disabled")) {
+		disabled = append(disabled, timer)
+	}
+	if len(disabled) > 0 {
+		if err := os.MkdirAll(filepath.Dir(disabledTimersFile), 0755); err != nil {
+			logger.Errorf("Error recording disabled timers %q, they will not be re-enabled: %v", disabled, err)
 			return
 		}
-
-		logger.Debugf("Disabling yum-cron")
-		out, err = exec.Command("/sbin/chkconfig", "yum-cron", "off").CombinedOutput()
+		f, err := os.OpenFile(disabledTimersFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			logger.Errorf("Error disabling yum-cron, error: %v, out: %s", err, out)
+			logger.Errorf("Error recording disabled timers %q, they will not be re-enabled: %v", disabled, err)
+			return
+		}
+		defer f.Close()
+		if _, err := f.WriteString(strings.Join(disabled, "\n") + "\n"); err != nil {
+			logger.Errorf("Error recording disabled timers %q, they will not be re-enabled: %v", disabled, err)
 		}
 	}
+}
 
-	// dnf-automatic on el8 systems
-	if _, err := os.Stat("/usr/lib/systemd/system/dnf-automatic.timer"); err == nil {
-		out, err := exec.Command(systemctl, "list-timers", "dnf-automatic.timer").CombinedOutput()
-		if err != nil {
-			logger.Errorf("Error checking status of dnf-automatic, error: %v, out: %s", err, out)
-		}
-		if bytes.Contains(out, []byte("0 timers listed")) {
-			return
+// EnableAutoUpdates reverts the changes made by DisableAutoUpdates, auto
+// updates disabled by anything else are left alone.
+func EnableAutoUpdates() {
+	if _, err := os.Stat(aptAutoUpdatesFile); err == nil {
+		logger.Debugf("Removing %s", aptAutoUpdatesFile)
+		if err := os.Remove(aptAutoUpdatesFile); err != nil {
+			logger.Errorf("Error re-enabling unattended-upgrades: %v", err)
 		}
+	}
 
-		logger.Debugf("Disabling dnf-automatic")
-		out, err = exec.Command(systemctl, "stop", "dnf-automatic.timer").CombinedOutput()
-		if err != nil {
-			logger.Errorf("Error stopping dnf-automatic, error: %v, out: %s", err, out)
-		}
-		out, err = exec.Command(systemctl, "disable", "dnf-automatic.timer").CombinedOutput()
-		if err != nil {
-			logger.Errorf("Error disabling dnf-automatic, error: %v, out: %s", err, out)
-		}
+	for _, o := range autoUpdateOptions {
+		editConfig(o.path, restoreOptions)
 	}
 
-	// apt unattended-upgrades
-	// TODO: Removing the package is a bit overkill, look into just managing
-	// the configs, this is probably best done by looking through
-	// /etc/apt/apt.conf.d/ and setting APT::Periodic::Unattended-Upgrade to 0.
-	if _, err := os.Stat("/usr/bin/unattended-upgrades"); err == nil {
-		logger.Debugf("Removing unattended-upgrades package")
-		if err := packages.RemoveAptPackages([]string{"unattended-upgrades"}); err != nil {
-			logger.Errorf(err.Error())
+	data, err := ioutil.ReadFile(disabledTimersFile)
+	if err != nil {
+		return
+	}
+	for _, timer := range strings.Fields(string(data)) {
+		logger.Debugf("Re-enabling %s", timer)
+		if out, err := exec.Command(systemctl, "enable", "--now", timer).CombinedOutput(); err != nil {
+			logger.Errorf("Error re-enabling %s, error: %v, out: %s", timer, err, out)
 		}
 	}
+	if err := os.Remove(disabledTimersFile); err != nil {
+		logger.Errorf("Error removing %s: %v", disabledTimersFile, err)
+	}
+}
+
+// editConfig rewrites the config file at path if it exists and edit changes
+// it.
+func editConfig(path string, edit func([]byte) ([]byte, bool)) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Errorf("Error reading %s: %v", path, err)
+		return
+	}
+	data, changed := edit(data)
+	if !changed {
+		return
+	}
+	logger.Debugf("Updating auto update settings in %s", path)
+	if err := ioutil.WriteFile(path, data, fi.Mode()); err != nil {
+		logger.Errorf("Error writing %s: %v", path, err)
+	}
 }
@@ -24,6 +24,10 @@ import (
 	"golang.org/x/sys/windows/registry"
 )
 
+// autoUpdatesMarkerValue is set next to NoAutoUpdate when DisableAutoUpdates
+// set it, so EnableAutoUpdates only reverts its own change.
+const autoUpdatesMarkerValue = "NoAutoUpdateSetByGoogleOSConfig"
+
 // DisableAutoUpdates disables system auto updates.
 func DisableAutoUpdates() {
 	k, openedExisting, err := registry.CreateKey(registry.LOCAL_MACHINE, `SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate\AU`, registry.ALL_ACCESS)
@@ -43,6 +47,9 @@ func DisableAutoUpdates() {
 	if err := k.SetDWordValue("NoAutoUpdate", 1); err != nil {
 		logger.Errorf("error disabling Windows auto updates, error: %v", err)
 	}
+	if err := k.SetDWordValue(autoUpdatesMarkerValue, 1); err != nil {
+		logger.Errorf("error recording Windows auto updates change, error: %v", err)
+	}
 
 	if _, err := os.Stat(`C:\Program Files\Google\Compute Engine\tools\auto_updater.ps1`); err == nil {
 		logger.Debugf("Removing google-compute-engine-auto-updater package")
@@ -51,3 +58,25 @@ func DisableAutoUpdates() {
 		}
 	}
 }
+
+// EnableAutoUpdates reverts the NoAutoUpdate policy set by
+// DisableAutoUpdates, the removed auto updater package is not reinstalled.
+func EnableAutoUpdates() {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate\AU`, registry.ALL_ACCESS)
+	if err != nil {
+		return
+	}
+	defer k.Close()
+
+	if _, _, err := k.GetIntegerValue(autoUpdatesMarkerValue); err != nil {
+		return
+	}
+	logger.Debugf("Re-enabling Windows Auto Updates")
+	if err := k.DeleteValue("NoAutoUpdate"); err != nil && err != registry.ErrNotExist {
+		logger.Errorf("error re-enabling Windows auto updates, error: %v", err)
+		return
+	}
+	if err := k.DeleteValue(autoUpdatesMarkerValue); err != nil {
+		logger.Errorf("error re-enabling Windows auto updates, error: %v", err)
+	}
+}
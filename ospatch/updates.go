@@ -15,109 +15,113 @@
 package ospatch
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
-	"fmt"
-	"os"
-	"os/exec"
-	"strconv"
+	"path"
+	"strings"
 
+	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
-const (
-	rpmquery = "/usr/bin/rpmquery"
-)
-
-func getBtime(stat string) (int, error) {
-	f, err := os.Open(stat)
-	if err != nil {
-		return 0, fmt.Errorf("error opening %s: %v", stat, err)
+// matchesAny reports whether name matches any of the glob patterns, see
+// path.Match for the pattern syntax. A malformed pattern only matches itself.
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if p == name {
+			return true
+		}
+		if ok, err := path.Match(p, name); err == nil && ok {
+			return true
+		}
 	}
-	defer f.Close()
+	return false
+}
 
-	var btime int
-	scnr := bufio.NewScanner(f)
-	for scnr.Scan() {
-		if bytes.HasPrefix(scnr.Bytes(), []byte("btime")) {
-			split := bytes.SplitN(scnr.Bytes(), []byte(" "), 2)
-			if len(split) != 2 {
-				return 0, fmt.Errorf("error parsing btime from %s: %q", stat, scnr.Text())
-			}
-			btime, err = strconv.Atoi(string(bytes.TrimSpace(split[1])))
-			if err != nil {
-				return 0, fmt.Errorf("error parsing btime: %v", err)
-			}
-			break
-		}
+func pkgNames(pkgs []packages.PkgInfo) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
 	}
-	if err := scnr.Err(); err != nil && btime == 0 {
-		return 0, fmt.Errorf("error scanning %s: %v", stat, err)
+	return names
+}
+
+// selectAdvisories returns the packages that fix any of the advisory or CVE
+// ids. advisories returns the names of the packages keyed by the upper case
+// ids they fix, it is only called if ids is not empty.
+func selectAdvisories(pkgs []packages.PkgInfo, ids []string, advisories func() (map[string][]string, error)) ([]packages.PkgInfo, error) {
+	if len(ids) == 0 {
+		return pkgs, nil
 	}
-	if btime == 0 {
-		return 0, fmt.Errorf("could not find btime in %s", stat)
+	adv, err := advisories()
+	if err != nil {
+		return nil, err
 	}
 
-	return btime, nil
-}
-
-func rpmRebootRequired(pkgs []byte, btime int) bool {
-	// Scanning this output is best effort, false negatives are much prefered
-	// to false positives, and keeping this as simple as possible is
-	// beneficial.
-	scnr := bufio.NewScanner(bytes.NewReader(pkgs))
-	for scnr.Scan() {
-		itime, err := strconv.Atoi(scnr.Text())
-		if err != nil {
+	fixes := make(map[string]bool)
+	for _, id := range ids {
+		names, ok := adv[strings.ToUpper(id)]
+		if !ok {
+			logger.Infof("No available update fixes %s.", id)
 			continue
 		}
-		if itime > btime {
-			return true
+		for _, name := range names {
+			fixes[name] = true
 		}
 	}
 
-	return false
+	var fPkgs []packages.PkgInfo
+	for _, pkg := range pkgs {
+		if fixes[pkg.Name] {
+			fPkgs = append(fPkgs, pkg)
+		}
+	}
+	return fPkgs, nil
+}
+
+const reasonNeverPatch = "listed in the agent never patch config"
+
+// holds are packages that are never updated, either because they are held or
+// locked in the package manager or because they match the agent never patch
+// config.
+type holds struct {
+	// held are the names or patterns held by the package manager.
+	held       []string
+	heldReason string
+	neverPatch []string
 }
 
-// rpmReboot returns whether an rpm based system should reboot in order to
-// finish installing updates.
-// To get this signal we look at a set of well known packages and whether
-// install time > system boot time. This list is not meant to be exhastive,
-// just to provide a signal when core system packages are updated.
-func rpmReboot() (bool, error) {
-	provides := []string{
-		// Common packages.
-		"kernel", "glibc", "gnutls",
-		// EL packages.
-		"linux-firmware", "openssl-libs", "dbus",
-		// Suse packages.
-		"kernel-firmware", "libopenssl1_1", "libopenssl1_0_0", "dbus-1",
+// reason returns why name is held, if it is.
+func (h holds) reason(name string) (string, bool) {
+	if matchesAny(h.held, name) {
+		return h.heldReason, true
 	}
-	args := append([]string{"--queryformat", "%{INSTALLTIME}\n", "--whatprovides"}, provides...)
-	out, err := exec.Command(rpmquery, args...).Output()
-	if err != nil {
-		// We don't care about return codes as we know some of these packages won't be installed.
-		if _, ok := err.(*exec.ExitError); !ok {
-			return false, fmt.Errorf("error running %s: %v", rpmquery, err)
-		}
+	if matchesAny(h.neverPatch, name) {
+		return reasonNeverPatch, true
 	}
+	return "", false
+}
 
-	btime, err := getBtime("/proc/stat")
-	if err != nil {
-		return false, err
+// filter removes the held packages from pkgs.
+func (h holds) filter(pkgs []packages.PkgInfo) []packages.PkgInfo {
+	var fPkgs []packages.PkgInfo
+	for _, pkg := range pkgs {
+		if reason, ok := h.reason(pkg.Name); ok {
+			logger.Debugf("Not updating package %s, %s.", pkg.Name, reason)
+			continue
+		}
+		fPkgs = append(fPkgs, pkg)
 	}
-
-	return rpmRebootRequired(out, btime), nil
+	return fPkgs
 }
 
-func containsString(ss []string, c string) bool {
-	for _, s := range ss {
-		if s == c {
-			return true
-		}
+// listHolds returns the holds from list and neverPatch, an error listing the
+// holds is logged as the package manager still enforces its own holds.
+func listHolds(list func() ([]string, error), heldReason string, neverPatch []string) holds {
+	held, err := list()
+	if err != nil {
+		logger.Warningf("Error listing held packages: %v", err)
 	}
-	return false
+	return holds{held: held, heldReason: heldReason, neverPatch: neverPatch}
 }
 
 func filterPackages(pkgs []packages.PkgInfo, exclusivePackages, excludes []string) ([]packages.PkgInfo, error) {
@@ -126,10 +130,10 @@ func filterPackages(pkgs []packages.PkgInfo, exclusivePackages, excludes []strin
 	}
 	var fPkgs []packages.PkgInfo
 	for _, pkg := range pkgs {
-		if containsString(excludes, pkg.Name) {
+		if matchesAny(excludes, pkg.Name) {
 			continue
 		}
-		if exclusivePackages == nil || containsString(exclusivePackages, pkg.Name) {
+		if len(exclusivePackages) == 0 || matchesAny(exclusivePackages, pkg.Name) {
 			fPkgs = append(fPkgs, pkg)
 		}
 	}
@@ -17,36 +17,132 @@
 package ospatch
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 	"github.com/GoogleCloudPlatform/osconfig/util"
+	"golang.org/x/sys/unix"
 )
 
-// SystemRebootRequired checks whether a system reboot is required.
-func SystemRebootRequired() (bool, error) {
+// SystemRebootRequired checks whether a system reboot is required, the
+// returned reason describes why.
+func SystemRebootRequired() (bool, string, error) {
 	if packages.AptExists {
 		logger.Debugf("Checking if reboot required by looking at /var/run/reboot-required.")
 		data, err := ioutil.ReadFile("/var/run/reboot-required")
 		if os.IsNotExist(err) {
 			logger.Debugf("/var/run/reboot-required does not exist, indicating no reboot is required.")
-			return false, nil
+			return false, "", nil
 		}
 		if err != nil {
-			return false, err
+			return false, "", err
 		}
 		logger.Debugf("/var/run/reboot-required exists indicating a reboot is required, content:\n%s", string(data))
-		return true, nil
+		reason := "/var/run/reboot-required exists"
+		if pkgs, err := ioutil.ReadFile("/var/run/reboot-required.pkgs"); err == nil && len(bytes.TrimSpace(pkgs)) > 0 {
+			reason = fmt.Sprintf("%s, requested by: %s", reason, listItems(strings.Fields(string(pkgs))))
+		}
+		return true, reason, nil
 	}
 	if ok := util.Exists(rpmquery); ok {
-		logger.Debugf("Checking if reboot required by querying rpm database.")
+		logger.Debugf("Checking if reboot required on an rpm system.")
 		return rpmReboot()
 	}
 
-	return false, errors.New("no recognized package manager installed, can't determine if reboot is required")
+	return false, "", errors.New("no recognized package manager installed, can't determine if reboot is required")
+}
+
+func rpmReboot() (bool, string, error) {
+	var cmd *exec.Cmd
+	switch {
+	case packages.DnfExists:
+		cmd = exec.Command("/usr/bin/dnf", "needs-restarting", "-r")
+	case util.Exists(needsRestarting):
+		cmd = exec.Command(needsRestarting, "-r")
+	}
+	if cmd != nil {
+		// needs-restarting -r exits 1 when a reboot is required.
+		out, err := cmd.CombinedOutput()
+		if required, reason, ok := parseNeedsRestarting(out); ok {
+			logger.Debugf("%s -r: reboot required: %t", cmd.Path, required)
+			return required, reason, nil
+		}
+		logger.Debugf("%s -r is not supported, falling back to kernel and library checks: %v, output: %s", cmd.Path, err, out)
+	}
+
+	required, reason, err := kernelReboot()
+	if err != nil || required {
+		return required, reason, err
+	}
+
+	logger.Debugf("Checking for processes using deleted libraries.")
+	if reason := deletedFilesReason(deletedFiles("/proc")); reason != "" {
+		return true, reason, nil
+	}
+	return false, "", nil
+}
+
+// kernelReboot compares the running kernel to the most recently installed
+// kernel package.
+func kernelReboot() (bool, string, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return false, "", fmt.Errorf("unix.Uname error: %v", err)
+	}
+	running := string(bytes.TrimRight(uts.Release[:], "\x00"))
+
+	required, reason := checkKernel(running, func(args ...string) ([]byte, error) {
+		return exec.Command(rpmquery, args...).Output()
+	})
+	return required, reason, nil
+}
+
+// ServicesToRestart returns the systemd units using files replaced by
+// patching, and whether a reboot is needed anyway because the kernel or init
+// changed.
+func ServicesToRestart() (*ServiceRestarts, error) {
+	if !util.Exists(systemctl) {
+		return nil, errors.New("systemd is not available, can't restart services")
+	}
+
+	var reason string
+	if packages.AptExists {
+		if data, err := ioutil.ReadFile("/var/run/reboot-required.pkgs"); err == nil {
+			if kernels := kernelPackages(strings.Fields(string(data))); len(kernels) > 0 {
+				reason = fmt.Sprintf("kernel packages updated: %s", listItems(kernels))
+			}
+		}
+	} else if util.Exists(rpmquery) {
+		required, r, err := kernelReboot()
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			reason = r
+		}
+	}
+
+	s := planRestarts("/proc", deletedFiles("/proc"), os.Getpid())
+	if reason != "" {
+		s.RebootReason = reason
+	}
+	return s, nil
+}
+
+// RestartService restarts a systemd unit if it is running.
+func RestartService(unit string) error {
+	out, err := exec.Command(systemctl, "try-restart", unit).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error restarting %s: %v, output: %s", unit, err, out)
+	}
+	return nil
 }
 
 // InstallWUAUpdates is the linux stub for InstallWUAUpdates.
@@ -15,71 +15,74 @@
 package ospatch
 
 import (
-	"io/ioutil"
-	"os"
+	"reflect"
 	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
-func TestGetBtime(t *testing.T) {
+func TestFilterPackages(t *testing.T) {
+	pkgs := []packages.PkgInfo{{Name: "linux-image-4.9.0-9-amd64"}, {Name: "linux-image-amd64"}, {Name: "google-cloud-sdk"}, {Name: "libc6"}}
+
 	tests := []struct {
-		name    string
-		in      string
-		want    int
-		wantErr bool
+		name      string
+		exclusive []string
+		excludes  []string
+		want      []string
+		wantErr   bool
 	}{
-		{"NormalCase", "procs_running 2\nprocs_blocked 0\nctxt 22762852599\nbtime 1561478350\nprocesses 15504510", 1561478350, false},
-		{"NoBtime", "procs_running 2\nprocs_blocked 0\nctxt 22762852599\nprocesses 15504510", 0, true},
-		{"CantParseInt", "procs_running 2\nprocs_blocked 0\nctxt 22762852599\nbtime notanint\nprocesses 15504510", 0, true},
-		{"CantParseLine", "procs_running 2\nprocs_blocked 0\nctxt 22762852599\nbtime1561478350\nprocesses 15504510", 0, true},
+		{"NoFilter", nil, nil, []string{"linux-image-4.9.0-9-amd64", "linux-image-amd64", "google-cloud-sdk", "libc6"}, false},
+		{"ExcludeGlob", nil, []string{"linux-image-*"}, []string{"google-cloud-sdk", "libc6"}, false},
+		{"ExcludeExact", nil, []string{"libc6"}, []string{"linux-image-4.9.0-9-amd64", "linux-image-amd64", "google-cloud-sdk"}, false},
+		{"ExclusiveGlob", []string{"google-*", "lib?6"}, nil, []string{"google-cloud-sdk", "libc6"}, false},
+		{"EmptyExclusive", []string{}, nil, []string{"linux-image-4.9.0-9-amd64", "linux-image-amd64", "google-cloud-sdk", "libc6"}, false},
+		{"BadPatternMatchesItself", nil, []string{"[libc6", "libc6"}, []string{"linux-image-4.9.0-9-amd64", "linux-image-amd64", "google-cloud-sdk"}, false},
+		{"Both", []string{"libc6"}, []string{"libc6"}, nil, true},
 	}
 	for _, tt := range tests {
-		td, err := ioutil.TempDir(os.TempDir(), "")
-		if err != nil {
-			t.Fatalf("error creating temp dir: %v", err)
-		}
-		defer os.RemoveAll(td)
 		t.Run(tt.name, func(t *testing.T) {
-			f, err := ioutil.TempFile(td, "")
-			if err != nil {
-				t.Fatalf("error creating temp file: %v", err)
-			}
-			if _, err := f.Write([]byte(tt.in)); err != nil {
-				t.Fatalf("error writing temp file: %v", err)
-			}
-			if err := f.Close(); err != nil {
-				t.Fatalf("error writing temp file: %v", err)
-			}
-
-			got, err := getBtime(f.Name())
+			got, err := filterPackages(pkgs, tt.exclusive, tt.excludes)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("getBtime() error = %v, wantErr %v", err, tt.wantErr)
-				return
+				t.Fatalf("filterPackages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, pkg := range got {
+				names = append(names, pkg.Name)
 			}
-			if got != tt.want {
-				t.Errorf("getBtime() = %v, want %v", got, tt.want)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("filterPackages() = %q, want %q", names, tt.want)
 			}
 		})
 	}
 }
 
-func TestRpmRebootRequired(t *testing.T) {
-	type args struct {
-		pkgs  []byte
-		btime int
+func TestSelectAdvisories(t *testing.T) {
+	pkgs := []packages.PkgInfo{{Name: "kernel"}, {Name: "systemd"}, {Name: "bash"}}
+	advisories := func() (map[string][]string, error) {
+		return map[string][]string{
+			"RHSA-2019:2091": {"systemd", "systemd-libs"},
+			"CVE-2019-1234":  {"kernel"},
+		}, nil
 	}
+
 	tests := []struct {
 		name string
-		args args
-		want bool
+		ids  []string
+		want []packages.PkgInfo
 	}{
-		{"RebootRequired", args{[]byte("1\n3\n2\n6"), 5}, true},
-		{"NoRebootRequired", args{[]byte("1\n3\n2\n5"), 5}, false},
+		{"NoAdvisories", nil, pkgs},
+		{"Advisory", []string{"RHSA-2019:2091"}, []packages.PkgInfo{{Name: "systemd"}}},
+		{"LowerCaseCVE", []string{"cve-2019-1234", "RHSA-2019:2091"}, []packages.PkgInfo{{Name: "kernel"}, {Name: "systemd"}}},
+		{"NotApplicable", []string{"RHSA-2020:0001"}, nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := rpmRebootRequired(tt.args.pkgs, tt.args.btime)
-			if got != tt.want {
-				t.Errorf("rpmRebootRequired() = %v, want %v", got, tt.want)
+			got, err := selectAdvisories(pkgs, tt.ids, advisories)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectAdvisories() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -20,8 +20,8 @@ import (
 	"context"
 )
 
-func systemRebootRequired() (bool, error) {
-	return false, nil
+func systemRebootRequired() (bool, string, error) {
+	return false, "", nil
 }
 
 func runUpdates(ctx context.Context, r *patchRun) error {
@@ -17,6 +17,7 @@
 package ospatch
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
@@ -26,8 +27,9 @@ import (
 	"golang.org/x/sys/windows/registry"
 )
 
-// SystemRebootRequired checks whether a system reboot is required.
-func SystemRebootRequired() (bool, error) {
+// SystemRebootRequired checks whether a system reboot is required, the
+// returned reason describes why.
+func SystemRebootRequired() (bool, string, error) {
 	// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-movefileexw#remarks
 	logger.Debugf("Checking for PendingFileRenameOperations")
 	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager`, registry.QUERY_VALUE)
@@ -38,13 +40,13 @@ func SystemRebootRequired() (bool, error) {
 
 			if len(val) > 0 {
 				logger.Debugf("PendingFileRenameOperations indicate a reboot is required: %q", val)
-				return true, nil
+				return true, "PendingFileRenameOperations is set", nil
 			}
 		} else if err != registry.ErrNotExist {
-			return false, err
+			return false, "", err
 		}
 	} else if err != registry.ErrNotExist {
-		return false, err
+		return false, "", err
 	}
 
 	regKeys := []string{
@@ -57,13 +59,23 @@ func SystemRebootRequired() (bool, error) {
 		if err == nil {
 			k.Close()
 			logger.Debugf("%s exists indicating a reboot is required.", key)
-			return true, nil
+			return true, key + " exists", nil
 		} else if err != registry.ErrNotExist {
-			return false, err
+			return false, "", err
 		}
 	}
 
-	return false, nil
+	return false, "", nil
+}
+
+// ServicesToRestart is not supported on Windows.
+func ServicesToRestart() (*ServiceRestarts, error) {
+	return nil, errors.New("restarting services instead of rebooting is not supported on Windows")
+}
+
+// RestartService is the Windows stub for RestartService.
+func RestartService(unit string) error {
+	return nil
 }
 
 func getIterativeProp(src *packages.IUpdate, prop string) (*ole.IDispatch, int32, error) {
@@ -99,13 +111,11 @@ func checkFilters(updt *packages.IUpdate, kbExcludes, classFilter, exclusive_pat
 			if err != nil {
 				return false, err
 			}
-			for _, e := range exclusive_patches {
-				if e == kbRaw.ToString() {
-					// until now we have only seen at most 1 kbarticles
-					// in a patch update. So, if we get a match, we just
-					// install the update
-					return true, nil
-				}
+			if matchesAny(exclusive_patches, kbRaw.ToString()) {
+				// until now we have only seen at most 1 kbarticles
+				// in a patch update. So, if we get a match, we just
+				// install the update
+				return true, nil
 			}
 		}
 		// since there are exclusive_patches to be installed,
@@ -119,11 +129,9 @@ func checkFilters(updt *packages.IUpdate, kbExcludes, classFilter, exclusive_pat
 			if err != nil {
 				return false, err
 			}
-			for _, e := range kbExcludes {
-				if e == kbRaw.ToString() {
-					logger.Debugf("Update %s (%s) matched exclude filter", title.ToString(), kbRaw.ToString())
-					return false, nil
-				}
+			if matchesAny(kbExcludes, kbRaw.ToString()) {
+				logger.Debugf("Update %s (%s) matched exclude filter", title.ToString(), kbRaw.ToString())
+				return false, nil
 			}
 		}
 	}
@@ -0,0 +1,288 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWindowLength is the longest a single window may stay open, longer
+// windows are better expressed as several windows.
+const maxWindowLength = 7 * 24 * time.Hour
+
+// windowSearchLimit is how far ahead Next looks for the window to open.
+const windowSearchLimit = 366 * 24 * time.Hour
+
+var weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// window opens at every minute matching a cron schedule and stays open for
+// length.
+type window struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+	length                        time.Duration
+}
+
+// Windows is a set of recurring maintenance windows in a time zone.
+type Windows struct {
+	windows []window
+	loc     *time.Location
+}
+
+// ParseWindows parses a semicolon separated list of maintenance windows,
+// evaluated in the IANA time zone tz, UTC if empty. It returns nil if spec
+// is empty. A window is either a weekly range or a cron schedule with a
+// length:
+//
+//	Sat 22:00-Sun 04:00   from Saturday 22:00 to Sunday 04:00
+//	Mon-Fri 01:00-03:00   from 01:00 to 03:00 on weekdays
+//	* 23:00-01:00         from 23:00 to 01:00 the next day, every day
+//	0 2 1 * * 4h          from 02:00 to 06:00 on the first of the month
+func ParseWindows(spec, tz string) (*Windows, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", tz, err)
+	}
+
+	ws := &Windows{loc: loc}
+	for _, s := range strings.Split(spec, ";") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		w, err := parseWindow(strings.Fields(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %v", strings.TrimSpace(s), err)
+		}
+		ws.windows = append(ws.windows, w)
+	}
+	return ws, nil
+}
+
+func parseWindow(fields []string) (window, error) {
+	switch len(fields) {
+	case 2:
+		// Mon-Fri 01:00-03:00
+		times := strings.Split(fields[1], "-")
+		if len(times) != 2 {
+			return window{}, fmt.Errorf("%q is not a HH:MM-HH:MM range", fields[1])
+		}
+		start, err := parseClock(times[0])
+		if err != nil {
+			return window{}, err
+		}
+		end, err := parseClock(times[1])
+		if err != nil {
+			return window{}, err
+		}
+		length := end - start
+		if length <= 0 {
+			length += 24 * time.Hour
+		}
+		return cronWindow(start, fields[0], length)
+	case 3:
+		// Sat 22:00-Sun 04:00
+		mid := strings.Split(fields[1], "-")
+		if len(mid) != 2 {
+			return window{}, fmt.Errorf("%q is not a DAY HH:MM-DAY HH:MM range", strings.Join(fields, " "))
+		}
+		startDay, ok := weekdays[strings.ToLower(fields[0])]
+		if !ok {
+			return window{}, fmt.Errorf("unknown day %q", fields[0])
+		}
+		endDay, ok := weekdays[strings.ToLower(mid[1])]
+		if !ok {
+			return window{}, fmt.Errorf("unknown day %q", mid[1])
+		}
+		start, err := parseClock(mid[0])
+		if err != nil {
+			return window{}, err
+		}
+		end, err := parseClock(fields[2])
+		if err != nil {
+			return window{}, err
+		}
+		length := time.Duration(endDay-startDay)*24*time.Hour + end - start
+		if length <= 0 {
+			length += 7 * 24 * time.Hour
+		}
+		return cronWindow(start, fields[0], length)
+	case 6:
+		// 0 2 1 * * 4h
+		length, err := time.ParseDuration(fields[5])
+		if err != nil {
+			return window{}, err
+		}
+		return newWindow(fields[:5], length)
+	default:
+		return window{}, fmt.Errorf("expected a weekly range or a cron schedule followed by a length")
+	}
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func cronWindow(start time.Duration, days string, length time.Duration) (window, error) {
+	minute := strconv.Itoa(int(start/time.Minute) % 60)
+	hour := strconv.Itoa(int(start / time.Hour))
+	return newWindow([]string{minute, hour, "*", "*", days}, length)
+}
+
+func newWindow(cron []string, length time.Duration) (window, error) {
+	if length <= 0 || length > maxWindowLength {
+		return window{}, fmt.Errorf("window length %s is not between 1m and %s", length, maxWindowLength)
+	}
+	w := window{length: length}
+	var err error
+	if w.minute, err = parseCronField(cron[0], 0, 59, nil); err != nil {
+		return window{}, fmt.Errorf("minute: %v", err)
+	}
+	if w.hour, err = parseCronField(cron[1], 0, 23, nil); err != nil {
+		return window{}, fmt.Errorf("hour: %v", err)
+	}
+	if w.dom, err = parseCronField(cron[2], 1, 31, nil); err != nil {
+		return window{}, fmt.Errorf("day of month: %v", err)
+	}
+	if w.month, err = parseCronField(cron[3], 1, 12, nil); err != nil {
+		return window{}, fmt.Errorf("month: %v", err)
+	}
+	// 7 is Sunday as well as 0.
+	if w.dow, err = parseCronField(cron[4], 0, 7, weekdays); err != nil {
+		return window{}, fmt.Errorf("day of week: %v", err)
+	}
+	w.dow[0] = w.dow[0] || w.dow[7]
+	w.domAny = cron[2] == "*"
+	w.dowAny = cron[4] == "*"
+	return w, nil
+}
+
+// parseCronField parses a cron field of comma separated values, a-b ranges
+// and */n or a-b/n steps.
+func parseCronField(s string, min, max int, names map[string]int) ([]bool, error) {
+	parse := func(v string) (int, error) {
+		if n, ok := names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not between %d and %d", v, min, max)
+		}
+		return n, nil
+	}
+
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = parse(bounds[0]); err != nil {
+				return nil, err
+			}
+			hi = lo
+			switch {
+			case len(bounds) == 2:
+				if hi, err = parse(bounds[1]); err != nil {
+					return nil, err
+				}
+			case step > 1:
+				// Like cron, a/n means from a to the maximum.
+				hi = max
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		for i := lo; i <= hi; i += step {
+			set[i] = true
+		}
+	}
+	return set, nil
+}
+
+// opensAt reports whether the window opens at t, in the window time zone.
+func (w window) opensAt(t time.Time) bool {
+	if !w.minute[t.Minute()] || !w.hour[t.Hour()] || !w.month[int(t.Month())] {
+		return false
+	}
+	dom, dow := w.dom[t.Day()], w.dow[int(t.Weekday())]
+	// Like cron, if both days are restricted either one matching is enough.
+	switch {
+	case w.domAny:
+		return dow
+	case w.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// End returns when the window open at t closes, the zero time if no window
+// is open at t.
+func (ws *Windows) End(t time.Time) time.Time {
+	t = t.In(ws.loc)
+	now := t.Truncate(time.Minute)
+	var end time.Time
+	for _, w := range ws.windows {
+		for s := now; s.After(t.Add(-w.length)); s = s.Add(-time.Minute) {
+			if w.opensAt(s.In(ws.loc)) && s.Add(w.length).After(end) {
+				end = s.Add(w.length)
+			}
+		}
+	}
+	return end
+}
+
+// Contains reports whether a window is open at t.
+func (ws *Windows) Contains(t time.Time) bool {
+	return !ws.End(t).IsZero()
+}
+
+// Next returns the first time at or after t a window is open, it returns
+// false if no window opens within a year.
+func (ws *Windows) Next(t time.Time) (time.Time, bool) {
+	if ws.Contains(t) {
+		return t, true
+	}
+	t = t.In(ws.loc)
+	for s := t.Truncate(time.Minute).Add(time.Minute); s.Before(t.Add(windowSearchLimit)); s = s.Add(time.Minute) {
+		s = s.In(ws.loc)
+		for _, w := range ws.windows {
+			if w.opensAt(s) {
+				return s, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
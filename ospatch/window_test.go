@@ -0,0 +1,99 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		tz      string
+		wantNil bool
+		wantErr bool
+	}{
+		{"Empty", " ", "", true, false},
+		{"Weekly", "Sat 22:00-Sun 04:00; Mon-Fri 01:00-03:00", "", false, false},
+		{"Cron", "0 2 1 * * 4h", "America/New_York", false, false},
+		{"BadTimezone", "* 01:00-02:00", "Nowhere/Nothing", false, true},
+		{"BadDay", "Someday 01:00-02:00", "", false, true},
+		{"BadTime", "Mon 25:00-26:00", "", false, true},
+		{"BadCronField", "0 24 * * * 1h", "", false, true},
+		{"TooLong", "0 2 * * * 200h", "", false, true},
+		{"Garbage", "whenever", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWindows(tt.spec, tt.tz)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWindows() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("ParseWindows() = %v, wantNil %t", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestWindows(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	// 2020-03-07 is a Saturday.
+	sat := func(hour, min int) time.Time { return time.Date(2020, 3, 7, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		spec     string
+		tz       string
+		t        time.Time
+		wantOpen bool
+		wantEnd  time.Time
+		wantNext time.Time
+	}{
+		{"WeeklyOpen", "Sat 22:00-Sun 04:00", "", sat(23, 30), true, sat(28, 0), sat(23, 30)},
+		{"WeeklyBefore", "Sat 22:00-Sun 04:00", "", sat(21, 59), false, time.Time{}, sat(22, 0)},
+		{"WeeklyAfterMidnight", "Sat 22:00-Sun 04:00", "", sat(27, 59), true, sat(28, 0), sat(27, 59)},
+		{"WeeklyClosed", "Sat 22:00-Sun 04:00", "", sat(28, 0), false, time.Time{}, sat(22+7*24, 0)},
+		{"Weekdays", "Mon-Fri 01:00-03:00", "", sat(12, 0), false, time.Time{}, sat(2*24+1, 0)},
+		{"Daily", "* 23:00-01:00", "", sat(0, 30), true, sat(1, 0), sat(0, 30)},
+		{"Cron", "*/15 * * * * 5m", "", sat(12, 7), false, time.Time{}, sat(12, 15)},
+		{"Monthly", "0 2 1 * * 4h", "", sat(12, 0), false, time.Time{}, time.Date(2020, 4, 1, 2, 0, 0, 0, time.UTC)},
+		{"TimeZone", "Sat 22:00-Sun 04:00", "America/New_York", sat(23, 30), false, time.Time{}, time.Date(2020, 3, 7, 22, 0, 0, 0, ny)},
+		{"Multiple", "Sun 01:00-02:00; Sat 12:00-13:00", "", sat(12, 30), true, sat(13, 0), sat(12, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, err := ParseWindows(tt.spec, tt.tz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ws.Contains(tt.t); got != tt.wantOpen {
+				t.Errorf("Contains(%s) = %t, want %t", tt.t, got, tt.wantOpen)
+			}
+			if got := ws.End(tt.t); !got.Equal(tt.wantEnd) {
+				t.Errorf("End(%s) = %s, want %s", tt.t, got, tt.wantEnd)
+			}
+			got, ok := ws.Next(tt.t)
+			if !ok || !got.Equal(tt.wantNext) {
+				t.Errorf("Next(%s) = %s, %t, want %s", tt.t, got, ok, tt.wantNext)
+			}
+		})
+	}
+}
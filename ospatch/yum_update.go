@@ -15,7 +15,6 @@
 package ospatch
 
 import (
-	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
@@ -24,6 +23,11 @@ const yum = "/usr/bin/yum"
 var (
 	yumUpdateArgs        = []string{"update", "-y"}
 	yumUpdateMinimalArgs = []string{"update-minimal", "-y"}
+
+	yumUpdates               = packages.YumUpdates
+	yumVersionlockedPackages = packages.YumVersionlockedPackages
+	installedRPMPackages     = packages.InstalledRPMPackages
+	installYumPackages       = packages.InstallYumPackages
 )
 
 type yumUpdateOpts struct {
@@ -31,6 +35,8 @@ type yumUpdateOpts struct {
 	minimal           bool
 	exclusivePackages []string
 	excludes          []string
+	neverPatch        []string
+	advisories        []string
 	dryrun            bool
 }
 
@@ -68,6 +74,21 @@ func YumExclusivePackages(exclusivePackages []string) YumUpdateOption {
 	}
 }
 
+// YumUpdateNeverPatch never updates these packages, they are reported as
+// skipped like packages locked with yum versionlock.
+func YumUpdateNeverPatch(neverPatch []string) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.neverPatch = neverPatch
+	}
+}
+
+// YumUpdateAdvisories only installs updates that fix these advisories or CVEs.
+func YumUpdateAdvisories(advisories []string) YumUpdateOption {
+	return func(args *yumUpdateOpts) {
+		args.advisories = advisories
+	}
+}
+
 // YumDryRun performs a dry run.
 func YumDryRun(dryrun bool) YumUpdateOption {
 	return func(args *yumUpdateOpts) {
@@ -75,8 +96,8 @@ func YumDryRun(dryrun bool) YumUpdateOption {
 	}
 }
 
-// RunYumUpdate runs yum update.
-func RunYumUpdate(opts ...YumUpdateOption) error {
+// RunYumUpdate runs yum update, the result lists every available update.
+func RunYumUpdate(opts ...YumUpdateOption) (*Result, error) {
 	yumOpts := &yumUpdateOpts{
 		security: false,
 		minimal:  false,
@@ -87,31 +108,24 @@ func RunYumUpdate(opts ...YumUpdateOption) error {
 		opt(yumOpts)
 	}
 
-	pkgs, err := packages.YumUpdates(packages.YumUpdateMinimal(yumOpts.minimal), packages.YumUpdateSecurity(yumOpts.security))
+	pkgs, err := yumUpdates(packages.YumUpdateMinimal(yumOpts.minimal), packages.YumUpdateSecurity(yumOpts.security))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fPkgs, err := filterPackages(pkgs, yumOpts.exclusivePackages, yumOpts.excludes)
 	if err != nil {
-		return err
-	}
-	if len(fPkgs) == 0 {
-		logger.Infof("No packages to update.")
-		return nil
+		return nil, err
 	}
 
-	var pkgNames []string
-	for _, pkg := range fPkgs {
-		pkgNames = append(pkgNames, pkg.Name)
-	}
-	logger.Infof("Updating %d packages.", len(pkgNames))
-	logger.Debugf("Packages to be installed: %s", fPkgs)
-
-	if yumOpts.dryrun {
-		logger.Infof("Running in dryrun mode, not updating packages.")
-		return nil
+	fPkgs, err = selectAdvisories(fPkgs, yumOpts.advisories, packages.YumAdvisories)
+	if err != nil {
+		return nil, err
 	}
 
-	return packages.InstallYumPackages(pkgNames)
+	h := listHolds(yumVersionlockedPackages, "locked with yum versionlock", yumOpts.neverPatch)
+	fPkgs = h.filter(fPkgs)
+	return updatePackages("yum", pkgs, fPkgs, h, yumOpts.dryrun, installedRPMPackages, func() error {
+		return installYumPackages(pkgNames(fPkgs))
+	})
 }
@@ -0,0 +1,66 @@
+//  Copyright 2020 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ospatch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
+)
+
+func TestRunYumUpdateHolds(t *testing.T) {
+	defer func() {
+		yumUpdates = packages.YumUpdates
+		yumVersionlockedPackages = packages.YumVersionlockedPackages
+		installedRPMPackages = packages.InstalledRPMPackages
+		installYumPackages = packages.InstallYumPackages
+	}()
+	yumUpdates = func(...packages.YumUpdateOption) ([]packages.PkgInfo, error) {
+		return []packages.PkgInfo{{Name: "foo", Version: "2"}, {Name: "bar", Version: "2"}, {Name: "baz", Version: "2"}}, nil
+	}
+	installedRPMPackages = func() ([]packages.PkgInfo, error) { return nil, nil }
+
+	tests := []struct {
+		name        string
+		held        []string
+		neverPatch  []string
+		wantInstall []string
+	}{
+		{"NoHolds", nil, nil, []string{"foo", "bar", "baz"}},
+		{"Held", []string{"bar"}, nil, []string{"foo", "baz"}},
+		{"HeldGlob", []string{"ba*"}, nil, []string{"foo"}},
+		{"NeverPatch", nil, []string{"foo"}, []string{"bar", "baz"}},
+		{"HeldAndNeverPatch", []string{"bar"}, []string{"foo"}, []string{"baz"}},
+		{"AllHeld", []string{"*"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yumVersionlockedPackages = func() ([]string, error) { return tt.held, nil }
+			var gotInstall []string
+			installYumPackages = func(pkgs []string) error {
+				gotInstall = pkgs
+				return nil
+			}
+
+			if _, err := RunYumUpdate(YumUpdateNeverPatch(tt.neverPatch)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(gotInstall, tt.wantInstall) {
+				t.Errorf("installed packages = %q, want %q", gotInstall, tt.wantInstall)
+			}
+		})
+	}
+}
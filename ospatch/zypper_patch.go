@@ -15,6 +15,10 @@
 package ospatch
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
@@ -23,6 +27,12 @@ const zypper = "/usr/bin/zypper"
 
 var (
 	zypperPatchArgs = []string{"patch", "-y"}
+
+	zypperPatches         = packages.ZypperPatches
+	zypperUpdates         = packages.ZypperUpdates
+	zypperPackagesInPatch = packages.ZypperPackagesInPatch
+	zypperLocks           = packages.ZypperLocks
+	zypperInstall         = packages.ZypperInstall
 )
 
 type zypperPatchOpts struct {
@@ -32,6 +42,8 @@ type zypperPatchOpts struct {
 	withUpdate       bool
 	excludes         []string
 	exclusivePatches []string
+	neverPatch       []string
+	advisories       []string
 	dryrun           bool
 }
 
@@ -86,6 +98,24 @@ func ZypperUpdateWithExclusivePatches(exclusivePatches []string) ZypperPatchOpti
 	}
 }
 
+// ZypperUpdateNeverPatch returns a ZypperUpdateOption that specifies packages
+// and patches that are never updated, they are reported as skipped like
+// zypper locks.
+func ZypperUpdateNeverPatch(neverPatch []string) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.neverPatch = neverPatch
+	}
+}
+
+// ZypperPatchAdvisories returns a ZypperUpdateOption that only installs the
+// patches named by, or fixing the CVEs in, advisories. Package updates that
+// are not part of a patch are not installed.
+func ZypperPatchAdvisories(advisories []string) ZypperPatchOption {
+	return func(args *zypperPatchOpts) {
+		args.advisories = advisories
+	}
+}
+
 // ZypperUpdateDryrun returns a ZypperUpdateOption that specifies the runner.
 func ZypperUpdateDryrun(dryrun bool) ZypperPatchOption {
 	return func(args *zypperPatchOpts) {
@@ -93,8 +123,9 @@ func ZypperUpdateDryrun(dryrun bool) ZypperPatchOption {
 	}
 }
 
-// RunZypperPatch runs zypper patch.
-func RunZypperPatch(opts ...ZypperPatchOption) error {
+// RunZypperPatch runs zypper patch, the result lists every available patch
+// and, with --with-update, every available package update.
+func RunZypperPatch(opts ...ZypperPatchOption) (*Result, error) {
 	zOpts := &zypperPatchOpts{
 		excludes:         nil,
 		exclusivePatches: nil,
@@ -115,31 +146,78 @@ func RunZypperPatch(opts ...ZypperPatchOption) error {
 		// if there is no filter on category and severity,
 		// zypper fetches all available patch updates
 	}
-	patches, err := packages.ZypperPatches(zListOpts...)
+	patches, err := zypperPatches(zListOpts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// if user specifies, --with-update get the necessary patch/package
-	// information and then runfilter on them
+	// The packages in each patch are needed to hold back patches that would
+	// update a locked or never patch package, and with --with-update to
+	// filter out the package updates that are part of a patch.
 	var pkgToPatchesMap map[string][]string
-	var pkgUpdates []packages.PkgInfo
-	if zOpts.withUpdate {
-		pkgUpdates, err = packages.ZypperUpdates()
+	if len(patches) > 0 {
+		pkgToPatchesMap, err = zypperPackagesInPatch(patches)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		pkgToPatchesMap, err = packages.ZypperPackagesInPatch(patches)
+	}
+	var pkgUpdates []packages.PkgInfo
+	if zOpts.withUpdate {
+		pkgUpdates, err = zypperUpdates()
 		if err != nil {
-			return nil
+			return nil, err
 		}
 	}
 
 	fPatches, fpkgs, err := runFilter(patches, zOpts.exclusivePatches, zOpts.excludes, pkgUpdates, pkgToPatchesMap, zOpts.withUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(zOpts.advisories) > 0 {
+		if fPatches, err = selectPatchAdvisories(fPatches, zOpts.advisories, packages.ZypperPatchCVEs); err != nil {
+			return nil, err
+		}
+		fpkgs = nil
+	}
+
+	lockedPkgs, lockedPatches, err := zypperLocks()
+	if err != nil {
+		logger.Warningf("Error listing zypper locks: %v", err)
+	}
+	const lockReason = "locked with zypper addlock"
+	pkgHolds := holds{held: lockedPkgs, heldReason: lockReason, neverPatch: zOpts.neverPatch}
+	patchHolds := holds{held: lockedPatches, heldReason: lockReason, neverPatch: zOpts.neverPatch}
+	fpkgs = pkgHolds.filter(fpkgs)
+	heldPatches := heldPatchReasons(patches, pkgToPatchesMap, patchHolds, pkgHolds)
+	var unheldPatches []packages.ZypperPatch
+	for _, patch := range fPatches {
+		if reason, ok := heldPatches[patch.Name]; ok {
+			logger.Debugf("Not installing patch %s, %s.", patch.Name, reason)
+			continue
+		}
+		unheldPatches = append(unheldPatches, patch)
+	}
+	fPatches = unheldPatches
+
+	// Package updates that are part of a patch are reported with the patch.
+	var availablePkgs []packages.PkgInfo
+	for _, pkg := range pkgUpdates {
+		if _, ok := pkgToPatchesMap[pkg.Name]; !ok {
+			availablePkgs = append(availablePkgs, pkg)
+		}
+	}
 
+	res := &Result{PackageManager: "zypper"}
+	var before map[string]string
+	if len(fpkgs) > 0 || len(pkgHolds.held) > 0 {
+		before = installedVersions(installedRPMPackages)
+	}
 	if len(fPatches) == 0 && len(fpkgs) == 0 {
 		logger.Infof("No updates required.")
-		return nil
+		res.Patches = patchResults(patches, fPatches, heldPatches, zOpts.dryrun, nil)
+		res.Packages = packageResults(availablePkgs, fpkgs, pkgHolds, before, nil, zOpts.dryrun, nil)
+		return res, nil
 	}
 
 	if len(fPatches) == 0 {
@@ -158,10 +236,110 @@ func RunZypperPatch(opts ...ZypperPatchOption) error {
 
 	if zOpts.dryrun {
 		logger.Infof("Running in dryrun mode, not updating.")
-		return nil
+		res.Patches = patchResults(patches, fPatches, heldPatches, zOpts.dryrun, nil)
+		res.Packages = packageResults(availablePkgs, fpkgs, pkgHolds, before, nil, zOpts.dryrun, nil)
+		return res, nil
 	}
 
-	return packages.ZypperInstall(fPatches, fpkgs)
+	err = zypperInstall(fPatches, fpkgs)
+	res.Patches = patchResults(patches, fPatches, heldPatches, zOpts.dryrun, err)
+	res.Packages = packageResults(availablePkgs, fpkgs, pkgHolds, before, installedVersions(installedRPMPackages), zOpts.dryrun, err)
+	return res, err
+}
+
+// heldPatchReasons returns why each held patch is held, a patch is held if it
+// is locked or in the never patch list, or if it updates a package that is.
+func heldPatchReasons(patches []packages.ZypperPatch, pkgToPatchesMap map[string][]string, patchHolds, pkgHolds holds) map[string]string {
+	reasons := make(map[string]string)
+	for _, patch := range patches {
+		if reason, ok := patchHolds.reason(patch.Name); ok {
+			reasons[patch.Name] = reason
+		}
+	}
+
+	// Sort the package names so the reported package does not change
+	// between runs when a patch contains several held packages.
+	var pkgs []string
+	for pkg := range pkgToPatchesMap {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		reason, ok := pkgHolds.reason(pkg)
+		if !ok {
+			continue
+		}
+		for _, patch := range pkgToPatchesMap[pkg] {
+			if _, ok := reasons[patch]; !ok {
+				reasons[patch] = fmt.Sprintf("contains package %s, %s", pkg, reason)
+			}
+		}
+	}
+	return reasons
+}
+
+// patchResults returns the result of every available patch, zypper installs
+// patches in a single transaction so they all share installErr. held maps the
+// held patches to the reason they are held.
+func patchResults(available, selected []packages.ZypperPatch, held map[string]string, dryrun bool, installErr error) []PatchResult {
+	var results []PatchResult
+	for _, patch := range available {
+		r := PatchResult{Name: patch.Name, Category: patch.Category, Severity: patch.Severity}
+		switch {
+		case !containsPatch(selected, patch.Name):
+			r.Status, r.Reason = PackageSkipped, reasonExcluded
+			if reason, ok := held[patch.Name]; ok {
+				r.Reason = reason
+			}
+		case dryrun:
+			r.Status, r.Reason = PackageSkipped, reasonDryRun
+		case installErr != nil:
+			r.Status, r.Reason = PackageFailed, installErr.Error()
+		default:
+			r.Status = PackageUpdated
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// selectPatchAdvisories returns the patches named by ids or fixing a CVE in
+// ids, cves is only called if ids contains a CVE.
+func selectPatchAdvisories(patches []packages.ZypperPatch, ids []string, cves func() (map[string][]string, error)) ([]packages.ZypperPatch, error) {
+	targets := make(map[string]bool)
+	var hasCVE bool
+	for _, id := range ids {
+		targets[strings.ToUpper(id)] = true
+		hasCVE = hasCVE || strings.HasPrefix(strings.ToUpper(id), "CVE-")
+	}
+	if hasCVE {
+		fixes, err := cves()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			for _, name := range fixes[strings.ToUpper(id)] {
+				targets[strings.ToUpper(name)] = true
+			}
+		}
+	}
+
+	var fPatches []packages.ZypperPatch
+	for _, patch := range patches {
+		if targets[strings.ToUpper(patch.Name)] {
+			fPatches = append(fPatches, patch)
+		}
+	}
+	return fPatches, nil
+}
+
+func containsPatch(patches []packages.ZypperPatch, name string) bool {
+	for _, p := range patches {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func runFilter(patches []packages.ZypperPatch, exclusivePatches, excludes []string, pkgUpdates []packages.PkgInfo, pkgToPatchesMap map[string][]string, withUpdate bool) ([]packages.ZypperPatch, []packages.PkgInfo, error) {
@@ -170,7 +348,7 @@ func runFilter(patches []packages.ZypperPatch, exclusivePatches, excludes []stri
 	var fPkgs []packages.PkgInfo
 	if len(exclusivePatches) > 0 {
 		for _, patch := range patches {
-			if containsString(exclusivePatches, patch.Name) {
+			if matchesAny(exclusivePatches, patch.Name) {
 				fPatches = append(fPatches, patch)
 			}
 		}
@@ -191,7 +369,7 @@ func runFilter(patches []packages.ZypperPatch, exclusivePatches, excludes []stri
 	// as per the configurations provided by user;
 	// we remove the excluded patches from the list
 	for _, patch := range patches {
-		if !containsString(excludes, patch.Name) {
+		if !matchesAny(excludes, patch.Name) {
 			fPatches = append(fPatches, patch)
 		}
 	}
@@ -1,6 +1,7 @@
 package ospatch
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -49,6 +50,14 @@ func TestRunFilter(t *testing.T) {
 			input:  input{patches: patches, pkgUpdates: pkgUpdates, pkgToPatchesMap: pkgToPatchesMap, exclusiveIncludes: []string{}, excludes: []string{}, withUpdate: false},
 			expect: expect{patches: []string{"patch-1", "patch-2", "patch-3"}, pkgUpdates: []string{}, err: nil},
 		},
+		{name: "runFilterwithglobexcludes",
+			input:  input{patches: patches, pkgUpdates: pkgUpdates, pkgToPatchesMap: pkgToPatchesMap, exclusiveIncludes: []string{}, excludes: []string{"patch-[12]"}, withUpdate: false},
+			expect: expect{patches: []string{"patch-3"}, pkgUpdates: []string{}, err: nil},
+		},
+		{name: "runFilterwithglobexclusivepatches",
+			input:  input{patches: patches, pkgUpdates: pkgUpdates, pkgToPatchesMap: pkgToPatchesMap, exclusiveIncludes: []string{"patch-*"}, excludes: []string{}, withUpdate: false},
+			expect: expect{patches: []string{"patch-1", "patch-2", "patch-3"}, pkgUpdates: []string{}, err: nil},
+		},
 	}
 
 	for _, tc := range tests {
@@ -151,3 +160,85 @@ func prepareTestCase() ([]packages.ZypperPatch, []packages.PkgInfo, map[string][
 
 	return patches, pkgUpdates, pkgToPatchesMap
 }
+
+func TestSelectPatchAdvisories(t *testing.T) {
+	patches := []packages.ZypperPatch{{Name: "SUSE-SLE-Module-Basesystem-15-SP1-2019-1550"}, {Name: "SUSE-SLE-Module-Basesystem-15-SP1-2019-1258"}}
+	var cveCalls int
+	cves := func() (map[string][]string, error) {
+		cveCalls++
+		return map[string][]string{"CVE-2019-11477": {"SUSE-SLE-Module-Basesystem-15-SP1-2019-1550"}}, nil
+	}
+
+	tests := []struct {
+		name         string
+		ids          []string
+		want         []packages.ZypperPatch
+		wantCVECalls int
+	}{
+		{"PatchName", []string{"SUSE-SLE-Module-Basesystem-15-SP1-2019-1258"}, []packages.ZypperPatch{patches[1]}, 0},
+		{"CVE", []string{"CVE-2019-11477"}, []packages.ZypperPatch{patches[0]}, 1},
+		{"NotApplicable", []string{"CVE-2020-0001"}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cveCalls = 0
+			got, err := selectPatchAdvisories(patches, tt.ids, cves)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectPatchAdvisories() = %v, want %v", got, tt.want)
+			}
+			if cveCalls != tt.wantCVECalls {
+				t.Errorf("want %d CVE listings, got %d", tt.wantCVECalls, cveCalls)
+			}
+		})
+	}
+}
+
+func TestRunZypperPatchHolds(t *testing.T) {
+	defer func() {
+		zypperPatches = packages.ZypperPatches
+		zypperPackagesInPatch = packages.ZypperPackagesInPatch
+		zypperLocks = packages.ZypperLocks
+		zypperInstall = packages.ZypperInstall
+		installedRPMPackages = packages.InstalledRPMPackages
+	}()
+	zypperPatches = func(...packages.ZypperListOption) ([]packages.ZypperPatch, error) {
+		return []packages.ZypperPatch{{Name: "patch-kernel"}, {Name: "patch-vim"}, {Name: "patch-sudo"}, {Name: "patch-locked"}}, nil
+	}
+	zypperPackagesInPatch = func([]packages.ZypperPatch) (map[string][]string, error) {
+		return map[string][]string{
+			"kernel-default": {"patch-kernel"},
+			"vim":            {"patch-vim"},
+			"sudo":           {"patch-sudo"},
+			"openssl":        {"patch-locked"},
+		}, nil
+	}
+	zypperLocks = func() ([]string, []string, error) { return []string{"openssl"}, nil, nil }
+	installedRPMPackages = func() ([]packages.PkgInfo, error) { return nil, nil }
+	var gotInstall []string
+	zypperInstall = func(patches []packages.ZypperPatch, _ []packages.PkgInfo) error {
+		for _, patch := range patches {
+			gotInstall = append(gotInstall, patch.Name)
+		}
+		return nil
+	}
+
+	res, err := RunZypperPatch(ZypperUpdateNeverPatch([]string{"kernel*", "patch-sudo"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"patch-vim"}; !reflect.DeepEqual(gotInstall, want) {
+		t.Errorf("installed patches = %q, want %q", gotInstall, want)
+	}
+	want := []PatchResult{
+		{Name: "patch-kernel", Status: PackageSkipped, Reason: "contains package kernel-default, " + reasonNeverPatch},
+		{Name: "patch-vim", Status: PackageUpdated},
+		{Name: "patch-sudo", Status: PackageSkipped, Reason: reasonNeverPatch},
+		{Name: "patch-locked", Status: PackageSkipped, Reason: "contains package openssl, locked with zypper addlock"},
+	}
+	if !reflect.DeepEqual(res.Patches, want) {
+		t.Errorf("patch results = %+v, want %+v", res.Patches, want)
+	}
+}
@@ -141,7 +141,7 @@ func aptChanges(aptInstalled, aptRemoved, aptUpdated []*agentendpointpb.Package)
 	if err != nil {
 		return err
 	}
-	changes := getNecessaryChanges(installed, updates, aptInstalled, aptRemoved, aptUpdated)
+	changes := getNecessaryChanges(installed, updates, aptInstalled, aptRemoved, aptUpdated, packages.CompareDebVersions)
 
 	if changes.packagesToInstall != nil {
 		logger.Infof("Installing packages %s", changes.packagesToInstall)
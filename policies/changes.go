@@ -15,6 +15,8 @@
 package policies
 
 import (
+	"strings"
+
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
@@ -28,11 +30,12 @@ type changes struct {
 }
 
 // getNecessaryChanges compares the current state and the desired state to determine which packages
-// need to be installed, upgraded, or removed.
-func getNecessaryChanges(installedPkgs []packages.PkgInfo, upgradablePkgs []packages.PkgInfo, installPkgs, removePkgs, updatePkgs []*agentendpointpb.Package) changes {
-	installedPkgMap := make(map[string]bool)
+// need to be installed, upgraded, or removed. If compare is set, packages to install can be pinned
+// to a minimum version as name=version, they are installed again if an older version is installed.
+func getNecessaryChanges(installedPkgs []packages.PkgInfo, upgradablePkgs []packages.PkgInfo, installPkgs, removePkgs, updatePkgs []*agentendpointpb.Package, compare func(a, b string) int) changes {
+	installedPkgMap := make(map[string][]string)
 	for _, pkg := range installedPkgs {
-		installedPkgMap[pkg.Name] = true
+		installedPkgMap[pkg.Name] = append(installedPkgMap[pkg.Name], pkg.Version)
 	}
 
 	upgradeablePkgMap := make(map[string]bool)
@@ -45,7 +48,12 @@ func getNecessaryChanges(installedPkgs []packages.PkgInfo, upgradablePkgs []pack
 	var pkgsToUpgrade []string
 
 	for _, pkg := range installPkgs {
-		if _, ok := installedPkgMap[pkg.Name]; !ok {
+		name, version := pkg.Name, ""
+		if compare != nil {
+			name, version = splitPin(pkg.Name)
+		}
+		installed, ok := installedPkgMap[name]
+		if !ok || (version != "" && !versionInstalled(installed, version, compare)) {
 			pkgsToInstall = append(pkgsToInstall, pkg.Name)
 		}
 	}
@@ -73,3 +81,35 @@ func getNecessaryChanges(installedPkgs []packages.PkgInfo, upgradablePkgs []pack
 		packagesToRemove:  pkgsToRemove,
 	}
 }
+
+// splitPin splits a name=version package pin.
+func splitPin(pkg string) (string, string) {
+	if i := strings.Index(pkg, "="); i != -1 {
+		return pkg[:i], pkg[i+1:]
+	}
+	return pkg, ""
+}
+
+// versionInstalled reports whether any of the installed versions is the same
+// as or newer than version.
+func versionInstalled(installed []string, version string, compare func(a, b string) int) bool {
+	for _, v := range installed {
+		if compare(v, version) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withEpoch adds the epoch to the versions of installed rpm packages, which
+// are listed without it, so they compare correctly to pins with an epoch.
+func withEpoch(pkgs []packages.PkgInfo) []packages.PkgInfo {
+	res := make([]packages.PkgInfo, len(pkgs))
+	for i, pkg := range pkgs {
+		if pkg.Epoch != "" && !strings.Contains(pkg.Version, ":") {
+			pkg.Version = pkg.Epoch + ":" + pkg.Version
+		}
+		res[i] = pkg
+	}
+	return res
+}
@@ -31,6 +31,7 @@ func TestGetNecessaryChanges(t *testing.T) {
 		installPkgs    []*agentendpointpb.Package
 		removePkgs     []*agentendpointpb.Package
 		updatePkgs     []*agentendpointpb.Package
+		compare        func(a, b string) int
 		want           changes
 	}{
 		{
@@ -94,11 +95,75 @@ func TestGetNecessaryChanges(t *testing.T) {
 				packagesToUpgrade: []string{"bar"},
 				packagesToRemove:  []string{"buz"},
 			},
+		}, {
+			name:           "pinned version installed",
+			installedPkgs:  []packages.PkgInfo{{Name: "foo", Version: "1:1.2.3-1"}, {Name: "bar", Version: "2.0-1"}},
+			upgradablePkgs: createPkgInfos(),
+			installPkgs:    createPackages("foo=1:1.2.3-1", "bar=2.0~rc1-1"),
+			removePkgs:     createPackages(),
+			updatePkgs:     createPackages(),
+			compare:        packages.CompareDebVersions,
+			want: changes{
+				packagesToInstall: []string{},
+				packagesToUpgrade: []string{},
+				packagesToRemove:  []string{},
+			},
+		}, {
+			name:           "pinned version older",
+			installedPkgs:  []packages.PkgInfo{{Name: "foo", Version: "1.2.3-1"}, {Name: "bar", Version: "1.0-1"}},
+			upgradablePkgs: createPkgInfos(),
+			installPkgs:    createPackages("foo=1.10-1", "bar=1.0-1", "baz=1.0"),
+			removePkgs:     createPackages(),
+			updatePkgs:     createPackages(),
+			compare:        packages.CompareRPMVersions,
+			want: changes{
+				packagesToInstall: []string{"foo=1.10-1", "baz=1.0"},
+				packagesToUpgrade: []string{},
+				packagesToRemove:  []string{},
+			},
+		}, {
+			name:           "yum pinned version installed",
+			installedPkgs:  []packages.PkgInfo{{Name: "foo", Version: "1.2.3-1.el8"}, {Name: "bar", Version: "2.0-3.el8_1"}},
+			upgradablePkgs: createPkgInfos(),
+			installPkgs:    createPackages("foo=1.2.3", "bar=2.0-3.el8"),
+			removePkgs:     createPackages(),
+			updatePkgs:     createPackages(),
+			compare:        packages.CompareRPMVersions,
+			want: changes{
+				packagesToInstall: []string{},
+				packagesToUpgrade: []string{},
+				packagesToRemove:  []string{},
+			},
+		}, {
+			name:           "yum pinned version older",
+			installedPkgs:  []packages.PkgInfo{{Name: "foo", Version: "1.2.3-1.el8"}, {Name: "bar", Version: "2.0-3.el8"}},
+			upgradablePkgs: createPkgInfos(),
+			installPkgs:    createPackages("foo=1:1.0", "bar=2.0-3.el8_1"),
+			removePkgs:     createPackages(),
+			updatePkgs:     createPackages(),
+			compare:        packages.CompareRPMVersions,
+			want: changes{
+				packagesToInstall: []string{"foo=1:1.0", "bar=2.0-3.el8_1"},
+				packagesToUpgrade: []string{},
+				packagesToRemove:  []string{},
+			},
+		}, {
+			name:           "pin without compare",
+			installedPkgs:  createPkgInfos("foo"),
+			upgradablePkgs: createPkgInfos(),
+			installPkgs:    createPackages("foo=1.0"),
+			removePkgs:     createPackages(),
+			updatePkgs:     createPackages(),
+			want: changes{
+				packagesToInstall: []string{"foo=1.0"},
+				packagesToUpgrade: []string{},
+				packagesToRemove:  []string{},
+			},
 		},
 	}
 
 	for _, tt := range tests {
-		got := getNecessaryChanges(tt.installedPkgs, tt.upgradablePkgs, tt.installPkgs, tt.removePkgs, tt.updatePkgs)
+		got := getNecessaryChanges(tt.installedPkgs, tt.upgradablePkgs, tt.installPkgs, tt.removePkgs, tt.updatePkgs, tt.compare)
 
 		if !equalChanges(&got, &tt.want) {
 			t.Errorf("Did not get expected changes for '%s', got: %v, want: %v", tt.name, got, tt.want)
@@ -134,3 +199,18 @@ func createPackages(names ...string) []*agentendpointpb.Package {
 	}
 	return res
 }
+
+func TestWithEpoch(t *testing.T) {
+	got := withEpoch([]packages.PkgInfo{{Name: "foo", Version: "1.0-1"}, {Name: "bar", Version: "2.0-1", Epoch: "1"}})
+	want := []packages.PkgInfo{{Name: "foo", Version: "1.0-1"}, {Name: "bar", Version: "1:2.0-1", Epoch: "1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withEpoch() = %+v, want %+v", got, want)
+	}
+}
+
+func TestYumInstallSpecs(t *testing.T) {
+	got := yumInstallSpecs([]string{"foo", "bar=1.0-1.el8", "baz=1:2.0"})
+	if want := []string{"foo", "bar-1.0-1.el8", "baz-1:2.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("yumInstallSpecs() = %q, want %q", got, want)
+	}
+}
@@ -56,7 +56,8 @@ func googetChanges(gooInstalled, gooRemoved, gooUpdated []*agentendpointpb.Packa
 	if err != nil {
 		return err
 	}
-	changes := getNecessaryChanges(installed, updates, gooInstalled, gooRemoved, gooUpdated)
+	// GooGet version pins are not supported, package names are used as is.
+	changes := getNecessaryChanges(installed, updates, gooInstalled, gooRemoved, gooUpdated, nil)
 
 	if changes.packagesToInstall != nil {
 		logger.Infof("Installing packages %s", changes.packagesToInstall)
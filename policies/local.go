@@ -19,8 +19,8 @@ import (
 	"bytes"
 	"encoding/json"
 
-	"cloud.google.com/go/compute/metadata"
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/config"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 
@@ -65,7 +65,7 @@ func (r *softwareRecipe) UnmarshalJSON(b []byte) error {
 }
 
 func readLocalConfig() (*localConfig, error) {
-	s, err := metadata.Get("/instance/attributes/gce-software-declaration")
+	s, err := config.Metadata().Get("/instance/attributes/gce-software-declaration")
 	if err != nil {
 		logger.Debugf("No local config: %v", err)
 		return nil, nil
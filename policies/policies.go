@@ -30,14 +30,15 @@ import (
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 	"github.com/GoogleCloudPlatform/osconfig/policies/recipes"
 	"github.com/GoogleCloudPlatform/osconfig/tasker"
+	"google.golang.org/api/option"
 
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
-func run(ctx context.Context) {
+func run(ctx context.Context, opts ...option.ClientOption) {
 	var resp *agentendpointpb.EffectiveGuestPolicy
 
-	client, err := agentendpoint.NewClient(ctx)
+	client, err := agentendpoint.NewClient(ctx, opts...)
 	if err != nil {
 		logger.Errorf("agentendpoint.NewClient Error: %v", err)
 	} else {
@@ -61,8 +62,9 @@ func run(ctx context.Context) {
 }
 
 // Run looks up osconfigs and applies them using tasker.Enqueue.
-func Run(ctx context.Context) {
-	tasker.Enqueue("Run GuestPolicies", func() { run(ctx) })
+// Any provided ClientOptions are passed to agentendpoint.NewClient.
+func Run(ctx context.Context, opts ...option.ClientOption) {
+	tasker.Enqueue("Run GuestPolicies", func() { run(ctx, opts...) })
 }
 
 func installRecipes(ctx context.Context, egp *agentendpointpb.EffectiveGuestPolicy) error {
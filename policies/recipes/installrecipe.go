@@ -39,9 +39,9 @@ func InstallRecipe(ctx context.Context, recipe *agentendpointpb.SoftwareRecipe)
 	}
 	installedRecipe, ok := recipeDB.getRecipe(recipe.Name)
 	if ok {
-		logger.Debugf("Currently installed version of software recipe %s with version %s.", recipe.Name, installedRecipe.Version)
+		logger.Debugf("Currently installed version of software recipe %s with version %s.", recipe.Name, installedRecipe.versionString())
 		if (installedRecipe.compare(recipe.Version)) && (recipe.DesiredState == agentendpointpb.DesiredState_UPDATED) {
-			logger.Infof("Upgrading software recipe %s from version %s to %s.", recipe.Name, installedRecipe.Version, recipe.Version)
+			logger.Infof("Upgrading software recipe %s from version %s to %s.", recipe.Name, installedRecipe.versionString(), recipe.Version)
 			steps = recipe.UpdateSteps
 		} else {
 			logger.Debugf("Skipping software recipe %s.", recipe.Name)
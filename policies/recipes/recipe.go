@@ -16,10 +16,16 @@ package recipes
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 )
 
+// prereleaseRegex matches period separated alphanumeric identifiers.
+var prereleaseRegex = regexp.MustCompile(`^[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*$`)
+
 type recipeVersion []int
 
 func (v recipeVersion) String() string {
@@ -32,64 +38,75 @@ func (v recipeVersion) String() string {
 
 // Recipe represents an installed recipe.
 type Recipe struct {
-	Name        string
-	Version     recipeVersion
+	Name    string
+	Version recipeVersion
+	// Prerelease is the pre-release part of the version, like rc1 in
+	// 1.2.3-rc1.
+	Prerelease  string `json:",omitempty"`
 	InstallTime int64
 	Success     bool
 }
 
 func (r *Recipe) setVersion(version string) error {
 	var err error
-	r.Version, err = convertVersion(version)
+	r.Version, r.Prerelease, err = convertVersion(version)
 	return err
 }
 
+// versionString returns the full version of the recipe.
+func (r *Recipe) versionString() string {
+	if len(r.Version) == 0 {
+		return "0"
+	}
+	if r.Prerelease == "" {
+		return r.Version.String()
+	}
+	return r.Version.String() + "-" + r.Prerelease
+}
+
 // compare returns true if the provided Version is greater than the recipe's
 // Version, false otherwise.
 func (r *Recipe) compare(version string) bool {
 	if version == "" {
 		return false
 	}
-	cVersion, err := convertVersion(version)
-	if err != nil {
+	if _, _, err := convertVersion(version); err != nil {
 		return false
 	}
-	if len(r.Version) > len(cVersion) {
-		topad := len(r.Version) - len(cVersion)
-		for i := 0; i < topad; i++ {
-			cVersion = append(cVersion, 0)
-		}
-	} else {
-		topad := len(cVersion) - len(r.Version)
-		for i := 0; i < topad; i++ {
-			r.Version = append(r.Version, 0)
-		}
-	}
-	for i := 0; i < len(r.Version); i++ {
-		if r.Version[i] != cVersion[i] {
-			return cVersion[i] > r.Version[i]
-		}
-	}
-	return false
+	return packages.CompareSemver(r.versionString(), version) < 0
 }
 
-func convertVersion(version string) ([]int, error) {
+// convertVersion parses a version of up to 4 period separated numbers,
+// optionally followed by a -pre-release and +build metadata. The build
+// metadata is dropped as it does not take part in ordering.
+func convertVersion(version string) ([]int, string, error) {
 	// ${ROOT}/recipe[_ver]/runId/recipe.yaml  // recipe at time of application
 	// ${ROOT}/recipe[_ver]/runId/artifacts/*
 	// ${ROOT}/recipe[_ver]/runId/stepN_type/
 	if version == "" {
-		return []int{0}, nil
+		return []int{0}, "", nil
+	}
+	if i := strings.Index(version, "+"); i != -1 {
+		version = version[:i]
+	}
+	var prerelease string
+	if i := strings.Index(version, "-"); i != -1 {
+		prerelease = version[i+1:]
+		version = version[:i]
+		if !prereleaseRegex.MatchString(prerelease) {
+			return nil, "", fmt.Errorf("invalid Version string")
+		}
 	}
 	var ret []int
 	for idx, element := range strings.Split(version, ".") {
 		if idx > 3 {
-			return nil, fmt.Errorf("invalid Version string")
+			return nil, "", fmt.Errorf("invalid Version string")
 		}
 		val, err := strconv.ParseUint(element, 10, 0)
 		if err != nil {
-			return nil, fmt.Errorf("invalid Version string")
+			return nil, "", fmt.Errorf("invalid Version string")
 		}
 		ret = append(ret, int(val))
 	}
-	return ret, nil
+	return ret, prerelease, nil
 }
@@ -100,3 +100,38 @@ func TestRecipe_Compare_IsEqualVersion(t *testing.T) {
 		t.Errorf("should return false")
 	}
 }
+
+func TestRecipe_SetVersion_Prerelease(t *testing.T) {
+	rec := &Recipe{}
+	if err := rec.setVersion("1.2.3-rc1+build5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.Version) != 3 || rec.Version[2] != 3 || rec.Prerelease != "rc1" {
+		t.Errorf("invalid Version set for the recipe: %v %q", rec.Version, rec.Prerelease)
+	}
+	if err := rec.setVersion("1.2.3-rc..1"); err == nil {
+		t.Errorf("setVersion should return error")
+	}
+}
+
+func TestRecipe_Compare_Prerelease(t *testing.T) {
+	tests := []struct {
+		version    []int
+		prerelease string
+		desired    string
+		want       bool
+	}{
+		{[]int{1, 2, 3}, "rc1", "1.2.3", true},
+		{[]int{1, 2, 3}, "rc1", "1.2.3-rc2", true},
+		{[]int{1, 2, 3}, "rc2", "1.2.3-rc1", false},
+		{[]int{1, 2, 3}, "", "1.2.3-rc1", false},
+		{[]int{1, 2, 2}, "", "1.2.3-rc1", true},
+		{[]int{1, 2, 3}, "rc1", "1.2.3-rc1+build2", false},
+	}
+	for _, tt := range tests {
+		rec := &Recipe{Version: tt.version, Prerelease: tt.prerelease}
+		if got := rec.compare(tt.desired); got != tt.want {
+			t.Errorf("%s.compare(%q) = %t, want %t", rec.versionString(), tt.desired, got, tt.want)
+		}
+	}
+}
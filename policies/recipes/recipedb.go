@@ -65,11 +65,11 @@ func (db RecipeDB) getRecipe(name string) (Recipe, bool) {
 
 // addRecipe marks a recipe as installed.
 func (db RecipeDB) addRecipe(name, version string, success bool) error {
-	versionNum, err := convertVersion(version)
+	versionNum, prerelease, err := convertVersion(version)
 	if err != nil {
 		return err
 	}
-	db[name] = Recipe{Name: name, Version: versionNum, InstallTime: time.Now().Unix(), Success: success}
+	db[name] = Recipe{Name: name, Version: versionNum, Prerelease: prerelease, InstallTime: time.Now().Unix(), Success: success}
 
 	var recipelist []Recipe
 	for _, recipe := range db {
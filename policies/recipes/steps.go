@@ -31,6 +31,8 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/guest-logging-go/logger"
+	"github.com/GoogleCloudPlatform/osconfig/execenv"
+	"github.com/GoogleCloudPlatform/osconfig/interpreter"
 	"github.com/GoogleCloudPlatform/osconfig/inventory/packages"
 	"github.com/GoogleCloudPlatform/osconfig/util"
 	"github.com/ulikunitz/xz"
@@ -39,6 +41,8 @@ import (
 	agentendpointpb "google.golang.org/genproto/googleapis/cloud/osconfig/agentendpoint/v1beta"
 )
 
+var execEnvOptions = execenv.FromConfig
+
 var extensionMap = map[agentendpointpb.SoftwareRecipe_Step_RunScript_Interpreter]string{
 	agentendpointpb.SoftwareRecipe_Step_RunScript_INTERPRETER_UNSPECIFIED: ".bat",
 	agentendpointpb.SoftwareRecipe_Step_RunScript_SHELL:                   ".bat",
@@ -440,6 +444,9 @@ func stepExecFile(step *agentendpointpb.SoftwareRecipe_Step_ExecFile, artifacts
 		if err != nil {
 			return fmt.Errorf("error setting execute permissions on artifact %s: %v", step.GetArtifactId(), err)
 		}
+		if err := execEnvOptions().Chown(path); err != nil {
+			return fmt.Errorf("error setting owner of artifact %s: %v", step.GetArtifactId(), err)
+		}
 	case step.GetLocalPath() != "":
 		path = step.GetLocalPath()
 	default:
@@ -447,7 +454,16 @@ func stepExecFile(step *agentendpointpb.SoftwareRecipe_Step_ExecFile, artifacts
 
 	}
 
-	return executeCommand(path, step.Args, stepDir, runEnvs, []int32{0})
+	cmd := path
+	var args []string
+	if runtime.GOOS != "windows" {
+		var err error
+		if cmd, args, err = interpreter.Command(interpreter.Default, path); err != nil {
+			return err
+		}
+	}
+
+	return executeCommand(cmd, append(args, step.Args...), stepDir, runEnvs, []int32{0})
 }
 
 func stepRunScript(step *agentendpointpb.SoftwareRecipe_Step_RunScript, artifacts map[string]string, runEnvs []string, stepDir string) error {
@@ -464,19 +480,28 @@ func stepRunScript(step *agentendpointpb.SoftwareRecipe_Step_RunScript, artifact
 	var args []string
 	switch step.Interpreter {
 	case agentendpointpb.SoftwareRecipe_Step_RunScript_INTERPRETER_UNSPECIFIED:
-		cmd = scriptPath
+		if runtime.GOOS == "windows" {
+			cmd = scriptPath
+		} else {
+			var err error
+			if cmd, args, err = interpreter.Command(interpreter.Default, scriptPath); err != nil {
+				return err
+			}
+		}
 	case agentendpointpb.SoftwareRecipe_Step_RunScript_SHELL:
 		if runtime.GOOS == "windows" {
 			cmd = scriptPath
 		} else {
-			args = append([]string{scriptPath})
-			cmd = "/bin/sh"
+			var err error
+			if cmd, args, err = interpreter.Command(interpreter.Shell, scriptPath); err != nil {
+				return err
+			}
 		}
 	case agentendpointpb.SoftwareRecipe_Step_RunScript_POWERSHELL:
 		if runtime.GOOS != "windows" {
 			return fmt.Errorf("interpreter %q can only be used on Windows systems", step.Interpreter)
 		}
-		args = append([]string{"-File", scriptPath})
+		args = []string{"-File", scriptPath}
 		cmd = "C:\\Windows\\System32\\WindowsPowerShell\\v1.0\\PowerShell.exe"
 	default:
 		return fmt.Errorf("unsupported interpreter %q", step.Interpreter)
@@ -503,14 +528,23 @@ func writeScript(path, contents string) error {
 }
 
 func executeCommand(cmd string, args []string, workDir string, runEnvs []string, allowedExitCodes []int32) error {
+	opts := execEnvOptions()
+	// Recipe steps always run in their own step directory.
+	opts.Dir = workDir
+
 	cmdObj := exec.Command(cmd, args...)
-	cmdObj.Dir = workDir
 	defaultEnv, err := createDefaultEnvironment()
 	if err != nil {
 		return fmt.Errorf("error creating default environment: %v", err)
 	}
-	cmdObj.Env = append(cmdObj.Env, defaultEnv...)
+	cmdObj.Env = append(cmdObj.Env, opts.FilterEnv(defaultEnv)...)
 	cmdObj.Env = append(cmdObj.Env, runEnvs...)
+	if err := opts.Chown(workDir); err != nil {
+		return fmt.Errorf("error setting owner of working directory: %v", err)
+	}
+	if err := opts.Apply(cmdObj); err != nil {
+		return err
+	}
 
 	o, err := cmdObj.CombinedOutput()
 	if err == nil {
@@ -66,6 +66,19 @@ func yumRepositories(repos []*agentendpointpb.YumRepository, repoFile string) er
 	return writeIfChanged(buf.Bytes(), repoFile)
 }
 
+// yumInstallSpecs turns name=version pins into the name-version specs yum
+// installs.
+func yumInstallSpecs(pkgs []string) []string {
+	var specs []string
+	for _, pkg := range pkgs {
+		if name, version := splitPin(pkg); version != "" {
+			pkg = name + "-" + version
+		}
+		specs = append(specs, pkg)
+	}
+	return specs
+}
+
 func yumChanges(yumInstalled, yumRemoved, yumUpdated []*agentendpointpb.Package) error {
 	var errs []string
 
@@ -77,11 +90,11 @@ func yumChanges(yumInstalled, yumRemoved, yumUpdated []*agentendpointpb.Package)
 	if err != nil {
 		return err
 	}
-	changes := getNecessaryChanges(installed, updates, yumInstalled, yumRemoved, yumUpdated)
+	changes := getNecessaryChanges(withEpoch(installed), updates, yumInstalled, yumRemoved, yumUpdated, packages.CompareRPMVersions)
 
 	if changes.packagesToInstall != nil {
 		logger.Infof("Installing packages %s", changes.packagesToInstall)
-		if err := packages.InstallYumPackages(changes.packagesToInstall); err != nil {
+		if err := packages.InstallYumPackages(yumInstallSpecs(changes.packagesToInstall)); err != nil {
 			errs = append(errs, fmt.Sprintf("error installing yum packages: %v", err))
 		}
 	}
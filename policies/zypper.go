@@ -77,7 +77,7 @@ func zypperChanges(zypperInstalled, zypperRemoved, zypperUpdated []*agentendpoin
 	if err != nil {
 		return err
 	}
-	changes := getNecessaryChanges(installed, updates, zypperInstalled, zypperRemoved, zypperUpdated)
+	changes := getNecessaryChanges(withEpoch(installed), updates, zypperInstalled, zypperRemoved, zypperUpdated, packages.CompareRPMVersions)
 
 	if changes.packagesToInstall != nil {
 		logger.Infof("Installing packages %s", changes.packagesToInstall)